@@ -20,6 +20,27 @@ const (
 	ProbeProbe                      // health determined dynamically by a probe (Admin field only); maps to "auto" in BackendSetHealth
 )
 
+// String returns the name of the state, as reported by backend.list.
+// Implements [fmt.Stringer].
+func (h ProbeHealth) String() string {
+	switch h {
+	case ProbeHealthy:
+		return "healthy"
+	case ProbeSick:
+		return "sick"
+	case ProbeProbe:
+		return "probe"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so that ProbeHealth
+// serializes as its name.
+func (h ProbeHealth) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
 func probeHealthFromString(s string) ProbeHealth {
 	switch s {
 	case "healthy":
@@ -166,3 +166,17 @@ func TestBackendSetHealth(t *testing.T) {
 		t.Error("expected error for ProbeUnknown state, got nil")
 	}
 }
+
+func TestProbeHealthString(t *testing.T) {
+	t.Parallel()
+	for state, want := range map[adm.ProbeHealth]string{
+		adm.ProbeUnknown: "unknown",
+		adm.ProbeHealthy: "healthy",
+		adm.ProbeSick:    "sick",
+		adm.ProbeProbe:   "probe",
+	} {
+		if got, _ := state.MarshalText(); string(got) != want {
+			t.Errorf("ProbeHealth(%d).MarshalText() = %q, want %q", int(state), got, want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Report the health and traffic of Varnish backends, from counters and the admin socket
+package health
+
+// Backend health is spread between the VBE counters of the shared memory
+// (the probe history bitmap, requests, connections and failures) and the
+// backend.list command of the admin socket (the probe results, the health
+// forced by backend.set_health, and when the health last changed). [Join]
+// combines both into one [BackendStatus] per backend; a [Monitor] refreshes
+// them on an interval, e.g. for a status page.
+//
+// # Usage
+//
+//	r, err := stat.New().SetName(name).SetFieldIncludes("VBE.*", "MAIN.uptime").Attach()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer r.Close()
+//	conn, err := adm.Connect(ctx, name)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer conn.Close()
+//
+//	m, err := health.New(r, conn).SetInterval(5 * time.Second).Build()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	go m.Run(ctx)
+//	http.Handle("/backends", m)
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/varnish/varnish-go/adm"
+	"github.com/varnish/varnish-go/stat"
+)
+
+// DefaultInterval is the refresh interval of a [Monitor], unless changed with
+// [MonitorBuilder.SetInterval].
+const DefaultInterval = 5 * time.Second
+
+// The VBE fields of a [BackendStatus].
+const (
+	fieldHappy = "happy"
+	fieldReq   = "req"
+	fieldConn  = "conn"
+	fieldFail  = "fail"
+)
+
+// Probe is the latest result of the probe of a backend, from backend.list.
+type Probe struct {
+	Good    int  `json:"good"    yaml:"good"`  // successful probes in the window
+	Total   int  `json:"total"   yaml:"total"` // size of the window
+	Healthy bool `json:"healthy" yaml:"healthy"`
+}
+
+// BackendStatus is the health and traffic of a backend, see [Join].
+type BackendStatus struct {
+	VCL  string `json:"vcl"  yaml:"vcl"`
+	Name string `json:"name" yaml:"name"`
+	// Healthy is the health varnishd uses: the one forced with
+	// backend.set_health, else the probe's, else true.
+	Healthy bool `json:"healthy" yaml:"healthy"`
+	// Admin is [adm.ProbeProbe] when the probe decides, [adm.ProbeHealthy]
+	// or [adm.ProbeSick] when forced, [adm.ProbeUnknown] if the backend isn't
+	// in backend.list.
+	Admin adm.ProbeHealth `json:"admin" yaml:"admin"`
+	// Probe is nil for backends without a probe.
+	Probe *Probe `json:"probe,omitempty" yaml:"probe,omitempty"`
+	// ProbeHistory is the outcome of the last 64 probes, most recent first,
+	// see [stat.Backend.ProbeHistory]. It's nil without counters.
+	ProbeHistory []bool    `json:"probeHistory,omitempty" yaml:"probeHistory,omitempty"`
+	LastChange   time.Time `json:"lastChange"             yaml:"lastChange"` // when the health last changed
+	// Requests and Failures are the backend requests sent and the failed
+	// connection attempts since the backend was created, and RequestRate and
+	// FailureRate their per-second rate since the previous snapshot.
+	Requests    uint64  `json:"requests"    yaml:"requests"`
+	RequestRate float64 `json:"requestRate" yaml:"requestRate"`
+	Failures    uint64  `json:"failures"    yaml:"failures"`
+	FailureRate float64 `json:"failureRate" yaml:"failureRate"`
+	// Connections is the number of connections in use.
+	Connections uint64 `json:"connections" yaml:"connections"`
+}
+
+// Join combines the VBE counters of cur with the backends listed by
+// [adm.Conn.BackendList], and returns the status of every backend found in
+// either, sorted by VCL and name. Rates are computed against prev, and are
+// zero if prev is the zero Snapshot.
+func Join(prev, cur stat.Snapshot, list map[string]adm.BackendEntry) []BackendStatus {
+	var deltas stat.Deltas
+	if prev.Values != nil {
+		deltas = stat.Diff(prev, cur)
+	}
+
+	var statuses []BackendStatus
+	index := map[string]int{} // by full name
+	status := func(vcl, name string) *BackendStatus {
+		full := vcl + "." + name
+		i, ok := index[full]
+		if !ok {
+			i = len(statuses)
+			index[full] = i
+			statuses = append(statuses, BackendStatus{VCL: vcl, Name: name, Healthy: true})
+		}
+		return &statuses[i]
+	}
+
+	for name, v := range cur.Values {
+		n := stat.ParseName(name)
+		if n.Type != "VBE" || n.VCL == "" {
+			continue
+		}
+		s := status(n.VCL, n.Backend)
+		switch n.Field {
+		case fieldHappy:
+			s.ProbeHistory = stat.Backend{Counters: map[string]stat.Counter{
+				fieldHappy: {Value: &v.Value, Semantics: v.Semantics, Flags: v.Flags},
+			}}.ProbeHistory()
+		case fieldReq:
+			s.Requests = v.Value
+			s.RequestRate = deltas.Counters[name].Rate
+		case fieldFail:
+			s.Failures = v.Value
+			s.FailureRate = deltas.Counters[name].Rate
+		case fieldConn:
+			s.Connections = v.Value
+		}
+	}
+
+	for _, e := range list {
+		s := status(e.VCL, e.Name)
+		s.Admin = e.Admin
+		s.LastChange = e.LastChange
+		if e.Probe != nil {
+			s.Probe = &Probe{Good: e.Probe.Good, Total: e.Probe.Total, Healthy: e.Probe.State == adm.ProbeHealthy}
+		}
+		switch {
+		case e.Admin == adm.ProbeHealthy:
+			s.Healthy = true
+		case e.Admin == adm.ProbeSick:
+			s.Healthy = false
+		case s.Probe != nil:
+			s.Healthy = s.Probe.Healthy
+		}
+	}
+
+	slices.SortFunc(statuses, func(a, b BackendStatus) int {
+		return cmp.Or(strings.Compare(a.VCL, b.VCL), strings.Compare(a.Name, b.Name))
+	})
+	return statuses
+}
+
+// MonitorBuilder configures a [Monitor].
+// Obtain one with [New], configure with the Set* methods, then call [MonitorBuilder.Build].
+type MonitorBuilder struct {
+	r          *stat.StatReader
+	conn       *adm.Conn
+	interval   time.Duration
+	errHandler func(error)
+}
+
+// New returns a MonitorBuilder reading the counters from r and the backend
+// list from conn, with the [DefaultInterval].
+func New(r *stat.StatReader, conn *adm.Conn) *MonitorBuilder {
+	return &MonitorBuilder{r: r, conn: conn, interval: DefaultInterval}
+}
+
+// SetInterval sets how often [Monitor.Run] refreshes the statuses.
+func (b *MonitorBuilder) SetInterval(interval time.Duration) *MonitorBuilder {
+	b.interval = interval
+	return b
+}
+
+// SetErrHandler registers a callback that is invoked when a refresh fails in
+// [Monitor.Run], which then keeps the previous statuses and carries on.
+// Without one, Run returns the error.
+func (b *MonitorBuilder) SetErrHandler(h func(error)) *MonitorBuilder {
+	b.errHandler = h
+	return b
+}
+
+// Build validates the configuration and returns a [Monitor].
+func (b *MonitorBuilder) Build() (*Monitor, error) {
+	if b.r == nil {
+		return nil, fmt.Errorf("no stat reader given")
+	}
+	if b.conn == nil {
+		return nil, fmt.Errorf("no admin connection given")
+	}
+	if b.interval <= 0 {
+		return nil, fmt.Errorf("refresh interval must be positive, got %s", b.interval)
+	}
+	return &Monitor{r: b.r, conn: b.conn, interval: b.interval, errHandler: b.errHandler}, nil
+}
+
+// Monitor keeps the status of the backends of a Varnish instance up to date.
+// It uses its [stat.StatReader] and [adm.Conn] exclusively: they must not be
+// used elsewhere meanwhile. Its methods are safe for concurrent use.
+type Monitor struct {
+	r          *stat.StatReader
+	conn       *adm.Conn
+	interval   time.Duration
+	errHandler func(error)
+
+	refresh  sync.Mutex // serializes Refresh
+	prev     stat.Snapshot
+	mu       sync.RWMutex // protects the fields below
+	statuses []BackendStatus
+	updated  time.Time
+}
+
+// Refresh updates the counters, lists the backends, and joins them. On
+// failure, the previous statuses are kept.
+func (m *Monitor) Refresh(ctx context.Context) error {
+	m.refresh.Lock()
+	defer m.refresh.Unlock()
+	if _, _, err := m.r.Update(); err != nil {
+		return err
+	}
+	cur := m.r.Snapshot()
+	list, err := m.conn.BackendList(ctx)
+	if err != nil {
+		return err
+	}
+	statuses := Join(m.prev, cur, list)
+	m.prev = cur
+
+	m.mu.Lock()
+	m.statuses, m.updated = statuses, cur.Time
+	m.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the statuses right away, then every interval, until ctx is
+// cancelled. It returns ctx.Err(), or the first refresh error if there is no
+// error handler.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Refresh(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if m.errHandler == nil {
+				return err
+			}
+			m.errHandler(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Status returns the statuses of the last successful refresh, sorted by VCL
+// and name, and its time. The time is zero before the first one.
+func (m *Monitor) Status() ([]BackendStatus, time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.statuses), m.updated
+}
+
+// ServeHTTP serves the result of [Monitor.Status] as a JSON object with
+// "time" and "backends" members. It doesn't refresh the statuses: call
+// [Monitor.Run] or [Monitor.Refresh] for that. Implements [http.Handler].
+func (m *Monitor) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	statuses, updated := m.Status()
+	if statuses == nil {
+		statuses = []BackendStatus{}
+	}
+	b, err := json.Marshal(struct {
+		Time     time.Time       `json:"time"`
+		Backends []BackendStatus `json:"backends"`
+	}{updated, statuses})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
@@ -0,0 +1,150 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/adm"
+	"github.com/varnish/varnish-go/health"
+	"github.com/varnish/varnish-go/stat"
+	"github.com/varnish/varnish-go/vtest"
+)
+
+func TestJoin(t *testing.T) {
+	t.Parallel()
+	counter := func(v uint64) stat.Value {
+		return stat.Value{Value: v, Semantics: stat.SemanticsCounter, Flags: stat.FlagsInteger}
+	}
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	prev := stat.Snapshot{Time: t0, Values: map[string]stat.Value{
+		"MAIN.uptime":        counter(100),
+		"VBE.boot.api.req":   counter(1000),
+		"VBE.boot.api.fail":  counter(2),
+		"VBE.boot.web.req":   counter(500),
+		"VBE.boot.web.happy": {Value: 0, Semantics: stat.SemanticsBitmap, Flags: stat.FlagsBitmap},
+	}}
+	cur := stat.Snapshot{Time: t0.Add(10 * time.Second), Values: map[string]stat.Value{
+		"MAIN.uptime":        counter(110),
+		"VBE.boot.api.req":   counter(1500),
+		"VBE.boot.api.fail":  counter(12),
+		"VBE.boot.api.conn":  {Value: 4, Semantics: stat.SemanticsGauge, Flags: stat.FlagsInteger},
+		"VBE.boot.api.happy": {Value: 0b110, Semantics: stat.SemanticsBitmap, Flags: stat.FlagsBitmap},
+		"VBE.boot.web.req":   counter(500),
+		"VBE.boot.web.happy": {Value: 0, Semantics: stat.SemanticsBitmap, Flags: stat.FlagsBitmap},
+	}}
+	changed := time.Unix(1767268800, 0)
+	list := map[string]adm.BackendEntry{
+		"boot.api": {FullName: "boot.api", VCL: "boot", Name: "api", Admin: adm.ProbeProbe, LastChange: changed,
+			Probe: &adm.ProbeResult{Good: 2, Total: 3, State: adm.ProbeHealthy}},
+		"boot.web": {FullName: "boot.web", VCL: "boot", Name: "web", Admin: adm.ProbeSick, LastChange: changed},
+		"vcl2.new": {FullName: "vcl2.new", VCL: "vcl2", Name: "new", Admin: adm.ProbeProbe, LastChange: changed},
+	}
+
+	got := health.Join(prev, cur, list)
+	if len(got) != 3 {
+		t.Fatalf("got %d statuses, want 3: %+v", len(got), got)
+	}
+
+	api := got[0]
+	if api.VCL != "boot" || api.Name != "api" || !api.Healthy || api.Admin != adm.ProbeProbe ||
+		api.Probe == nil || *api.Probe != (health.Probe{Good: 2, Total: 3, Healthy: true}) || !api.LastChange.Equal(changed) {
+		t.Errorf("unexpected boot.api: %+v", api)
+	}
+	if api.Requests != 1500 || api.RequestRate != 50 || api.Failures != 12 || api.FailureRate != 1 || api.Connections != 4 {
+		t.Errorf("unexpected boot.api traffic: %+v", api)
+	}
+	if len(api.ProbeHistory) != 64 || api.ProbeHistory[0] || !api.ProbeHistory[1] || !api.ProbeHistory[2] {
+		t.Errorf("unexpected boot.api probe history: %v", api.ProbeHistory[:4])
+	}
+
+	web := got[1]
+	if web.Name != "web" || web.Healthy || web.Admin != adm.ProbeSick || web.Probe != nil || web.RequestRate != 0 {
+		t.Errorf("unexpected boot.web: %+v", web)
+	}
+
+	// listed, but no counters yet
+	fresh := got[2]
+	if fresh.VCL != "vcl2" || fresh.Name != "new" || !fresh.Healthy || fresh.ProbeHistory != nil || fresh.Requests != 0 {
+		t.Errorf("unexpected vcl2.new: %+v", fresh)
+	}
+
+	// without a previous snapshot, or a backend list
+	for _, s := range health.Join(stat.Snapshot{}, cur, nil) {
+		if s.RequestRate != 0 || s.Admin != adm.ProbeUnknown || !s.Healthy {
+			t.Errorf("unexpected status without history nor list: %+v", s)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	if _, err := health.New(nil, nil).Build(); err == nil {
+		t.Error("expected an error without a stat reader")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer svr.Close()
+
+	v := vtest.New().Backend("svr", svr.URL).AssertStart(t)
+	defer v.Stop()
+
+	r, err := v.StatReaderBuilder().SetFieldIncludes("VBE.*", "MAIN.uptime").Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	m, err := health.New(r, v.AdmConn()).SetInterval(100 * time.Millisecond).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, updated := m.Status(); !updated.IsZero() {
+		t.Errorf("updated at %s before the first refresh", updated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	if _, err := http.Get(v.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	var svrStatus health.BackendStatus
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		statuses, _ := m.Status()
+		for _, s := range statuses {
+			if s.VCL == "vcl1" && s.Name == "svr" {
+				svrStatus = s
+			}
+		}
+		if svrStatus.Requests > 0 {
+			break
+		}
+	}
+	if svrStatus.Requests == 0 || !svrStatus.Healthy || svrStatus.Admin != adm.ProbeProbe || svrStatus.LastChange.IsZero() {
+		t.Errorf("unexpected vcl1.svr: %+v", svrStatus)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/backends", nil))
+	var body struct {
+		Time     time.Time
+		Backends []map[string]any
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Time.IsZero() || len(body.Backends) == 0 || body.Backends[0]["admin"] != "probe" {
+		t.Errorf("unexpected body: %s", rec.Body)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run returned %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Aggregate VSL transactions into top lists, histograms and counters (like varnishtop and varnishhist)
+package aggregate
+
+// Three aggregators are provided, all fed with transactions from
+// [log.LogReader.Run] and safe to query while being fed:
+//
+//   - [Top] counts record payloads over a rolling window, like varnishtop;
+//     obtain one with [NewTop].
+//   - [Histogram] sorts response times into log-scale buckets by cache
+//     outcome (hit, miss, pass...), like varnishhist, and estimates
+//     percentiles; obtain one with [NewHistogram].
+//   - [StatusCounter] counts responses by status code; obtain one with
+//     [NewStatusCounter].
+//
+// Time is taken from the Timestamp records of the transactions rather than
+// from the clock, so reading a file gives the same results as following the
+// live log did.
+//
+// # Usage
+//
+//	top, err := aggregate.NewTop().
+//	    SetTags(varnishlog.TagReqURL).
+//	    SetWindow(time.Minute).
+//	    Build()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	hist, err := aggregate.NewHistogram().Build()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	status := aggregate.NewStatusCounter()
+//
+//	r, err := varnishlog.New().SetName("/tmp/my-varnish").Attach()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer r.Close()
+//
+//	go r.Run(ctx, aggregate.Handler(top, hist, status))
+//
+//	for range time.Tick(time.Second) {
+//	    fmt.Println(top.Top(10))
+//	    fmt.Println(hist.Percentile(0.99, varnishlog.HandlingMiss))
+//	    fmt.Println(status.Class(5))
+//	}
+
+import (
+	"time"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// Aggregator is implemented by [Top], [Histogram] and [StatusCounter].
+type Aggregator interface {
+	// Add accounts for a transaction, ignoring it if it's not relevant.
+	Add(txn log.Transaction)
+}
+
+// Handler returns a handler for [log.LogReader.Run] that adds every
+// transaction it receives to each of aggs. Any grouping works.
+func Handler(aggs ...Aggregator) func([]log.Transaction) error {
+	return func(txns []log.Transaction) error {
+		for _, txn := range txns {
+			for _, a := range aggs {
+				a.Add(txn)
+			}
+		}
+		return nil
+	}
+}
+
+// completion returns the time of the last Timestamp record of txn, or the
+// zero time if there's none.
+func completion(txn log.Transaction) time.Time {
+	for i := len(txn.Records) - 1; i >= 0; i-- {
+		if txn.Records[i].Tag != log.TagTimestamp {
+			continue
+		}
+		if ts, err := log.ParseTimestamp(txn.Records[i].Data); err == nil {
+			return ts.Abs
+		}
+	}
+	return time.Time{}
+}
+
+// response returns the summary of txn if it's a client request that was
+// responded to, i.e. not one that restarted.
+func response(txn log.Transaction) (log.RequestSummary, bool) {
+	if txn.Type != log.TypeRequest {
+		return log.RequestSummary{}, false
+	}
+	s := log.Summarize(txn)
+	return s, !s.Restarted && s.Status != 0
+}
@@ -0,0 +1,57 @@
+package aggregate_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+	"github.com/varnish/varnish-go/log/aggregate"
+)
+
+// feed reads test1_log.bin into aggs.
+func feed(t *testing.T, aggs ...aggregate.Aggregator) {
+	t.Helper()
+	r, err := varnishlog.New().SetFile(filepath.Join("..", "testdata", "test1_log.bin")).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Run(context.Background(), aggregate.Handler(aggs...)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+// request returns a client request completed at the given time.
+func request(at time.Time, handling string, status int, d time.Duration, url string) varnishlog.Transaction {
+	ts := func(label string, t time.Time, since time.Duration) varnishlog.Record {
+		return varnishlog.Record{Tag: varnishlog.TagTimestamp, Data: fmt.Sprintf("%s: %d.%06d %.6f 0.000000",
+			label, t.Unix(), t.Nanosecond()/1000, since.Seconds())}
+	}
+	return varnishlog.Transaction{
+		Type:   varnishlog.TypeRequest,
+		Reason: varnishlog.ReasonRxReq,
+		Records: []varnishlog.Record{
+			ts("Start", at.Add(-d), 0),
+			{Tag: varnishlog.TagReqURL, Data: url},
+			{Tag: varnishlog.TagVCLCall, Data: handling},
+			{Tag: varnishlog.TagRespStatus, Data: fmt.Sprint(status)},
+			ts("Resp", at, d),
+		},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+	top, err := aggregate.NewTop().SetTags(varnishlog.TagReqURL).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := aggregate.NewStatusCounter()
+	feed(t, top, status)
+	if top.Top(0) == nil || status.Total() == 0 {
+		t.Errorf("expected every aggregator to be fed, got %v and %v", top.Top(0), status.Counts())
+	}
+}
@@ -0,0 +1,185 @@
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// Defaults of [HistogramBuilder], close to varnishhist's.
+const (
+	DefaultHistogramMin     = time.Microsecond
+	DefaultHistogramMax     = 100 * time.Second
+	DefaultBucketsPerDecade = 10
+)
+
+// HistogramBuilder configures a [Histogram].
+// Obtain one with [NewHistogram], configure with the Set* methods, then call [HistogramBuilder.Build].
+type HistogramBuilder struct {
+	min, max  time.Duration
+	perDecade int
+}
+
+// NewHistogram returns a HistogramBuilder covering [DefaultHistogramMin] to
+// [DefaultHistogramMax] with [DefaultBucketsPerDecade].
+func NewHistogram() *HistogramBuilder {
+	return &HistogramBuilder{min: DefaultHistogramMin, max: DefaultHistogramMax, perDecade: DefaultBucketsPerDecade}
+}
+
+// SetRange sets the response times covered by the buckets. Faster responses
+// are counted in the first bucket, slower ones in the last.
+func (b *HistogramBuilder) SetRange(lower, upper time.Duration) *HistogramBuilder {
+	b.min, b.max = lower, upper
+	return b
+}
+
+// SetResolution sets the number of buckets per power of ten. Percentiles are
+// estimated within a factor of 10^(1/n) of the actual value.
+func (b *HistogramBuilder) SetResolution(n int) *HistogramBuilder {
+	b.perDecade = n
+	return b
+}
+
+// Build validates the configuration and returns a [Histogram].
+func (b *HistogramBuilder) Build() (*Histogram, error) {
+	switch {
+	case b.min <= 0 || b.max <= b.min:
+		return nil, fmt.Errorf("invalid range %s to %s", b.min, b.max)
+	case b.perDecade <= 0:
+		return nil, fmt.Errorf("invalid resolution %d", b.perDecade)
+	}
+	lo := math.Log10(b.min.Seconds())
+	n := int(math.Ceil((math.Log10(b.max.Seconds()) - lo) * float64(b.perDecade)))
+	return &Histogram{
+		lo:        lo,
+		perDecade: float64(b.perDecade),
+		n:         n,
+		counts:    map[log.Handling][]uint64{},
+	}, nil
+}
+
+// Bucket is a range of response times and the number of responses in it.
+type Bucket struct {
+	Lower time.Duration `json:"lower" yaml:"lower"`
+	Upper time.Duration `json:"upper" yaml:"upper"`
+	Count uint64        `json:"count" yaml:"count"`
+}
+
+// Histogram sorts the response times of client requests into log-scale
+// buckets, by cache outcome ([log.Handling]), like varnishhist. The response
+// time is the one of the Resp timestamp, see [log.RequestSummary]; requests
+// that restarted aren't counted, the request they restarted into is. It is
+// safe for concurrent use.
+type Histogram struct {
+	lo        float64 // log10 of the lower bound, in seconds
+	perDecade float64
+	n         int
+
+	mu     sync.Mutex
+	counts map[log.Handling][]uint64
+}
+
+// Add counts the response time of txn if it's a client request. Implements
+// [Aggregator].
+func (h *Histogram) Add(txn log.Transaction) {
+	s, ok := response(txn)
+	if !ok || s.Duration <= 0 {
+		return
+	}
+	i := int(math.Floor((math.Log10(s.Duration.Seconds()) - h.lo) * h.perDecade))
+	i = min(max(i, 0), h.n-1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.counts[s.Handling]
+	if c == nil {
+		c = make([]uint64, h.n)
+		h.counts[s.Handling] = c
+	}
+	c[i]++
+}
+
+// bound returns the lower bound of bucket i.
+func (h *Histogram) bound(i int) float64 {
+	return math.Pow(10, h.lo+float64(i)/h.perDecade)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+// merged returns the counts of the given handlings added up, all of them if
+// none is given.
+func (h *Histogram) merged(handlings []log.Handling) []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sum := make([]uint64, h.n)
+	for hd, c := range h.counts {
+		if len(handlings) > 0 && !slices.Contains(handlings, hd) {
+			continue
+		}
+		for i, v := range c {
+			sum[i] += v
+		}
+	}
+	return sum
+}
+
+// Buckets returns the buckets of the requests with the given handlings, of
+// all requests if none is given.
+func (h *Histogram) Buckets(handlings ...log.Handling) []Bucket {
+	counts := h.merged(handlings)
+	buckets := make([]Bucket, h.n)
+	for i, c := range counts {
+		buckets[i] = Bucket{Lower: seconds(h.bound(i)), Upper: seconds(h.bound(i + 1)), Count: c}
+	}
+	return buckets
+}
+
+// Count returns the number of requests with the given handlings, of all
+// requests if none is given.
+func (h *Histogram) Count(handlings ...log.Handling) uint64 {
+	var n uint64
+	for _, c := range h.merged(handlings) {
+		n += c
+	}
+	return n
+}
+
+// Percentile estimates the p-th quantile (0 < p <= 1, e.g. 0.99) of the
+// response times of the requests with the given handlings, of all requests if
+// none is given, by interpolating within its bucket. It returns 0 if there
+// are no such requests.
+func (h *Histogram) Percentile(p float64, handlings ...log.Handling) time.Duration {
+	counts := h.merged(handlings)
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 || p <= 0 {
+		return 0
+	}
+	rank := min(p, 1) * float64(total)
+	var seen float64
+	for i, c := range counts {
+		if c == 0 || seen+float64(c) < rank {
+			seen += float64(c)
+			continue
+		}
+		// geometric interpolation, the buckets being log-scale
+		frac := (rank - seen) / float64(c)
+		return seconds(h.bound(i) * math.Pow(10, frac/h.perDecade))
+	}
+	return seconds(h.bound(h.n))
+}
+
+// Reset forgets every count.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts = map[log.Handling][]uint64{}
+}
@@ -0,0 +1,106 @@
+package aggregate_test
+
+import (
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+	"github.com/varnish/varnish-go/log/aggregate"
+)
+
+func TestHistogramFile(t *testing.T) {
+	t.Parallel()
+	h, err := aggregate.NewHistogram().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed(t, h)
+
+	// the miss took 4.495ms, the pass 5.11ms; the request that restarted
+	// into the pass isn't counted
+	if n := h.Count(); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+	for _, tc := range []struct {
+		handling varnishlog.Handling
+		want     time.Duration
+	}{
+		{varnishlog.HandlingMiss, 4495 * time.Microsecond},
+		{varnishlog.HandlingPass, 5110 * time.Microsecond},
+	} {
+		if n := h.Count(tc.handling); n != 1 {
+			t.Errorf("%s: got %d requests, want 1", tc.handling, n)
+		}
+		// within the width of a bucket
+		if p := h.Percentile(1, tc.handling); p < tc.want*10/13 || p > tc.want*13/10 {
+			t.Errorf("%s: got 100th percentile %s, want about %s", tc.handling, p, tc.want)
+		}
+	}
+	if n := h.Count(varnishlog.HandlingHit); n != 0 {
+		t.Errorf("hit: got %d requests, want 0", n)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	t.Parallel()
+	h, err := aggregate.NewHistogram().SetResolution(100).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Unix(1700000000, 0)
+	for i := 1; i <= 100; i++ {
+		handling := "HIT"
+		if i > 90 {
+			handling = "MISS"
+		}
+		h.Add(request(t0, handling, 200, time.Duration(i)*time.Millisecond, "/"))
+	}
+
+	for _, tc := range []struct {
+		p         float64
+		handlings []varnishlog.Handling
+		want      time.Duration
+	}{
+		{0.5, nil, 50 * time.Millisecond},
+		{0.99, nil, 99 * time.Millisecond},
+		{0.5, []varnishlog.Handling{varnishlog.HandlingHit}, 45 * time.Millisecond},
+		{0.5, []varnishlog.Handling{varnishlog.HandlingMiss}, 95 * time.Millisecond},
+	} {
+		// 100 buckets per decade: within 2.3%
+		if got := h.Percentile(tc.p, tc.handlings...); got < tc.want*97/100 || got > tc.want*103/100 {
+			t.Errorf("Percentile(%v, %v): got %s, want about %s", tc.p, tc.handlings, got, tc.want)
+		}
+	}
+
+	var n uint64
+	for _, b := range h.Buckets(varnishlog.HandlingMiss) {
+		if b.Count > 0 && (b.Upper < 90*time.Millisecond || b.Lower > 100*time.Millisecond) {
+			t.Errorf("unexpected miss bucket %+v", b)
+		}
+		n += b.Count
+	}
+	if n != 10 {
+		t.Errorf("got %d misses in the buckets, want 10", n)
+	}
+	if n := h.Count(varnishlog.HandlingHit, varnishlog.HandlingMiss); n != 100 {
+		t.Errorf("got %d hits and misses, want 100", n)
+	}
+
+	h.Reset()
+	if h.Count() != 0 || h.Percentile(0.5) != 0 {
+		t.Error("expected Reset to empty the histogram")
+	}
+}
+
+func TestHistogramBuildErrors(t *testing.T) {
+	t.Parallel()
+	for name, b := range map[string]*aggregate.HistogramBuilder{
+		"range":      aggregate.NewHistogram().SetRange(time.Second, time.Millisecond),
+		"zero min":   aggregate.NewHistogram().SetRange(0, time.Second),
+		"resolution": aggregate.NewHistogram().SetResolution(0),
+	} {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: expected Build to fail", name)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package aggregate
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// StatusCounter counts the responses to client requests by status code.
+// Requests that restarted aren't counted, the request they restarted into is.
+// It is safe for concurrent use.
+type StatusCounter struct {
+	mu     sync.Mutex
+	counts map[int]uint64
+}
+
+// NewStatusCounter returns an empty StatusCounter.
+func NewStatusCounter() *StatusCounter {
+	return &StatusCounter{counts: map[int]uint64{}}
+}
+
+// Add counts the response status of txn if it's a client request. Implements
+// [Aggregator].
+func (c *StatusCounter) Add(txn log.Transaction) {
+	s, ok := response(txn)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[s.Status]++
+}
+
+// Count returns the number of responses with the given status.
+func (c *StatusCounter) Count(status int) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[status]
+}
+
+// Class returns the number of responses in the given class: 2 for 2xx, 5 for
+// 5xx, etc.
+func (c *StatusCounter) Class(class int) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n uint64
+	for status, v := range c.counts {
+		if status/100 == class {
+			n += v
+		}
+	}
+	return n
+}
+
+// Total returns the number of responses counted.
+func (c *StatusCounter) Total() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n uint64
+	for _, v := range c.counts {
+		n += v
+	}
+	return n
+}
+
+// Counts returns a copy of the counts, by status.
+func (c *StatusCounter) Counts() map[int]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.counts)
+}
+
+// Reset forgets every count.
+func (c *StatusCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.counts)
+}
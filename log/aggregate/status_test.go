@@ -0,0 +1,32 @@
+package aggregate_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/log/aggregate"
+)
+
+func TestStatusCounter(t *testing.T) {
+	t.Parallel()
+	c := aggregate.NewStatusCounter()
+	feed(t, c)
+	// the request that restarted on a 404 isn't counted
+	if got, want := c.Counts(), map[int]uint64{200: 1, 404: 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	t0 := time.Unix(1700000000, 0)
+	for _, status := range []int{503, 500, 200} {
+		c.Add(request(t0, "PASS", status, time.Millisecond, "/"))
+	}
+	if c.Count(200) != 2 || c.Class(5) != 2 || c.Class(4) != 1 || c.Total() != 5 {
+		t.Errorf("unexpected counts %v", c.Counts())
+	}
+
+	c.Reset()
+	if c.Total() != 0 {
+		t.Errorf("after Reset: got %v", c.Counts())
+	}
+}
@@ -0,0 +1,232 @@
+package aggregate
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// Defaults of [TopBuilder].
+const (
+	DefaultWindow     = time.Minute
+	DefaultResolution = 60
+)
+
+// TopBuilder configures a [Top].
+// Obtain one with [NewTop], configure with the Set* methods, then call [TopBuilder.Build].
+type TopBuilder struct {
+	tags       []log.Tag
+	prefix     string
+	field      int
+	window     time.Duration
+	resolution int
+}
+
+// NewTop returns a TopBuilder with a window of [DefaultWindow], divided into
+// [DefaultResolution] slots.
+func NewTop() *TopBuilder {
+	return &TopBuilder{window: DefaultWindow, resolution: DefaultResolution}
+}
+
+// SetTags sets the tags of the records to count, like varnishtop's -i option.
+// At least one is required.
+func (b *TopBuilder) SetTags(tags ...log.Tag) *TopBuilder {
+	b.tags = tags
+	return b
+}
+
+// SetPrefix only counts records whose payload starts with prefix followed by a
+// colon, and only their value, the way VSL queries select headers: with
+// SetTags(log.TagReqHeader) and SetPrefix("Host"), the Host headers are
+// counted. The prefix is case insensitive.
+func (b *TopBuilder) SetPrefix(prefix string) *TopBuilder {
+	b.prefix = prefix
+	return b
+}
+
+// SetField only counts the given whitespace-separated field of the payload
+// (after the prefix, if any), starting at 1. Records with fewer fields are
+// skipped. Zero, the default, counts the whole payload.
+func (b *TopBuilder) SetField(field int) *TopBuilder {
+	b.field = field
+	return b
+}
+
+// SetWindow sets the duration records are counted over.
+func (b *TopBuilder) SetWindow(window time.Duration) *TopBuilder {
+	b.window = window
+	return b
+}
+
+// SetResolution sets the number of slots the window is divided into: counts
+// leave the window one slot at a time.
+func (b *TopBuilder) SetResolution(slots int) *TopBuilder {
+	b.resolution = slots
+	return b
+}
+
+// Build validates the configuration and returns a [Top].
+func (b *TopBuilder) Build() (*Top, error) {
+	switch {
+	case len(b.tags) == 0:
+		return nil, fmt.Errorf("no tag given")
+	case b.field < 0:
+		return nil, fmt.Errorf("invalid field %d", b.field)
+	case b.window <= 0:
+		return nil, fmt.Errorf("window must be positive, got %s", b.window)
+	case b.resolution <= 0 || time.Duration(b.resolution) > b.window:
+		return nil, fmt.Errorf("invalid resolution %d for a %s window", b.resolution, b.window)
+	}
+	t := &Top{
+		prefix:  b.prefix,
+		field:   b.field,
+		slot:    b.window / time.Duration(b.resolution),
+		slots:   make([]map[Entry]uint64, b.resolution),
+		current: -1,
+		totals:  map[Entry]uint64{},
+	}
+	for _, tag := range b.tags {
+		if tag <= 0 || int(tag) >= len(t.tags) {
+			return nil, fmt.Errorf("invalid tag %d", int(tag))
+		}
+		t.tags[tag] = true
+	}
+	return t, nil
+}
+
+// Entry is a counted record payload. Count is zero when Entry is used as a key.
+type Entry struct {
+	Tag   log.Tag `json:"tag"   yaml:"tag"`
+	Value string  `json:"value" yaml:"value"`
+	Count uint64  `json:"count" yaml:"count"`
+}
+
+// Top counts the records with the configured tags over a rolling window, like
+// varnishtop. The window ends at the time of the latest transaction added: a
+// transaction's records are counted at its completion time (its last
+// Timestamp record), or at the latest time seen if it has none. It is safe for
+// concurrent use.
+type Top struct {
+	tags   [256]bool
+	prefix string
+	field  int
+	slot   time.Duration
+
+	mu      sync.Mutex
+	slots   []map[Entry]uint64 // ring of per-slot counts
+	current int64              // number of the latest slot, -1 before the first record
+	totals  map[Entry]uint64   // sum of slots
+}
+
+// Add counts the matching records of txn. Implements [Aggregator].
+func (t *Top) Add(txn log.Transaction) {
+	var keys []Entry
+	for _, rec := range txn.Records {
+		if rec.Tag <= 0 || int(rec.Tag) >= len(t.tags) || !t.tags[rec.Tag] {
+			continue
+		}
+		if v, ok := t.value(rec.Data); ok {
+			keys = append(keys, Entry{Tag: rec.Tag, Value: v})
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.current
+	if at := completion(txn); !at.IsZero() {
+		n = at.UnixNano() / int64(t.slot)
+	}
+	if n < 0 {
+		n = time.Now().UnixNano() / int64(t.slot)
+	}
+	t.advance(n)
+	if n <= t.current-int64(len(t.slots)) {
+		return // older than the window
+	}
+	slot := &t.slots[n%int64(len(t.slots))]
+	if *slot == nil {
+		*slot = map[Entry]uint64{}
+	}
+	for _, k := range keys {
+		(*slot)[k]++
+		t.totals[k]++
+	}
+}
+
+// value extracts the counted part of a payload.
+func (t *Top) value(data string) (string, bool) {
+	if t.prefix != "" {
+		name, rest, ok := strings.Cut(data, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), t.prefix) {
+			return "", false
+		}
+		data = strings.TrimSpace(rest)
+	}
+	if t.field > 0 {
+		f := strings.Fields(data)
+		if len(f) < t.field {
+			return "", false
+		}
+		data = f[t.field-1]
+	}
+	return data, true
+}
+
+// advance moves the window forward to slot n, dropping the slots leaving it.
+func (t *Top) advance(n int64) {
+	if n <= t.current {
+		return
+	}
+	if t.current >= 0 {
+		for i := t.current + 1; i <= n && i <= t.current+int64(len(t.slots)); i++ {
+			t.drop(i % int64(len(t.slots)))
+		}
+	}
+	t.current = n
+}
+
+func (t *Top) drop(i int64) {
+	for k, c := range t.slots[i] {
+		if t.totals[k] -= c; t.totals[k] == 0 {
+			delete(t.totals, k)
+		}
+	}
+	t.slots[i] = nil
+}
+
+// Top returns the n entries with the highest counts in the window, highest
+// first; ties are sorted by tag and value. n <= 0 returns them all.
+func (t *Top) Top(n int) []Entry {
+	t.mu.Lock()
+	entries := make([]Entry, 0, len(t.totals))
+	for k, c := range t.totals {
+		k.Count = c
+		entries = append(entries, k)
+	}
+	t.mu.Unlock()
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Tag, b.Tag), strings.Compare(a.Value, b.Value))
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// Reset forgets every count.
+func (t *Top) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.slots)
+	t.totals = map[Entry]uint64{}
+	t.current = -1
+}
@@ -0,0 +1,111 @@
+package aggregate_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+	"github.com/varnish/varnish-go/log/aggregate"
+)
+
+func TestTopFile(t *testing.T) {
+	t.Parallel()
+	urls, err := aggregate.NewTop().SetTags(varnishlog.TagReqURL, varnishlog.TagBereqURL).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := aggregate.NewTop().SetTags(varnishlog.TagReqHeader).SetPrefix("host").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents, err := aggregate.NewTop().SetTags(varnishlog.TagReqHeader).SetPrefix("User-Agent").SetField(1).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed(t, urls, hosts, agents)
+
+	want := []aggregate.Entry{
+		{Tag: varnishlog.TagReqURL, Value: "/unknown", Count: 2},
+		{Tag: varnishlog.TagBereqURL, Value: "/unknown", Count: 2},
+	}
+	if got := urls.Top(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("URLs: got %+v, want %+v", got, want)
+	}
+	if got := urls.Top(0); len(got) != 4 {
+		t.Errorf("URLs: got %+v, want 4 entries", got)
+	}
+	want = []aggregate.Entry{{Tag: varnishlog.TagReqHeader, Value: "0.0.0.0:8888", Count: 3}}
+	if got := hosts.Top(10); !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts: got %+v, want %+v", got, want)
+	}
+	want = []aggregate.Entry{{Tag: varnishlog.TagReqHeader, Value: "curl/8.20.0", Count: 3}}
+	if got := agents.Top(10); !reflect.DeepEqual(got, want) {
+		t.Errorf("user agents: got %+v, want %+v", got, want)
+	}
+}
+
+func TestTopWindow(t *testing.T) {
+	t.Parallel()
+	top, err := aggregate.NewTop().SetTags(varnishlog.TagReqURL).SetWindow(time.Minute).SetResolution(6).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Unix(1700000000, 0)
+	add := func(at time.Duration, url string) {
+		top.Add(request(t0.Add(at), "MISS", 200, time.Millisecond, url))
+	}
+	counts := func() map[string]uint64 {
+		m := map[string]uint64{}
+		for _, e := range top.Top(0) {
+			m[e.Value] = e.Count
+		}
+		return m
+	}
+
+	add(0, "/a")
+	add(5*time.Second, "/a")
+	add(30*time.Second, "/b")
+	if got, want := counts(), map[string]uint64{"/a": 2, "/b": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("within the window: got %v, want %v", got, want)
+	}
+
+	// /a's slot leaves the window, a late /a is still counted in it
+	add(65*time.Second, "/b")
+	add(20*time.Second, "/a")
+	if got, want := counts(), map[string]uint64{"/a": 1, "/b": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after sliding: got %v, want %v", got, want)
+	}
+
+	// records older than the window are ignored
+	add(0, "/old")
+	if _, ok := counts()["/old"]; ok {
+		t.Error("expected a record older than the window to be ignored")
+	}
+
+	// jumping ahead by more than a window empties it
+	add(time.Hour, "/c")
+	if got, want := counts(), map[string]uint64{"/c": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after a gap: got %v, want %v", got, want)
+	}
+
+	top.Reset()
+	if got := top.Top(0); len(got) != 0 {
+		t.Errorf("after Reset: got %+v", got)
+	}
+}
+
+func TestTopBuildErrors(t *testing.T) {
+	t.Parallel()
+	for name, b := range map[string]*aggregate.TopBuilder{
+		"no tags":     aggregate.NewTop(),
+		"invalid tag": aggregate.NewTop().SetTags(0),
+		"field":       aggregate.NewTop().SetTags(varnishlog.TagReqURL).SetField(-1),
+		"window":      aggregate.NewTop().SetTags(varnishlog.TagReqURL).SetWindow(0),
+		"resolution":  aggregate.NewTop().SetTags(varnishlog.TagReqURL).SetResolution(0),
+	} {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: expected Build to fail", name)
+		}
+	}
+}
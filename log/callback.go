@@ -28,6 +28,7 @@ package log
 import "C"
 import (
 	"runtime/cgo"
+	"time"
 	"unsafe"
 )
 
@@ -38,15 +39,26 @@ func readerFromPriv(priv unsafe.Pointer) *LogReader {
 //export dispatchCallback
 func dispatchCallback(_ *C.struct_VSL_data, ctrans **C.struct_VSL_transaction, priv unsafe.Pointer) C.int {
 	r := readerFromPriv(priv)
+	if r.viewHandler != nil {
+		return r.dispatchView(ctrans)
+	}
 
 	var txns []Transaction
+	var root int64
+	var end time.Time
+	var nrecs int
+	track := r.tracking
 	for i := C.int(0); ; i++ {
 		t := C.transAt(ctrans, i)
 		if t == nil {
 			break
 		}
+		if i == 0 {
+			root = int64(t.vxid)
+		}
 
 		var records []Record
+		var ts *C.uint32_t
 		for {
 			status := C.VSL_Next(t.c)
 			if status == C.vsl_end {
@@ -56,6 +68,13 @@ func dispatchCallback(_ *C.struct_VSL_data, ctrans **C.struct_VSL_transaction, p
 				return C.int(status)
 			}
 			ptr := t.c.rec.ptr
+			tag := int(C.recTag(ptr))
+			if Tag(tag) == TagTimestamp {
+				ts = ptr
+			}
+			if !r.keepTag(tag) || (r.vslMatch && C.VSL_Match(r.vapi.vsl, t.c) == 0) {
+				continue
+			}
 			records = append(records, Record{
 				Tag:       Tag(C.recTag(ptr)),
 				VXID:      uint64(C.recID(ptr)),
@@ -64,7 +83,14 @@ func dispatchCallback(_ *C.struct_VSL_data, ctrans **C.struct_VSL_transaction, p
 				Data:      C.GoStringN(C.recData(ptr), C.recDataLen(ptr)),
 			})
 		}
+		if track {
+			end = laterRecord(end, ts)
+		}
+		if records == nil && r.skipEmpty() {
+			continue
+		}
 
+		nrecs += len(records)
 		txns = append(txns, Transaction{
 			Level:      int(t.level),
 			VXID:       int64(t.vxid),
@@ -75,9 +101,116 @@ func dispatchCallback(_ *C.struct_VSL_data, ctrans **C.struct_VSL_transaction, p
 		})
 	}
 
-	if err := r.handler(txns); err != nil {
+	if track && r.skipResumed(end, root) {
+		return 0
+	}
+	if txns != nil {
+		start := time.Now()
+		err := r.handler(txns)
+		r.stats.delivered(len(txns), nrecs, time.Since(start))
+		if err != nil {
+			r.handlerErr = err
+			return -1
+		}
+	}
+	if track {
+		r.advance(end, root)
+	}
+	return 0
+}
+
+// laterRecord is laterTimestamp for the Timestamp record at ptr, if any.
+func laterRecord(t time.Time, ptr *C.uint32_t) time.Time {
+	if ptr == nil {
+		return t
+	}
+	return laterTimestamp(t, unsafe.Slice((*byte)(unsafe.Pointer(C.recData(ptr))), C.recDataLen(ptr)))
+}
+
+// dispatchView is the [LogReader.RunView] counterpart of dispatchCallback: the
+// views point straight into libvarnishapi's buffers, and the slices holding
+// them are reused from one call to the next.
+func (r *LogReader) dispatchView(ctrans **C.struct_VSL_transaction) C.int {
+	r.views, r.viewRecs, r.viewBounds = r.views[:0], r.viewRecs[:0], r.viewBounds[:0]
+	var root int64
+	var end time.Time
+	track := r.tracking
+	for i := C.int(0); ; i++ {
+		t := C.transAt(ctrans, i)
+		if t == nil {
+			break
+		}
+		if i == 0 {
+			root = int64(t.vxid)
+		}
+
+		start := len(r.viewRecs)
+		var ts *C.uint32_t
+		for {
+			status := C.VSL_Next(t.c)
+			if status == C.vsl_end {
+				break
+			}
+			if status < 0 {
+				return C.int(status)
+			}
+			ptr := t.c.rec.ptr
+			tag := C.recTag(ptr)
+			if Tag(tag) == TagTimestamp {
+				ts = ptr
+			}
+			if !r.keepTag(int(tag)) || (r.vslMatch && C.VSL_Match(r.vapi.vsl, t.c) == 0) {
+				continue
+			}
+			r.viewRecs = append(r.viewRecs, RecordView{
+				Tag:       Tag(tag),
+				VXID:      uint64(C.recID(ptr)),
+				IsClient:  C.recClient(ptr) != 0,
+				IsBackend: C.recBackend(ptr) != 0,
+				data:      unsafe.Slice((*byte)(unsafe.Pointer(C.recData(ptr))), C.recDataLen(ptr)),
+			})
+		}
+		if track {
+			end = laterRecord(end, ts)
+		}
+		if len(r.viewRecs) == start && r.skipEmpty() {
+			continue
+		}
+
+		r.views = append(r.views, TransactionView{
+			Level:      int(t.level),
+			VXID:       int64(t.vxid),
+			ParentVXID: int64(t.vxid_parent),
+			Type:       TransactionType(t._type),
+			Reason:     Reason(t.reason),
+		})
+		r.viewBounds = append(r.viewBounds, start, len(r.viewRecs))
+	}
+	if track && r.skipResumed(end, root) {
+		return 0
+	}
+	if len(r.views) == 0 {
+		if track {
+			r.advance(end, root)
+		}
+		return 0
+	}
+	// viewRecs may have moved while growing: slice it once complete
+	for i := range r.views {
+		if start, end := r.viewBounds[2*i], r.viewBounds[2*i+1]; end > start {
+			r.views[i].Records = r.viewRecs[start:end:end]
+		}
+	}
+
+	start := time.Now()
+	err := r.viewHandler(r.views)
+	r.stats.delivered(len(r.views), len(r.viewRecs), time.Since(start))
+	if err != nil {
 		r.handlerErr = err
 		return -1
 	}
+	if track {
+		r.advance(end, root)
+	}
 	return 0
 }
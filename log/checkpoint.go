@@ -0,0 +1,208 @@
+package log
+
+import (
+	"time"
+)
+
+// Checkpoint records how far a [LogReader] got, so that a new reader can
+// carry on from there with [LogReaderBuilder.ResumeFrom]. It's a watermark: the
+// completion time and root VXID of the last group delivered that had a
+// Timestamp record, plus the number of groups without one (sessions with
+// [GroupingVXID], most records with [GroupingRaw]) delivered since.
+//
+// A checkpoint doesn't refer to a VSL segment: when varnishd restarts, VXIDs
+// start over but the new segment only holds transactions that completed after
+// the checkpoint, so the time alone tells them apart.
+//
+// Checkpoints are meant to be saved, e.g. as JSON.
+type Checkpoint struct {
+	Time  time.Time `json:"time"  yaml:"time"`
+	VXID  int64     `json:"vxid"  yaml:"vxid"`
+	After int       `json:"after" yaml:"after"`
+}
+
+// IsZero reports whether cp is the zero Checkpoint, which
+// [LogReaderBuilder.ResumeFrom] ignores.
+func (cp Checkpoint) IsZero() bool {
+	return cp.Time.IsZero() && cp.VXID == 0 && cp.After == 0
+}
+
+// ResumeFrom makes [LogReader.Run] skip the groups that were delivered before
+// cp was taken with [LogReader.Checkpoint], by a reader with the same grouping
+// and query. It implies [LogReaderBuilder.SetBacklog], as the skipped groups
+// are usually still in the log buffer: the reader goes through them until it
+// finds the checkpoint, or a group that completed after it.
+//
+// Delivery is at least once: the records of the checkpoint are located by
+// time, so groups that complete out of order, within the same microsecond or
+// while the reader is restarting may be delivered again. Groups that were
+// overwritten in the log buffer in the meantime are lost, like with
+// [ErrOverrun].
+//
+// ResumeFrom implies [LogReaderBuilder.SetCheckpoints], even with the zero
+// Checkpoint, e.g. on the first start of a log shipper.
+func (b *LogReaderBuilder) ResumeFrom(cp Checkpoint) *LogReaderBuilder {
+	b.checkpoint = true
+	if cp.IsZero() {
+		b.resume = nil
+		return b
+	}
+	b.resume = &cp
+	b.backlog = true
+	return b
+}
+
+// SetCheckpoints makes the reader track its position for
+// [LogReader.Checkpoint]. It's off by default, so that readers that don't use
+// checkpoints don't pay for them.
+func (b *LogReaderBuilder) SetCheckpoints(enable bool) *LogReaderBuilder {
+	b.checkpoint = enable
+	return b
+}
+
+// Checkpoint returns the position after the last group the handler of
+// [LogReader.Run] returned from without error, or the one given to
+// [LogReaderBuilder.ResumeFrom] if no group was delivered yet. Groups left
+// without records by the record filters count as delivered.
+//
+// The position is only tracked with [LogReaderBuilder.SetCheckpoints] or
+// ResumeFrom: otherwise Checkpoint returns the zero Checkpoint.
+//
+// Checkpoint can be called from the handler, or concurrently with Run.
+func (r *LogReader) Checkpoint() Checkpoint {
+	r.cpMu.Lock()
+	defer r.cpMu.Unlock()
+	return r.cp
+}
+
+// resumeState tracks a reader going through the groups that were delivered
+// before the checkpoint given to ResumeFrom.
+type resumeState struct {
+	cp      Checkpoint
+	matched bool // the group of the checkpoint was found
+	left    int  // groups still to skip once matched
+}
+
+func (r *LogReader) resumeFrom(cp Checkpoint) {
+	r.cp = cp
+	// without a time, the checkpoint counts groups from the start
+	r.resume = &resumeState{cp: cp, matched: cp.Time.IsZero(), left: cp.After}
+}
+
+// skipResumed reports whether the group with the given root VXID, completed
+// at end (zero if it has no Timestamp record), was delivered before the
+// checkpoint given to ResumeFrom.
+func (r *LogReader) skipResumed(end time.Time, vxid int64) bool {
+	rs := r.resume
+	if rs == nil {
+		return false
+	}
+	switch {
+	case rs.matched:
+		if rs.left > 0 {
+			rs.left--
+			return true
+		}
+	case end.IsZero():
+		return true
+	case end.Equal(rs.cp.Time) && vxid == rs.cp.VXID:
+		rs.matched, rs.left = true, rs.cp.After
+		return true
+	case !end.After(rs.cp.Time):
+		return true
+	}
+	r.resume = nil
+	return false
+}
+
+// advance moves the checkpoint past a delivered group, see skipResumed.
+func (r *LogReader) advance(end time.Time, vxid int64) {
+	r.cpMu.Lock()
+	defer r.cpMu.Unlock()
+	if end.IsZero() || end.Before(r.cp.Time) {
+		r.cp.After++
+		return
+	}
+	r.cp = Checkpoint{Time: end, VXID: vxid}
+}
+
+// resumable wraps handler with the checkpoint logic, for the transactions
+// assembled by fileGrouper; the CGo callbacks do the same on their own.
+func (r *LogReader) resumable(handler func([]Transaction) error) func([]Transaction) error {
+	return func(txns []Transaction) error {
+		if !r.tracking {
+			return handler(txns)
+		}
+		end := groupEnd(txns)
+		if r.skipResumed(end, txns[0].VXID) {
+			return nil
+		}
+		if err := handler(txns); err != nil {
+			return err
+		}
+		r.advance(end, txns[0].VXID)
+		return nil
+	}
+}
+
+// groupEnd returns the completion time of a group of transactions, the zero
+// time if none has a Timestamp record.
+func groupEnd(txns []Transaction) time.Time {
+	var end time.Time
+	for _, txn := range txns {
+		// like the callbacks, only look at the last Timestamp
+		for i := len(txn.Records) - 1; i >= 0; i-- {
+			if txn.Records[i].Tag == TagTimestamp {
+				end = laterTimestamp(end, txn.Records[i].Data)
+				break
+			}
+		}
+	}
+	return end
+}
+
+// laterTimestamp returns the time of the Timestamp record payload data if it's
+// after t, t otherwise. The last Timestamp record of a transaction gives its
+// completion time.
+//
+// It only decodes the absolute time, as [ParseTimestamp] does but without
+// allocating, so that it can be used on the records of libvarnishapi.
+func laterTimestamp[T string | []byte](t time.Time, data T) time.Time {
+	i := 0
+	for i < len(data) && data[i] != ':' {
+		i++
+	}
+	for i++; i < len(data) && data[i] == ' '; i++ {
+	}
+	var sec, usec int64
+	start := i
+	for ; i < len(data) && '0' <= data[i] && data[i] <= '9'; i++ {
+		sec = sec*10 + int64(data[i]-'0')
+	}
+	if i == start || i-start > 18 {
+		return t
+	}
+	if i < len(data) && data[i] == '.' {
+		// microseconds, rounded like ParseTimestamp
+		n := 0
+		for i++; i < len(data) && '0' <= data[i] && data[i] <= '9'; i++ {
+			switch {
+			case n < 6:
+				usec = usec*10 + int64(data[i]-'0')
+			case n == 6 && data[i] >= '5':
+				usec++
+			}
+			n++
+		}
+		for ; n < 6; n++ {
+			usec *= 10
+		}
+	}
+	if i == len(data) || data[i] != ' ' {
+		return t // not followed by the durations
+	}
+	if abs := time.Unix(sec, usec*1e3); abs.After(t) {
+		return abs
+	}
+	return t
+}
@@ -0,0 +1,117 @@
+package log_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+var errStop = errors.New("stop")
+
+func sameCheckpoint(a, b varnishlog.Checkpoint) bool {
+	return a.Time.Equal(b.Time) && a.VXID == b.VXID && a.After == b.After
+}
+
+// readGroups reads test1_log.bin from cp, stopping after n groups if n isn't
+// negative, and returns the groups and the checkpoint reached.
+func readGroups(t *testing.T, grouping varnishlog.Grouping, cp varnishlog.Checkpoint, n int) ([][]varnishlog.Transaction, varnishlog.Checkpoint) {
+	t.Helper()
+	r, err := varnishlog.New().
+		SetGrouping(grouping).
+		SetFile(testBinPath()).
+		SetPureGo(true).
+		ResumeFrom(cp).
+		Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var groups [][]varnishlog.Transaction
+	err = r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		if len(groups) == n {
+			return errStop
+		}
+		groups = append(groups, txns)
+		return nil
+	})
+	if err != nil && err != errStop {
+		t.Fatalf("Run: %v", err)
+	}
+	return groups, r.Checkpoint()
+}
+
+// TestResumeFrom stops reading test1_log.bin after each group in turn, and
+// verifies that resuming from the checkpoint delivers exactly the rest.
+func TestResumeFrom(t *testing.T) {
+	t.Parallel()
+	for _, grouping := range []varnishlog.Grouping{varnishlog.GroupingRaw, varnishlog.GroupingVXID} {
+		all, _ := readGroups(t, grouping, varnishlog.Checkpoint{}, -1)
+		for n := range len(all) + 1 {
+			head, cp := readGroups(t, grouping, varnishlog.Checkpoint{}, n)
+
+			// checkpoints survive being saved
+			b, err := json.Marshal(cp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved varnishlog.Checkpoint
+			if err := json.Unmarshal(b, &saved); err != nil {
+				t.Fatal(err)
+			}
+
+			tail, end := readGroups(t, grouping, saved, -1)
+			if got := append(head, tail...); !reflect.DeepEqual(got, all) {
+				t.Errorf("grouping %d, stopped after %d groups (%s): got %d groups, want %d", grouping, n, b, len(got), len(all))
+			}
+			if _, last := readGroups(t, grouping, varnishlog.Checkpoint{}, -1); !sameCheckpoint(end, last) && n < len(all) {
+				t.Errorf("grouping %d, stopped after %d groups: final checkpoint %+v, want %+v", grouping, n, end, last)
+			}
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+	groups, cp := readGroups(t, varnishlog.GroupingVXID, varnishlog.Checkpoint{}, 3)
+	// 3 and 2 complete the first request, 1 is its session, which has no
+	// Timestamp record
+	if len(groups) != 3 || cp.VXID != 2 || cp.After != 1 || cp.Time.IsZero() {
+		t.Errorf("got checkpoint %+v after %d groups", cp, len(groups))
+	}
+
+	// resuming from a checkpoint past the end of the file delivers nothing
+	_, end := readGroups(t, varnishlog.GroupingVXID, varnishlog.Checkpoint{}, -1)
+	rest, cp := readGroups(t, varnishlog.GroupingVXID, end, -1)
+	if len(rest) != 0 || !sameCheckpoint(cp, end) {
+		t.Errorf("resuming from the end: got %d groups and checkpoint %+v, want none and %+v", len(rest), cp, end)
+	}
+
+	if !(varnishlog.Checkpoint{}).IsZero() || end.IsZero() {
+		t.Error("IsZero: unexpected result")
+	}
+
+	// the position is only tracked with SetCheckpoints or ResumeFrom
+	for _, enable := range []bool{false, true} {
+		r, err := varnishlog.New().SetFile(testBinPath()).SetPureGo(true).SetCheckpoints(enable).Attach()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cp := r.Checkpoint(); !cp.IsZero() {
+			t.Errorf("SetCheckpoints(%v): got checkpoint %+v before Run", enable, cp)
+		}
+		if err := r.Run(context.Background(), func([]varnishlog.Transaction) error { return nil }); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if cp := r.Checkpoint(); !enable && !cp.IsZero() {
+			t.Errorf("SetCheckpoints(false): got checkpoint %+v", cp)
+		} else if enable && !sameCheckpoint(cp, end) {
+			t.Errorf("SetCheckpoints(true): got checkpoint %+v, want %+v", cp, end)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,603 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timestamp is the decoded payload of a Timestamp record, e.g.
+// "Resp: 1778275576.948458 0.004495 0.000129".
+type Timestamp struct {
+	Label      string        `json:"label"      yaml:"label"`      // event name, e.g. "Start", "Resp", "Beresp"
+	Abs        time.Time     `json:"abs"        yaml:"abs"`        // absolute time of the event
+	SinceStart time.Duration `json:"sinceStart" yaml:"sinceStart"` // time since the start of the transaction
+	SinceLast  time.Duration `json:"sinceLast"  yaml:"sinceLast"`  // time since the previous Timestamp record
+}
+
+// Header is the decoded payload of a header record (ReqHeader, RespUnset, BerespHeader, ...).
+type Header struct {
+	Name  string `json:"name"  yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
+
+// Begin is the decoded payload of a Begin record, e.g. "bereq 2 fetch".
+type Begin struct {
+	Type       TransactionType `json:"type"       yaml:"type"`       // type of the transaction that begins
+	ParentVXID int64           `json:"parentVxid" yaml:"parentVxid"` // VXID of the parent transaction, 0 if none
+	Reason     Reason          `json:"reason"     yaml:"reason"`     // why the transaction was started
+	SubLevel   int             `json:"subLevel"   yaml:"subLevel"`   // ESI nesting level, 0 when not logged
+}
+
+// Link is the decoded payload of a Link record, e.g. "bereq 3 fetch".
+type Link struct {
+	Type     TransactionType `json:"type"     yaml:"type"`     // type of the child transaction
+	VXID     int64           `json:"vxid"     yaml:"vxid"`     // VXID of the child transaction
+	Reason   Reason          `json:"reason"   yaml:"reason"`   // why the child transaction was started
+	SubLevel int             `json:"subLevel" yaml:"subLevel"` // ESI nesting level, 0 when not logged
+}
+
+// Acct is the decoded payload of a ReqAcct or BereqAcct record. Rx and Tx are
+// from Varnish's point of view: for ReqAcct, Rx is what the client sent; for
+// BereqAcct, Rx is what the backend sent.
+type Acct struct {
+	HeaderRx int64 `json:"headerRx" yaml:"headerRx"`
+	BodyRx   int64 `json:"bodyRx"   yaml:"bodyRx"`
+	TotalRx  int64 `json:"totalRx"  yaml:"totalRx"`
+	HeaderTx int64 `json:"headerTx" yaml:"headerTx"`
+	BodyTx   int64 `json:"bodyTx"   yaml:"bodyTx"`
+	TotalTx  int64 `json:"totalTx"  yaml:"totalTx"`
+}
+
+// PipeAcct is the decoded payload of a PipeAcct record.
+type PipeAcct struct {
+	ClientHeaders  int64 `json:"clientHeaders"  yaml:"clientHeaders"`  // client request header bytes
+	BackendHeaders int64 `json:"backendHeaders" yaml:"backendHeaders"` // backend request header bytes
+	PipedIn        int64 `json:"pipedIn"        yaml:"pipedIn"`        // bytes piped from the client
+	PipedOut       int64 `json:"pipedOut"       yaml:"pipedOut"`       // bytes piped to the client
+}
+
+// BackendOpen is the decoded payload of a BackendOpen record, e.g.
+// "31 default 127.0.0.1 8080 127.0.0.1 57220 connect".
+type BackendOpen struct {
+	FD         int    `json:"fd"         yaml:"fd"`
+	Name       string `json:"name"       yaml:"name"` // backend name
+	RemoteAddr string `json:"remoteAddr" yaml:"remoteAddr"`
+	RemotePort string `json:"remotePort" yaml:"remotePort"`
+	LocalAddr  string `json:"localAddr"  yaml:"localAddr"`
+	LocalPort  string `json:"localPort"  yaml:"localPort"`
+	Reason     string `json:"reason"     yaml:"reason"` // "connect" or "reuse"; empty on versions that don't log it
+}
+
+// BackendClose is the decoded payload of a BackendClose record, e.g.
+// "31 default close REQ_HTTP10".
+type BackendClose struct {
+	FD     int    `json:"fd"     yaml:"fd"`
+	Name   string `json:"name"   yaml:"name"`   // backend name
+	Action string `json:"action" yaml:"action"` // "close" or "recycle"
+	Reason string `json:"reason" yaml:"reason"` // close reason, empty when not logged
+}
+
+// SessOpen is the decoded payload of a SessOpen record.
+type SessOpen struct {
+	RemoteAddr string    `json:"remoteAddr" yaml:"remoteAddr"`
+	RemotePort string    `json:"remotePort" yaml:"remotePort"`
+	Listener   string    `json:"listener"   yaml:"listener"` // listen socket name, e.g. "a0"
+	LocalAddr  string    `json:"localAddr"  yaml:"localAddr"`
+	LocalPort  string    `json:"localPort"  yaml:"localPort"`
+	Time       time.Time `json:"time"       yaml:"time"` // when the session was opened
+	FD         int       `json:"fd"         yaml:"fd"`
+}
+
+// SessClose is the decoded payload of a SessClose record, e.g. "REM_CLOSE 0.005".
+type SessClose struct {
+	Reason   string        `json:"reason"   yaml:"reason"`
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+// ReqStart is the decoded payload of a ReqStart record, e.g. "127.0.0.1 55508 a0".
+type ReqStart struct {
+	ClientAddr string `json:"clientAddr" yaml:"clientAddr"`
+	ClientPort string `json:"clientPort" yaml:"clientPort"`
+	Listener   string `json:"listener"   yaml:"listener"` // empty on versions that don't log it
+}
+
+// Hit is the decoded payload of a Hit record. Fetched and ContentLength are
+// only logged for objects still being fetched, and -1 otherwise.
+type Hit struct {
+	VXID          int64         `json:"vxid"          yaml:"vxid"` // VXID of the object
+	TTL           time.Duration `json:"ttl"           yaml:"ttl"`  // remaining TTL
+	Grace         time.Duration `json:"grace"         yaml:"grace"`
+	Keep          time.Duration `json:"keep"          yaml:"keep"`
+	Fetched       int64         `json:"fetched"       yaml:"fetched"`
+	ContentLength int64         `json:"contentLength" yaml:"contentLength"`
+}
+
+// HitMiss is the decoded payload of a HitMiss record.
+type HitMiss struct {
+	VXID int64         `json:"vxid" yaml:"vxid"` // VXID of the hit-for-miss object
+	TTL  time.Duration `json:"ttl"  yaml:"ttl"`  // remaining TTL
+}
+
+// HitPass is the decoded payload of a HitPass record.
+type HitPass struct {
+	VXID int64         `json:"vxid" yaml:"vxid"` // VXID of the hit-for-pass object
+	TTL  time.Duration `json:"ttl"  yaml:"ttl"`  // remaining TTL
+}
+
+// TTL is the decoded payload of a TTL record, e.g.
+// "RFC 120 10 0 1778275577 1778275577 1778275576 0 0 cacheable".
+// Age, Date, Expires and MaxAge are only logged by the "RFC" source and are
+// zero otherwise.
+type TTL struct {
+	Source    string        `json:"source"    yaml:"source"` // "RFC", "VCL", "HFP" or "HFM"
+	TTL       time.Duration `json:"ttl"       yaml:"ttl"`
+	Grace     time.Duration `json:"grace"     yaml:"grace"`
+	Keep      time.Duration `json:"keep"      yaml:"keep"`
+	Reference time.Time     `json:"reference" yaml:"reference"`
+	Age       int64         `json:"age"       yaml:"age"`
+	Date      int64         `json:"date"      yaml:"date"`
+	Expires   int64         `json:"expires"   yaml:"expires"`
+	MaxAge    int64         `json:"maxAge"    yaml:"maxAge"`
+	Cacheable bool          `json:"cacheable" yaml:"cacheable"`
+}
+
+// Storage is the decoded payload of a Storage record, e.g. "malloc s0".
+type Storage struct {
+	Type string `json:"type" yaml:"type"`
+	Name string `json:"name" yaml:"name"`
+}
+
+// Decode parses the record payload according to its tag and returns a typed
+// value: [Timestamp], [Header], [Begin], [Link], [Acct], [PipeAcct],
+// [BackendOpen], [BackendClose], [SessOpen], [SessClose], [ReqStart], [Hit],
+// [HitMiss], [HitPass], [TTL], [Storage], an int for status records and an
+// int64 for Length. Records without a typed decoder return Data unchanged.
+func (r Record) Decode() (any, error) {
+	switch {
+	case r.Tag == 0:
+		return r.Data, nil
+	case r.Tag == TagTimestamp:
+		return ParseTimestamp(r.Data)
+	case r.IsHeader():
+		return ParseHeader(r.Data)
+	case r.Tag == TagBegin:
+		return ParseBegin(r.Data)
+	case r.Tag == TagLink:
+		return ParseLink(r.Data)
+	case r.Tag == TagReqAcct:
+		return ParseReqAcct(r.Data)
+	case r.Tag == TagBereqAcct:
+		return ParseBereqAcct(r.Data)
+	case r.Tag == TagPipeAcct:
+		return ParsePipeAcct(r.Data)
+	case r.Tag == TagBackendOpen:
+		return ParseBackendOpen(r.Data)
+	case r.Tag == TagBackendClose:
+		return ParseBackendClose(r.Data)
+	case r.Tag == TagSessOpen:
+		return ParseSessOpen(r.Data)
+	case r.Tag == TagSessClose:
+		return ParseSessClose(r.Data)
+	case r.Tag == TagReqStart:
+		return ParseReqStart(r.Data)
+	case r.Tag == TagHit:
+		return ParseHit(r.Data)
+	case r.Tag == TagHitMiss:
+		return ParseHitMiss(r.Data)
+	case r.Tag == TagHitPass:
+		return ParseHitPass(r.Data)
+	case r.Tag == TagTTL:
+		return ParseTTL(r.Data)
+	case r.Tag == TagStorage:
+		return ParseStorage(r.Data)
+	case r.Tag == TagLength:
+		return parseInt(r.Tag, r.Data)
+	case r.isStatus():
+		n, err := parseInt(r.Tag, r.Data)
+		return int(n), err
+	default:
+		return r.Data, nil
+	}
+}
+
+// IsHeader reports whether the record carries an HTTP header line, i.e. it is
+// one of the Req, Resp, Bereq, Beresp or Obj Header/Unset tags.
+func (r Record) IsHeader() bool {
+	if r.Tag == 0 {
+		return false
+	}
+	switch r.Tag {
+	case TagReqHeader, TagReqUnset,
+		TagRespHeader, TagRespUnset,
+		TagBereqHeader, TagBereqUnset,
+		TagBerespHeader, TagBerespUnset,
+		TagObjHeader, TagObjUnset:
+		return true
+	}
+	return false
+}
+
+func (r Record) isStatus() bool {
+	switch r.Tag {
+	case TagReqStatus, TagRespStatus, TagBereqStatus, TagBerespStatus, TagObjStatus:
+		return true
+	}
+	return false
+}
+
+// ParseTimestamp decodes a Timestamp record payload.
+func ParseTimestamp(data string) (Timestamp, error) {
+	label, rest, ok := strings.Cut(data, ":")
+	if !ok {
+		return Timestamp{}, fmt.Errorf("parse Timestamp %q: missing label", data)
+	}
+	f := strings.Fields(rest)
+	if len(f) != 3 {
+		return Timestamp{}, fmt.Errorf("parse Timestamp %q: expected 3 fields, got %d", data, len(f))
+	}
+	abs, err1 := parseTime(f[0])
+	start, err2 := parseSeconds(f[1])
+	last, err3 := parseSeconds(f[2])
+	if err := firstErr(err1, err2, err3); err != nil {
+		return Timestamp{}, fmt.Errorf("parse Timestamp %q: %w", data, err)
+	}
+	return Timestamp{Label: label, Abs: abs, SinceStart: start, SinceLast: last}, nil
+}
+
+// ParseHeader decodes a header line ("Name: value"). Leading and trailing
+// whitespace is removed from the value.
+func ParseHeader(data string) (Header, error) {
+	name, value, ok := strings.Cut(data, ":")
+	if !ok || name == "" {
+		return Header{}, fmt.Errorf("parse header %q: missing name", data)
+	}
+	return Header{Name: name, Value: strings.TrimSpace(value)}, nil
+}
+
+// ParseBegin decodes a Begin record payload.
+func ParseBegin(data string) (Begin, error) {
+	t, vxid, r, sub, err := parseLinkFields(data)
+	if err != nil {
+		return Begin{}, fmt.Errorf("parse Begin %q: %w", data, err)
+	}
+	return Begin{Type: t, ParentVXID: vxid, Reason: r, SubLevel: sub}, nil
+}
+
+// ParseLink decodes a Link record payload.
+func ParseLink(data string) (Link, error) {
+	t, vxid, r, sub, err := parseLinkFields(data)
+	if err != nil {
+		return Link{}, fmt.Errorf("parse Link %q: %w", data, err)
+	}
+	return Link{Type: t, VXID: vxid, Reason: r, SubLevel: sub}, nil
+}
+
+// parseLinkFields parses the "type vxid reason [sublevel]" layout shared by
+// Begin and Link records.
+func parseLinkFields(data string) (TransactionType, int64, Reason, int, error) {
+	f := strings.Fields(data)
+	if len(f) != 3 && len(f) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("expected 3 or 4 fields, got %d", len(f))
+	}
+	vxid, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	var sub int
+	if len(f) == 4 {
+		if sub, err = strconv.Atoi(f[3]); err != nil {
+			return 0, 0, 0, 0, err
+		}
+	}
+	return transactionTypeFromVSL(f[0]), vxid, reasonFromVSL(f[2]), sub, nil
+}
+
+// transactionTypeFromVSL maps the type names used in Begin and Link records.
+func transactionTypeFromVSL(s string) TransactionType {
+	switch s {
+	case "sess":
+		return TypeSession
+	case "req":
+		return TypeRequest
+	case "bereq":
+		return TypeBackend
+	case "raw":
+		return TypeRaw
+	default:
+		return TypeUnknown
+	}
+}
+
+// reasonFromVSL maps the reason names used in Begin and Link records.
+func reasonFromVSL(s string) Reason {
+	switch s {
+	case "HTTP/1":
+		return ReasonHTTP1
+	case "rxreq":
+		return ReasonRxReq
+	case "esi":
+		return ReasonESI
+	case "restart":
+		return ReasonRestart
+	case "pass":
+		return ReasonPass
+	case "fetch":
+		return ReasonFetch
+	case "bgfetch":
+		return ReasonBgFetch
+	case "pipe":
+		return ReasonPipe
+	default:
+		return ReasonUnknown
+	}
+}
+
+// ParseReqAcct decodes a ReqAcct record payload
+// ("hdr_rx body_rx total_rx hdr_tx body_tx total_tx").
+func ParseReqAcct(data string) (Acct, error) {
+	n, err := parseInts(data, 6)
+	if err != nil {
+		return Acct{}, fmt.Errorf("parse ReqAcct %q: %w", data, err)
+	}
+	return Acct{
+		HeaderRx: n[0], BodyRx: n[1], TotalRx: n[2],
+		HeaderTx: n[3], BodyTx: n[4], TotalTx: n[5],
+	}, nil
+}
+
+// ParseBereqAcct decodes a BereqAcct record payload
+// ("hdr_tx body_tx total_tx hdr_rx body_rx total_rx").
+func ParseBereqAcct(data string) (Acct, error) {
+	n, err := parseInts(data, 6)
+	if err != nil {
+		return Acct{}, fmt.Errorf("parse BereqAcct %q: %w", data, err)
+	}
+	return Acct{
+		HeaderTx: n[0], BodyTx: n[1], TotalTx: n[2],
+		HeaderRx: n[3], BodyRx: n[4], TotalRx: n[5],
+	}, nil
+}
+
+// ParsePipeAcct decodes a PipeAcct record payload.
+func ParsePipeAcct(data string) (PipeAcct, error) {
+	n, err := parseInts(data, 4)
+	if err != nil {
+		return PipeAcct{}, fmt.Errorf("parse PipeAcct %q: %w", data, err)
+	}
+	return PipeAcct{ClientHeaders: n[0], BackendHeaders: n[1], PipedIn: n[2], PipedOut: n[3]}, nil
+}
+
+// ParseBackendOpen decodes a BackendOpen record payload.
+func ParseBackendOpen(data string) (BackendOpen, error) {
+	f := strings.Fields(data)
+	if len(f) < 6 {
+		return BackendOpen{}, fmt.Errorf("parse BackendOpen %q: expected at least 6 fields, got %d", data, len(f))
+	}
+	fd, err := strconv.Atoi(f[0])
+	if err != nil {
+		return BackendOpen{}, fmt.Errorf("parse BackendOpen %q: %w", data, err)
+	}
+	b := BackendOpen{
+		FD:         fd,
+		Name:       f[1],
+		RemoteAddr: f[2],
+		RemotePort: f[3],
+		LocalAddr:  f[4],
+		LocalPort:  f[5],
+	}
+	if len(f) > 6 {
+		b.Reason = f[6]
+	}
+	return b, nil
+}
+
+// ParseBackendClose decodes a BackendClose record payload.
+func ParseBackendClose(data string) (BackendClose, error) {
+	f := strings.Fields(data)
+	if len(f) < 3 {
+		return BackendClose{}, fmt.Errorf("parse BackendClose %q: expected at least 3 fields, got %d", data, len(f))
+	}
+	fd, err := strconv.Atoi(f[0])
+	if err != nil {
+		return BackendClose{}, fmt.Errorf("parse BackendClose %q: %w", data, err)
+	}
+	b := BackendClose{FD: fd, Name: f[1], Action: f[2]}
+	if len(f) > 3 {
+		b.Reason = f[3]
+	}
+	return b, nil
+}
+
+// ParseSessOpen decodes a SessOpen record payload.
+func ParseSessOpen(data string) (SessOpen, error) {
+	f := strings.Fields(data)
+	if len(f) != 7 {
+		return SessOpen{}, fmt.Errorf("parse SessOpen %q: expected 7 fields, got %d", data, len(f))
+	}
+	ts, err1 := parseTime(f[5])
+	fd, err2 := strconv.Atoi(f[6])
+	if err := firstErr(err1, err2); err != nil {
+		return SessOpen{}, fmt.Errorf("parse SessOpen %q: %w", data, err)
+	}
+	return SessOpen{
+		RemoteAddr: f[0],
+		RemotePort: f[1],
+		Listener:   f[2],
+		LocalAddr:  f[3],
+		LocalPort:  f[4],
+		Time:       ts,
+		FD:         fd,
+	}, nil
+}
+
+// ParseSessClose decodes a SessClose record payload.
+func ParseSessClose(data string) (SessClose, error) {
+	f := strings.Fields(data)
+	if len(f) != 2 {
+		return SessClose{}, fmt.Errorf("parse SessClose %q: expected 2 fields, got %d", data, len(f))
+	}
+	d, err := parseSeconds(f[1])
+	if err != nil {
+		return SessClose{}, fmt.Errorf("parse SessClose %q: %w", data, err)
+	}
+	return SessClose{Reason: f[0], Duration: d}, nil
+}
+
+// ParseReqStart decodes a ReqStart record payload.
+func ParseReqStart(data string) (ReqStart, error) {
+	f := strings.Fields(data)
+	if len(f) != 2 && len(f) != 3 {
+		return ReqStart{}, fmt.Errorf("parse ReqStart %q: expected 2 or 3 fields, got %d", data, len(f))
+	}
+	r := ReqStart{ClientAddr: f[0], ClientPort: f[1]}
+	if len(f) == 3 {
+		r.Listener = f[2]
+	}
+	return r, nil
+}
+
+// ParseHit decodes a Hit record payload.
+func ParseHit(data string) (Hit, error) {
+	f := strings.Fields(data)
+	if len(f) != 4 && len(f) != 6 {
+		return Hit{}, fmt.Errorf("parse Hit %q: expected 4 or 6 fields, got %d", data, len(f))
+	}
+	vxid, err1 := strconv.ParseInt(f[0], 10, 64)
+	ttl, err2 := parseSeconds(f[1])
+	grace, err3 := parseSeconds(f[2])
+	keep, err4 := parseSeconds(f[3])
+	if err := firstErr(err1, err2, err3, err4); err != nil {
+		return Hit{}, fmt.Errorf("parse Hit %q: %w", data, err)
+	}
+	h := Hit{VXID: vxid, TTL: ttl, Grace: grace, Keep: keep, Fetched: -1, ContentLength: -1}
+	if len(f) == 6 {
+		fetched, err1 := strconv.ParseInt(f[4], 10, 64)
+		length, err2 := strconv.ParseInt(f[5], 10, 64)
+		if err := firstErr(err1, err2); err != nil {
+			return Hit{}, fmt.Errorf("parse Hit %q: %w", data, err)
+		}
+		h.Fetched, h.ContentLength = fetched, length
+	}
+	return h, nil
+}
+
+// ParseHitMiss decodes a HitMiss record payload.
+func ParseHitMiss(data string) (HitMiss, error) {
+	vxid, ttl, err := parseVXIDTTL(data)
+	if err != nil {
+		return HitMiss{}, fmt.Errorf("parse HitMiss %q: %w", data, err)
+	}
+	return HitMiss{VXID: vxid, TTL: ttl}, nil
+}
+
+// ParseHitPass decodes a HitPass record payload.
+func ParseHitPass(data string) (HitPass, error) {
+	vxid, ttl, err := parseVXIDTTL(data)
+	if err != nil {
+		return HitPass{}, fmt.Errorf("parse HitPass %q: %w", data, err)
+	}
+	return HitPass{VXID: vxid, TTL: ttl}, nil
+}
+
+func parseVXIDTTL(data string) (int64, time.Duration, error) {
+	f := strings.Fields(data)
+	if len(f) != 2 {
+		return 0, 0, fmt.Errorf("expected 2 fields, got %d", len(f))
+	}
+	vxid, err1 := strconv.ParseInt(f[0], 10, 64)
+	ttl, err2 := parseSeconds(f[1])
+	return vxid, ttl, firstErr(err1, err2)
+}
+
+// ParseTTL decodes a TTL record payload.
+func ParseTTL(data string) (TTL, error) {
+	f := strings.Fields(data)
+	if len(f) < 5 {
+		return TTL{}, fmt.Errorf("parse TTL %q: expected at least 5 fields, got %d", data, len(f))
+	}
+	ttl, err1 := parseSeconds(f[1])
+	grace, err2 := parseSeconds(f[2])
+	keep, err3 := parseSeconds(f[3])
+	ref, err4 := parseTime(f[4])
+	if err := firstErr(err1, err2, err3, err4); err != nil {
+		return TTL{}, fmt.Errorf("parse TTL %q: %w", data, err)
+	}
+	t := TTL{Source: f[0], TTL: ttl, Grace: grace, Keep: keep, Reference: ref}
+	rest := f[5:]
+	if len(rest) > 0 && (rest[len(rest)-1] == "cacheable" || rest[len(rest)-1] == "uncacheable") {
+		t.Cacheable = rest[len(rest)-1] == "cacheable"
+		rest = rest[:len(rest)-1]
+	}
+	if len(rest) == 4 {
+		n, err := parseInts(strings.Join(rest, " "), 4)
+		if err != nil {
+			return TTL{}, fmt.Errorf("parse TTL %q: %w", data, err)
+		}
+		t.Age, t.Date, t.Expires, t.MaxAge = n[0], n[1], n[2], n[3]
+	}
+	return t, nil
+}
+
+// ParseStorage decodes a Storage record payload.
+func ParseStorage(data string) (Storage, error) {
+	f := strings.Fields(data)
+	if len(f) != 2 {
+		return Storage{}, fmt.Errorf("parse Storage %q: expected 2 fields, got %d", data, len(f))
+	}
+	return Storage{Type: f[0], Name: f[1]}, nil
+}
+
+func parseInt(tag Tag, data string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s %q: %w", tag, data, err)
+	}
+	return n, nil
+}
+
+func parseInts(data string, want int) ([]int64, error) {
+	f := strings.Fields(data)
+	if len(f) != want {
+		return nil, fmt.Errorf("expected %d fields, got %d", want, len(f))
+	}
+	n := make([]int64, want)
+	for i, s := range f {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = v
+	}
+	return n, nil
+}
+
+// parseTime converts a VSL "seconds.micros" epoch timestamp.
+func parseTime(s string) (time.Time, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec := math.Floor(f)
+	return time.Unix(int64(sec), int64(math.Round((f-sec)*1e6))*1e3), nil
+}
+
+// parseSeconds converts a VSL duration in (possibly fractional) seconds.
+func parseSeconds(s string) (time.Duration, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(math.Round(f * float64(time.Second))), nil
+}
+
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package log_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	t.Parallel()
+	ts, err := varnishlog.ParseTimestamp("Resp: 1778275576.948458 0.004495 0.000129")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Label != "Resp" {
+		t.Errorf("Label: got %q, want Resp", ts.Label)
+	}
+	if want := time.Unix(1778275576, 948458000); !ts.Abs.Equal(want) {
+		t.Errorf("Abs: got %v, want %v", ts.Abs, want)
+	}
+	if ts.SinceStart != 4495*time.Microsecond {
+		t.Errorf("SinceStart: got %v, want 4.495ms", ts.SinceStart)
+	}
+	if ts.SinceLast != 129*time.Microsecond {
+		t.Errorf("SinceLast: got %v, want 129µs", ts.SinceLast)
+	}
+
+	if _, err := varnishlog.ParseTimestamp("Resp 1778275576.948458"); err == nil {
+		t.Error("expected an error for a malformed Timestamp")
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		data, name, value string
+	}{
+		{"Host: 0.0.0.0:8888", "Host", "0.0.0.0:8888"},
+		{"X-Empty:", "X-Empty", ""},
+		{"Via:   1.1 flamp (Varnish/9.0)  ", "Via", "1.1 flamp (Varnish/9.0)"},
+	} {
+		h, err := varnishlog.ParseHeader(tt.data)
+		if err != nil {
+			t.Errorf("ParseHeader(%q): %v", tt.data, err)
+			continue
+		}
+		if h.Name != tt.name || h.Value != tt.value {
+			t.Errorf("ParseHeader(%q) = %+v, want {%s %s}", tt.data, h, tt.name, tt.value)
+		}
+	}
+	if _, err := varnishlog.ParseHeader("no colon"); err == nil {
+		t.Error("expected an error for a header without a colon")
+	}
+}
+
+func TestParseLinkAndBegin(t *testing.T) {
+	t.Parallel()
+	l, err := varnishlog.ParseLink("req 32772 restart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != (varnishlog.Link{Type: varnishlog.TypeRequest, VXID: 32772, Reason: varnishlog.ReasonRestart}) {
+		t.Errorf("ParseLink: got %+v", l)
+	}
+
+	l, err = varnishlog.ParseLink("req 1234 esi 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Reason != varnishlog.ReasonESI || l.SubLevel != 2 {
+		t.Errorf("ParseLink with sub-level: got %+v", l)
+	}
+
+	b, err := varnishlog.ParseBegin("sess 0 HTTP/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != (varnishlog.Begin{Type: varnishlog.TypeSession, Reason: varnishlog.ReasonHTTP1}) {
+		t.Errorf("ParseBegin: got %+v", b)
+	}
+
+	if _, err := varnishlog.ParseLink("bereq fetch"); err == nil {
+		t.Error("expected an error for a Link with missing fields")
+	}
+}
+
+func TestParseAcct(t *testing.T) {
+	t.Parallel()
+	a, err := varnishlog.ParseReqAcct("76 0 76 224 2965 3189")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (varnishlog.Acct{HeaderRx: 76, TotalRx: 76, HeaderTx: 224, BodyTx: 2965, TotalTx: 3189}); a != want {
+		t.Errorf("ParseReqAcct: got %+v, want %+v", a, want)
+	}
+
+	a, err = varnishlog.ParseBereqAcct("171 0 171 156 2965 3121")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (varnishlog.Acct{HeaderTx: 171, TotalTx: 171, HeaderRx: 156, BodyRx: 2965, TotalRx: 3121}); a != want {
+		t.Errorf("ParseBereqAcct: got %+v, want %+v", a, want)
+	}
+}
+
+func TestParseBackendOpen(t *testing.T) {
+	t.Parallel()
+	b, err := varnishlog.ParseBackendOpen("31 default 127.0.0.1 8080 127.0.0.1 57220 connect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := varnishlog.BackendOpen{
+		FD: 31, Name: "default",
+		RemoteAddr: "127.0.0.1", RemotePort: "8080",
+		LocalAddr: "127.0.0.1", LocalPort: "57220",
+		Reason: "connect",
+	}
+	if b != want {
+		t.Errorf("ParseBackendOpen: got %+v, want %+v", b, want)
+	}
+}
+
+func TestParseHit(t *testing.T) {
+	t.Parallel()
+	h, err := varnishlog.ParseHit("32770 119.998 10.000 0.000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.VXID != 32770 || h.TTL != 119998*time.Millisecond || h.Grace != 10*time.Second || h.Fetched != -1 {
+		t.Errorf("ParseHit: got %+v", h)
+	}
+
+	h, err = varnishlog.ParseHit("32770 119.998 10.000 0.000 1024 4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Fetched != 1024 || h.ContentLength != 4096 {
+		t.Errorf("ParseHit with fetch progress: got %+v", h)
+	}
+
+	hp, err := varnishlog.ParseHitPass("5 119.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hp.VXID != 5 || hp.TTL != 119500*time.Millisecond {
+		t.Errorf("ParseHitPass: got %+v", hp)
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	t.Parallel()
+	ttl, err := varnishlog.ParseTTL("RFC 120 10 0 1778275577 1778275577 1778275576 0 0 cacheable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl.Source != "RFC" || ttl.TTL != 120*time.Second || ttl.Grace != 10*time.Second || !ttl.Cacheable {
+		t.Errorf("ParseTTL: got %+v", ttl)
+	}
+	if ttl.Date != 1778275576 {
+		t.Errorf("ParseTTL Date: got %d, want 1778275576", ttl.Date)
+	}
+
+	ttl, err = varnishlog.ParseTTL("VCL 3600 10 0 1778275577 uncacheable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl.Source != "VCL" || ttl.TTL != time.Hour || ttl.Cacheable {
+		t.Errorf("ParseTTL VCL: got %+v", ttl)
+	}
+}
+
+// TestDecodeFile decodes every record of test1_log.bin and checks the typed
+// values of a few well-known records.
+func TestDecodeFile(t *testing.T) {
+	t.Parallel()
+	r := newFileReader(t, varnishlog.GroupingVXID)
+
+	var (
+		timestamps int
+		headers    int
+		links      []varnishlog.Link
+		acct       []varnishlog.Acct
+		open       []varnishlog.BackendOpen
+	)
+	err := r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		for _, txn := range txns {
+			for _, rec := range txn.Records {
+				v, err := rec.Decode()
+				if err != nil {
+					t.Errorf("vxid %d: %s: %v", txn.VXID, rec.Tag, err)
+					continue
+				}
+				switch v := v.(type) {
+				case varnishlog.Timestamp:
+					timestamps++
+				case varnishlog.Header:
+					headers++
+				case varnishlog.Link:
+					links = append(links, v)
+				case varnishlog.Acct:
+					if rec.Tag == varnishlog.TagReqAcct {
+						acct = append(acct, v)
+					}
+				case varnishlog.BackendOpen:
+					open = append(open, v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if timestamps == 0 || headers == 0 {
+		t.Errorf("expected Timestamp and header records, got %d and %d", timestamps, headers)
+	}
+	// sess 1 → req 2, req 2 → bereq 3, sess 32769 → req 32770,
+	// req 32770 → bereq 32771 and req 32772, req 32772 → bereq 32773.
+	if len(links) != 6 {
+		t.Errorf("expected 6 Link records, got %d", len(links))
+	}
+	if len(acct) != 2 || acct[0].BodyTx != 2965 {
+		t.Errorf("expected the first ReqAcct to report a 2965 byte body, got %+v", acct)
+	}
+	for _, o := range open {
+		if o.Name != "default" {
+			t.Errorf("expected BackendOpen on backend default, got %q", o.Name)
+		}
+	}
+	if len(open) != 3 {
+		t.Errorf("expected 3 BackendOpen records, got %d", len(open))
+	}
+}
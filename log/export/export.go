@@ -0,0 +1,232 @@
+// Export VSL transactions as JSON documents and OpenTelemetry spans
+package export
+
+// Both exports work on groups of transactions, as delivered by
+// [log.LogReader.Run] with [log.GroupingRequest] or [log.GroupingSession]:
+// [Documents] turns each client request into one self-contained [Document],
+// and [Spans] turns every transaction into an OTLP-shaped [Span], linked to
+// its parent. [NDJSONHandler] and [OTLPHandler] wrap them into handlers that
+// write to an [io.Writer].
+//
+// # Usage
+//
+//	r, err := varnishlog.New().
+//	    SetName("/tmp/my-varnish").
+//	    SetGrouping(varnishlog.GroupingRequest).
+//	    Attach()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer r.Close()
+//
+//	err = r.Run(ctx, export.NDJSONHandler(os.Stdout))
+//
+// Transactions collected with [log.GroupingVXID] can be exported too, as
+// long as all the transactions of a request are passed together.
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// Document describes a client request and everything Varnish did to serve it.
+// A request that restarted is described by the transaction that finally
+// responded, like [log.Tree.Summarize] does.
+type Document struct {
+	VXID       int64        `json:"vxid"`
+	Reason     log.Reason   `json:"reason"`
+	Start      time.Time    `json:"start"`
+	ClientAddr string       `json:"clientAddr,omitempty"`
+	Method     string       `json:"method,omitempty"`
+	URL        string       `json:"url,omitempty"`
+	Protocol   string       `json:"protocol,omitempty"`
+	Status     int          `json:"status,omitempty"`
+	Handling   log.Handling `json:"handling"`
+	Restarts   int          `json:"restarts,omitempty"`
+
+	// TTFB and Duration are in seconds, Timings gives the time of each
+	// Timestamp record (by label) in seconds since Start.
+	TTFB     float64            `json:"ttfb"`
+	Duration float64            `json:"duration"`
+	Timings  map[string]float64 `json:"timings,omitempty"`
+	Bytes    log.Acct           `json:"bytes"`
+
+	RequestHeaders  Headers `json:"requestHeaders,omitempty"`
+	ResponseHeaders Headers `json:"responseHeaders,omitempty"`
+
+	// Backend is the fetch that produced the response, nil for hits and
+	// synthetic responses.
+	Backend *BackendDocument `json:"backend,omitempty"`
+	// ESI are the documents of the ESI subrequests, in inclusion order.
+	ESI []Document `json:"esi,omitempty"`
+}
+
+// BackendDocument describes a backend request.
+type BackendDocument struct {
+	VXID       int64      `json:"vxid"`
+	Reason     log.Reason `json:"reason"`
+	Start      time.Time  `json:"start"`
+	Name       string     `json:"name,omitempty"`    // backend name
+	Address    string     `json:"address,omitempty"` // backend address and port
+	Method     string     `json:"method,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	Protocol   string     `json:"protocol,omitempty"`
+	Status     int        `json:"status,omitempty"`
+	FetchError string     `json:"fetchError,omitempty"`
+
+	TTFB     float64            `json:"ttfb"`
+	Duration float64            `json:"duration"`
+	Timings  map[string]float64 `json:"timings,omitempty"`
+	Bytes    log.Acct           `json:"bytes"`
+
+	RequestHeaders  Headers `json:"requestHeaders,omitempty"`
+	ResponseHeaders Headers `json:"responseHeaders,omitempty"`
+}
+
+// Headers maps lowercased header names to their values, in the state VCL
+// left them: headers unset by VCL are removed.
+type Headers map[string][]string
+
+// Documents returns one [Document] per client request in txns, in the order of
+// [log.Tree.Walk]. ESI subrequests are nested in their parent's document.
+func Documents(txns []log.Transaction) []Document {
+	tree := log.NewTree(txns)
+	var docs []Document
+	tree.Walk(func(n *log.Node) bool {
+		if n.Type != log.TypeRequest {
+			return true
+		}
+		docs = append(docs, document(tree, n))
+		return false
+	})
+	return docs
+}
+
+// NDJSONHandler returns a handler for [log.LogReader.Run] that writes the
+// [Documents] of each group to w, one JSON object per line.
+func NDJSONHandler(w io.Writer) func([]log.Transaction) error {
+	enc := json.NewEncoder(w)
+	return func(txns []log.Transaction) error {
+		for _, doc := range Documents(txns) {
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func document(tree *log.Tree, n *log.Node) Document {
+	final, restarts := n, 0
+	for next := final.Restart(); next != nil; next = final.Restart() {
+		final = next
+		restarts++
+	}
+
+	s := log.Summarize(final.Transaction)
+	doc := Document{
+		VXID:       s.VXID,
+		Reason:     s.Reason,
+		Start:      s.Start,
+		ClientAddr: s.ClientAddr,
+		Method:     s.Method,
+		URL:        s.URL,
+		Protocol:   s.Protocol,
+		Status:     s.Status,
+		Handling:   s.Handling,
+		Restarts:   restarts,
+		TTFB:       s.TTFB.Seconds(),
+		Duration:   s.Duration.Seconds(),
+		Timings:    timings(final.Transaction),
+		Bytes:      s.Acct,
+	}
+	h := log.ReplayHeaders(final.Transaction)
+	doc.RequestHeaders, doc.ResponseHeaders = headers(h.Req), headers(h.Resp)
+
+	switch s.Handling {
+	case log.HandlingMiss, log.HandlingHitMiss, log.HandlingPass, log.HandlingHitPass, log.HandlingPipe:
+		if be := tree.Node(s.FetchVXID); be != nil && be.Type == log.TypeBackend {
+			doc.Backend = backendDocument(be.Transaction)
+		}
+	}
+	for _, c := range final.Children {
+		if c.Type == log.TypeRequest && c.StartReason() == log.ReasonESI {
+			doc.ESI = append(doc.ESI, document(tree, c))
+		}
+	}
+	return doc
+}
+
+func backendDocument(txn log.Transaction) *BackendDocument {
+	s := log.SummarizeBackend(txn)
+	doc := &BackendDocument{
+		VXID:       s.VXID,
+		Reason:     s.Reason,
+		Start:      s.Start,
+		Name:       s.Backend,
+		Method:     s.Method,
+		URL:        s.URL,
+		Protocol:   s.Protocol,
+		Status:     s.Status,
+		FetchError: s.FetchError,
+		TTFB:       s.TTFB.Seconds(),
+		Duration:   s.Duration.Seconds(),
+		Timings:    timings(txn),
+		Bytes:      s.Acct,
+	}
+	if bo, ok := backendOpen(txn); ok {
+		doc.Address = net.JoinHostPort(bo.RemoteAddr, bo.RemotePort)
+	}
+	h := log.ReplayHeaders(txn)
+	doc.RequestHeaders, doc.ResponseHeaders = headers(h.Bereq), headers(h.Beresp)
+	return doc
+}
+
+// timings returns the Timestamp records of txn, by label, in seconds since
+// the start of the request.
+func timings(txn log.Transaction) map[string]float64 {
+	var m map[string]float64
+	for _, rec := range txn.Records {
+		if rec.Tag != log.TagTimestamp {
+			continue
+		}
+		ts, err := log.ParseTimestamp(rec.Data)
+		if err != nil {
+			continue
+		}
+		if m == nil {
+			m = map[string]float64{}
+		}
+		m[ts.Label] = ts.SinceStart.Seconds()
+	}
+	return m
+}
+
+// headers converts headers replayed by [log.ReplayHeaders].
+func headers(h http.Header) Headers {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(Headers, len(h))
+	for name, values := range h {
+		out[strings.ToLower(name)] = values
+	}
+	return out
+}
+
+func backendOpen(txn log.Transaction) (log.BackendOpen, bool) {
+	for _, rec := range txn.Records {
+		if rec.Tag == log.TagBackendOpen {
+			if bo, err := log.ParseBackendOpen(rec.Data); err == nil {
+				return bo, true
+			}
+		}
+	}
+	return log.BackendOpen{}, false
+}
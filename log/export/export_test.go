@@ -0,0 +1,236 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+	"github.com/varnish/varnish-go/log/export"
+	"github.com/varnish/varnish-go/version"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// readFile returns every transaction of test1_log.bin, read with VXID grouping.
+func readFile(t *testing.T) []varnishlog.Transaction {
+	t.Helper()
+	r, err := varnishlog.New().
+		SetGrouping(varnishlog.GroupingVXID).
+		SetFile(filepath.Join("..", "testdata", "test1_log.bin")).
+		SetPureGo(true).
+		Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var all []varnishlog.Transaction
+	err = r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		all = append(all, txns...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return all
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: output mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	t.Parallel()
+	txns := readFile(t)
+
+	var buf bytes.Buffer
+	if err := export.NDJSONHandler(&buf)(txns); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "documents", buf.String())
+
+	buf.Reset()
+	if err := export.OTLPHandler(&buf, "varnish")(txns); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "spans", buf.String())
+}
+
+// TestRequestGrouping verifies that exporting the groups delivered by
+// libvarnishapi with request grouping gives the same documents.
+func TestRequestGrouping(t *testing.T) {
+	t.Parallel()
+	if version.IsEnterprise() {
+		t.Skip("test1_log.bin not compatible with Varnish Plus")
+	}
+	r, err := varnishlog.New().
+		SetGrouping(varnishlog.GroupingRequest).
+		SetFile(filepath.Join("..", "testdata", "test1_log.bin")).
+		Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if err := r.Run(context.Background(), export.NDJSONHandler(&buf)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	checkGolden(t, "documents", buf.String())
+}
+
+func rec(tag varnishlog.Tag, data string) varnishlog.Record {
+	return varnishlog.Record{Tag: tag, Data: data}
+}
+
+func txn(vxid, parent int64, typ varnishlog.TransactionType, reason varnishlog.Reason, recs ...varnishlog.Record) varnishlog.Transaction {
+	return varnishlog.Transaction{VXID: vxid, ParentVXID: parent, Type: typ, Reason: reason, Records: recs}
+}
+
+// esiTxns is a request (10) that restarts into 11, which includes ESI 12,
+// fetched from the backend by bereq 13.
+func esiTxns() []varnishlog.Transaction {
+	return []varnishlog.Transaction{
+		txn(10, 0, varnishlog.TypeRequest, varnishlog.ReasonRxReq,
+			rec(varnishlog.TagTimestamp, "Start: 1700000000.000000 0.000000 0.000000"),
+			rec(varnishlog.TagReqMethod, "GET"),
+			rec(varnishlog.TagReqURL, "/page?lang=en"),
+			rec(varnishlog.TagReqHeader, "traceparent: 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"),
+			rec(varnishlog.TagVCLReturn, "restart"),
+			rec(varnishlog.TagLink, "req 11 restart"),
+			rec(varnishlog.TagTimestamp, "Restart: 1700000000.001000 0.001000 0.001000"),
+		),
+		txn(11, 10, varnishlog.TypeRequest, varnishlog.ReasonRestart,
+			rec(varnishlog.TagTimestamp, "Start: 1700000000.001000 0.001000 0.000000"),
+			rec(varnishlog.TagReqMethod, "GET"),
+			rec(varnishlog.TagReqURL, "/page?lang=en"),
+			rec(varnishlog.TagReqHeader, "X-Debug: 1"),
+			rec(varnishlog.TagReqHeader, "Accept: text/html"),
+			rec(varnishlog.TagReqUnset, "X-Debug: 1"),
+			rec(varnishlog.TagVCLCall, "HIT"),
+			rec(varnishlog.TagRespStatus, "200"),
+			rec(varnishlog.TagRespHeader, "Set-Cookie: a=1"),
+			rec(varnishlog.TagRespHeader, "Set-Cookie: b=2"),
+			rec(varnishlog.TagLink, "req 12 esi 1"),
+			rec(varnishlog.TagTimestamp, "Resp: 1700000000.010000 0.010000 0.009000"),
+		),
+		txn(12, 11, varnishlog.TypeRequest, varnishlog.ReasonESI,
+			rec(varnishlog.TagTimestamp, "Start: 1700000000.002000 0.002000 0.000000"),
+			rec(varnishlog.TagReqURL, "/fragment"),
+			rec(varnishlog.TagVCLCall, "MISS"),
+			rec(varnishlog.TagLink, "bereq 13 fetch"),
+			rec(varnishlog.TagRespStatus, "503"),
+			rec(varnishlog.TagTimestamp, "Resp: 1700000000.008000 0.008000 0.006000"),
+		),
+		txn(13, 12, varnishlog.TypeBackend, varnishlog.ReasonFetch,
+			rec(varnishlog.TagTimestamp, "Start: 1700000000.003000 0.000000 0.000000"),
+			rec(varnishlog.TagBereqURL, "/fragment"),
+			rec(varnishlog.TagBackendOpen, "31 api 10.0.0.1 8080 10.0.0.2 4242 connect"),
+			rec(varnishlog.TagFetchError, "backend write error: 0 (Success)"),
+			rec(varnishlog.TagTimestamp, "Beresp: 1700000000.007000 0.004000 0.004000"),
+		),
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	t.Parallel()
+	docs := export.Documents(esiTxns())
+	if len(docs) != 1 {
+		t.Fatalf("expected 1 document, got %+v", docs)
+	}
+	d := docs[0]
+	if d.VXID != 11 || d.Restarts != 1 || d.Status != 200 || d.Handling != varnishlog.HandlingHit || d.Backend != nil {
+		t.Errorf("restarted request: got %+v", d)
+	}
+	wantReq := export.Headers{"accept": {"text/html"}}
+	if !reflect.DeepEqual(d.RequestHeaders, wantReq) {
+		t.Errorf("request headers: got %v, want %v", d.RequestHeaders, wantReq)
+	}
+	wantResp := export.Headers{"set-cookie": {"a=1", "b=2"}}
+	if !reflect.DeepEqual(d.ResponseHeaders, wantResp) {
+		t.Errorf("response headers: got %v, want %v", d.ResponseHeaders, wantResp)
+	}
+
+	if len(d.ESI) != 1 {
+		t.Fatalf("expected 1 ESI document, got %+v", d.ESI)
+	}
+	esi := d.ESI[0]
+	if esi.VXID != 12 || esi.Reason != varnishlog.ReasonESI || esi.Handling != varnishlog.HandlingMiss || esi.Backend == nil {
+		t.Fatalf("ESI request: got %+v", esi)
+	}
+	if b := esi.Backend; b.VXID != 13 || b.Name != "api" || b.Address != "10.0.0.1:8080" || b.FetchError == "" || b.Timings["Beresp"] != 0.004 {
+		t.Errorf("ESI backend: got %+v", b)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	t.Parallel()
+	spans := export.Spans(esiTxns())
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %+v", spans)
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, s := range spans {
+		if s.TraceID != traceID {
+			t.Errorf("span %s: trace ID %s, want the one of the traceparent header", s.SpanID, s.TraceID)
+		}
+	}
+	kinds := []export.SpanKind{export.SpanKindServer, export.SpanKindInternal, export.SpanKindInternal, export.SpanKindClient}
+	for i, s := range spans {
+		if s.Kind != kinds[i] {
+			t.Errorf("span %d: kind %d, want %d", i, s.Kind, kinds[i])
+		}
+	}
+	if spans[0].ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("root span: parent %q, want the traceparent span", spans[0].ParentSpanID)
+	}
+	for i := 1; i < len(spans); i++ {
+		if spans[i].ParentSpanID != spans[i-1].SpanID {
+			t.Errorf("span %d: parent %s, want %s", i, spans[i].ParentSpanID, spans[i-1].SpanID)
+		}
+	}
+	if got, want := spans[0].StartTimeUnixNano, uint64(1700000000000000000); got != want {
+		t.Errorf("root span: start %d, want %d", got, want)
+	}
+	if s := spans[3]; s.Status.Code != export.StatusError || s.Status.Message == "" {
+		t.Errorf("backend span: status %+v, want the fetch error", s.Status)
+	}
+
+	// the same transactions give the same IDs
+	if again := export.Spans(esiTxns()); !reflect.DeepEqual(again, spans) {
+		t.Errorf("spans differ between exports:\ngot:  %+v\nwant: %+v", again, spans)
+	}
+}
+
+func TestKeyValueJSON(t *testing.T) {
+	t.Parallel()
+	b, err := json.Marshal([]export.KeyValue{{Key: "a", Value: int64(200)}, {Key: "b", Value: "GET"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"key":"a","value":{"intValue":"200"}},{"key":"b","value":{"stringValue":"GET"}}]`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
@@ -0,0 +1,323 @@
+package export
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// SpanKind is the OTLP span kind.
+type SpanKind int
+
+const (
+	SpanKindUnspecified SpanKind = 0
+	SpanKindInternal    SpanKind = 1 // ESI subrequests and restarts
+	SpanKindServer      SpanKind = 2 // client requests
+	SpanKindClient      SpanKind = 3 // backend requests
+)
+
+// StatusCode is the OTLP span status code.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Status is the status of a span.
+type Status struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// KeyValue is a span attribute. Value is a string or an int64.
+type KeyValue struct {
+	Key   string
+	Value any
+}
+
+// MarshalJSON encodes the attribute the way OTLP/JSON does, e.g.
+// {"key":"http.response.status_code","value":{"intValue":"200"}}.
+// Implements [json.Marshaler].
+func (kv KeyValue) MarshalJSON() ([]byte, error) {
+	var v any
+	switch x := kv.Value.(type) {
+	case int64:
+		v = struct {
+			IntValue string `json:"intValue"`
+		}{strconv.FormatInt(x, 10)}
+	default:
+		v = struct {
+			StringValue string `json:"stringValue"`
+		}{toString(x)}
+	}
+	return json.Marshal(struct {
+		Key   string `json:"key"`
+		Value any    `json:"value"`
+	}{kv.Key, v})
+}
+
+func toString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// Span is a transaction rendered as an OTLP span, with the field names and
+// encoding of OTLP/JSON: IDs are hex strings, times are nanoseconds since the
+// Unix epoch.
+type Span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano,string"`
+	EndTimeUnixNano   uint64     `json:"endTimeUnixNano,string"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+// Spans returns a span for each request and backend transaction in txns, in
+// [log.Tree.Walk] order. Each client request found in txns starts a trace:
+// its span is a server span, and the backend fetches, ESI subrequests and
+// restarts it leads to are child spans.
+//
+// If the request carries a W3C traceparent header, the trace continues it:
+// the trace ID is reused and the request span is a child of the caller's span.
+// Otherwise the trace ID is derived from the start time and VXID of the
+// request. Span IDs are derived from the trace ID and the VXIDs, so exporting
+// the same transactions twice gives the same IDs.
+//
+// A span starts at the first Timestamp record of its transaction and ends at
+// the last one.
+func Spans(txns []log.Transaction) []Span {
+	tree := log.NewTree(txns)
+	var spans []Span
+	tree.Walk(func(n *log.Node) bool {
+		if n.Type != log.TypeRequest {
+			return true
+		}
+		traceID, parentID := traceContext(n.Transaction)
+		var walk func(n *log.Node, parentID string)
+		walk = func(n *log.Node, parentID string) {
+			if n.Type != log.TypeRequest && n.Type != log.TypeBackend {
+				return
+			}
+			s := span(n, traceID, parentID)
+			spans = append(spans, s)
+			for _, c := range n.Children {
+				walk(c, s.SpanID)
+			}
+		}
+		walk(n, parentID)
+		return false
+	})
+	return spans
+}
+
+// OTLPHandler returns a handler for [log.LogReader.Run] that writes the
+// [Spans] of each group to w as an OTLP/JSON ExportTraceServiceRequest, one
+// per line. service is used as the service.name resource attribute.
+func OTLPHandler(w io.Writer, service string) func([]log.Transaction) error {
+	enc := json.NewEncoder(w)
+	type scope struct {
+		Name string `json:"name"`
+	}
+	type scopeSpans struct {
+		Scope scope  `json:"scope"`
+		Spans []Span `json:"spans"`
+	}
+	type resource struct {
+		Attributes []KeyValue `json:"attributes"`
+	}
+	type resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	res := resource{Attributes: []KeyValue{{"service.name", service}}}
+	return func(txns []log.Transaction) error {
+		spans := Spans(txns)
+		if len(spans) == 0 {
+			return nil
+		}
+		return enc.Encode(struct {
+			ResourceSpans []resourceSpans `json:"resourceSpans"`
+		}{[]resourceSpans{{
+			Resource: res,
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/varnish/varnish-go/log/export"},
+				Spans: spans,
+			}},
+		}}})
+	}
+}
+
+// traceContext returns the trace ID of the request and the span ID of its
+// remote parent, from its traceparent header if it's valid.
+func traceContext(txn log.Transaction) (traceID, parentID string) {
+	for _, rec := range txn.Records {
+		if rec.Tag != log.TagReqHeader {
+			continue
+		}
+		h, err := log.ParseHeader(rec.Data)
+		if err != nil || !strings.EqualFold(h.Name, "traceparent") {
+			continue
+		}
+		// version-traceid-parentid-flags, see https://www.w3.org/TR/trace-context/
+		parts := strings.Split(strings.TrimSpace(h.Value), "-")
+		if len(parts) == 4 && len(parts[0]) == 2 && isHexID(parts[1], 32) && isHexID(parts[2], 16) {
+			return strings.ToLower(parts[1]), strings.ToLower(parts[2])
+		}
+		break
+	}
+	start, _ := startEnd(txn)
+	h := fnv.New128a()
+	binary.Write(h, binary.BigEndian, [2]int64{start.UnixNano(), txn.VXID}) //nolint:errcheck // can't fail
+	return hex.EncodeToString(h.Sum(nil)), ""
+}
+
+// isHexID reports whether s is a valid, non-zero, lowercase or uppercase hex ID of n digits.
+func isHexID(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func spanID(traceID string, vxid int64) string {
+	h := fnv.New64a()
+	h.Write([]byte(traceID))
+	binary.Write(h, binary.BigEndian, vxid) //nolint:errcheck // can't fail
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func span(n *log.Node, traceID, parentID string) Span {
+	start, end := startEnd(n.Transaction)
+	s := Span{
+		TraceID:           traceID,
+		SpanID:            spanID(traceID, n.VXID),
+		ParentSpanID:      parentID,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(end),
+	}
+	reason := n.StartReason()
+	if n.Parent == nil {
+		reason = n.Reason
+	}
+	attrs := []KeyValue{
+		{"varnish.vxid", n.VXID},
+		{"varnish.reason", reason.String()},
+	}
+
+	if n.Type == log.TypeBackend {
+		b := log.SummarizeBackend(n.Transaction)
+		s.Name, s.Kind = spanName(b.Method), SpanKindClient
+		attrs = append(attrs, httpAttributes(b.Method, b.URL, b.Protocol, b.Status)...)
+		if b.Backend != "" {
+			attrs = append(attrs, KeyValue{"varnish.backend.name", b.Backend})
+		}
+		if bo, ok := backendOpen(n.Transaction); ok {
+			attrs = append(attrs, KeyValue{"server.address", bo.RemoteAddr})
+			if port, err := strconv.ParseInt(bo.RemotePort, 10, 64); err == nil {
+				attrs = append(attrs, KeyValue{"server.port", port})
+			}
+		}
+		attrs = append(attrs, KeyValue{"http.response.body.size", b.Acct.BodyRx})
+		switch {
+		case b.FetchError != "":
+			s.Status = Status{Code: StatusError, Message: b.FetchError}
+		case b.Status >= 400:
+			s.Status = Status{Code: StatusError}
+		}
+		s.Attributes = attrs
+		return s
+	}
+
+	r := log.Summarize(n.Transaction)
+	s.Name, s.Kind = spanName(r.Method), SpanKindInternal
+	if n.Parent == nil || n.Parent.Type == log.TypeSession {
+		s.Kind = SpanKindServer
+	}
+	attrs = append(attrs, httpAttributes(r.Method, r.URL, r.Protocol, r.Status)...)
+	if r.ClientAddr != "" {
+		attrs = append(attrs, KeyValue{"client.address", r.ClientAddr})
+	}
+	attrs = append(attrs,
+		KeyValue{"varnish.handling", r.Handling.String()},
+		KeyValue{"http.response.body.size", r.Acct.BodyTx},
+	)
+	if r.Restarted {
+		attrs = append(attrs, KeyValue{"varnish.restarted", "true"})
+	}
+	if r.Status >= 500 {
+		s.Status = Status{Code: StatusError}
+	}
+	s.Attributes = attrs
+	return s
+}
+
+// httpAttributes returns the HTTP semantic convention attributes of a request.
+func httpAttributes(method, rawURL, proto string, status int) []KeyValue {
+	var attrs []KeyValue
+	if method != "" {
+		attrs = append(attrs, KeyValue{"http.request.method", method})
+	}
+	if rawURL != "" {
+		path, query, _ := strings.Cut(rawURL, "?")
+		attrs = append(attrs, KeyValue{"url.path", path})
+		if query != "" {
+			attrs = append(attrs, KeyValue{"url.query", query})
+		}
+	}
+	if v, ok := strings.CutPrefix(proto, "HTTP/"); ok {
+		attrs = append(attrs, KeyValue{"network.protocol.version", v})
+	}
+	if status != 0 {
+		attrs = append(attrs, KeyValue{"http.response.status_code", int64(status)})
+	}
+	return attrs
+}
+
+func spanName(method string) string {
+	if method == "" {
+		return "HTTP"
+	}
+	return method
+}
+
+// startEnd returns the times of the first and last Timestamp records of txn.
+func startEnd(txn log.Transaction) (start, end time.Time) {
+	for _, rec := range txn.Records {
+		if rec.Tag != log.TagTimestamp {
+			continue
+		}
+		ts, err := log.ParseTimestamp(rec.Data)
+		if err != nil {
+			continue
+		}
+		if start.IsZero() {
+			start = ts.Abs
+		}
+		end = ts.Abs
+	}
+	return start, end
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
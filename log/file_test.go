@@ -3,6 +3,7 @@ package log_test
 import (
 	"context"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"testing"
 	"time"
@@ -177,3 +178,62 @@ func TestFileQueryFilter(t *testing.T) {
 		t.Error("expected ReqURL /unknown to be filtered out")
 	}
 }
+
+// collect reads every transaction delivered by r.
+func collect(t *testing.T, r *varnishlog.LogReader) []varnishlog.Transaction {
+	t.Helper()
+	var all []varnishlog.Transaction
+	err := r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		all = append(all, txns...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return all
+}
+
+// TestFilePureGoParity reads test1_log.bin through libvarnishapi and through
+// the pure-Go decoder, and verifies both deliver the exact same transactions.
+func TestFilePureGoParity(t *testing.T) {
+	t.Parallel()
+	for _, grouping := range []varnishlog.Grouping{varnishlog.GroupingRaw, varnishlog.GroupingVXID} {
+		want := collect(t, newFileReader(t, grouping))
+
+		r, err := varnishlog.New().
+			SetGrouping(grouping).
+			SetFile(testBinPath()).
+			SetPureGo(true).
+			Attach()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := collect(t, r)
+		r.Close()
+
+		if len(got) != len(want) {
+			t.Fatalf("grouping %d: got %d transactions, want %d", grouping, len(got), len(want))
+		}
+		for i := range want {
+			if !reflect.DeepEqual(got[i], want[i]) {
+				t.Errorf("grouping %d: transaction %d differs:\ngot:  %+v\nwant: %+v", grouping, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+// TestFilePureGoUnsupported verifies that Attach rejects the settings the
+// pure-Go decoder can't honour.
+func TestFilePureGoUnsupported(t *testing.T) {
+	t.Parallel()
+	for name, b := range map[string]*varnishlog.LogReaderBuilder{
+		"no file":  varnishlog.New().SetPureGo(true),
+		"grouping": varnishlog.New().SetPureGo(true).SetFile(testBinPath()).SetGrouping(varnishlog.GroupingRequest),
+		"query":    varnishlog.New().SetPureGo(true).SetFile(testBinPath()).SetQuery(`ReqURL eq "/"`),
+	} {
+		if r, err := b.Attach(); err == nil {
+			r.Close()
+			t.Errorf("%s: expected Attach to fail", name)
+		}
+	}
+}
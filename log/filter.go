@@ -0,0 +1,122 @@
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// filterArg is a record filter option, in the order it was given to the
+// builder: as with varnishlog, whether -i or -I comes first matters.
+type filterArg struct {
+	opt  byte // 'i', 'x', 'I' or 'X', as passed to VSL_Arg
+	tags []Tag
+	re   string
+}
+
+// vslArg renders the argument of the option as VSL_Arg expects it.
+func (a filterArg) vslArg() string {
+	if a.opt == 'I' || a.opt == 'X' {
+		return a.tags[0].String() + ":" + a.re
+	}
+	names := make([]string, len(a.tags))
+	for i, t := range a.tags {
+		names[i] = t.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// recordFilter is the Go rendition of VSL_Match, used by the pure-Go file
+// reader to honour the filters that libvarnishapi applies otherwise.
+type recordFilter struct {
+	selectTags   [256]bool
+	suppressTags [256]bool
+	selectRe     []tagRegexp
+	suppressRe   []tagRegexp
+	client       bool
+	backend      bool
+}
+
+type tagRegexp struct {
+	tag Tag
+	re  *regexp.Regexp
+}
+
+// newRecordFilter builds the filter described by args and the -c/-b options.
+func newRecordFilter(args []filterArg, client, backend bool) (*recordFilter, error) {
+	f := &recordFilter{client: client, backend: backend}
+	seen := false
+	for _, a := range args {
+		// the first -i or -I, unless preceded by -x or -X, suppresses
+		// every tag that isn't explicitly selected
+		if !seen && (a.opt == 'i' || a.opt == 'I') {
+			for i := range f.suppressTags {
+				f.suppressTags[i] = true
+			}
+		}
+		seen = true
+
+		switch a.opt {
+		case 'i', 'x':
+			bits := &f.selectTags
+			if a.opt == 'x' {
+				bits = &f.suppressTags
+			}
+			for _, t := range a.tags {
+				bits[t] = true
+			}
+		case 'I', 'X':
+			re, err := regexp.Compile(a.re)
+			if err != nil {
+				return nil, fmt.Errorf("-%c %s: %w", a.opt, a.vslArg(), err)
+			}
+			if a.opt == 'I' {
+				f.selectRe = append(f.selectRe, tagRegexp{a.tags[0], re})
+			} else {
+				f.suppressRe = append(f.suppressRe, tagRegexp{a.tags[0], re})
+			}
+		}
+	}
+	return f, nil
+}
+
+// match reports whether rec passes the filter, following VSL_Match.
+func (f *recordFilter) match(rec Record) bool {
+	if rec.Tag <= 0 || rec.Tag >= Tag(len(f.selectTags)) {
+		return false
+	}
+	switch {
+	case f.client && f.backend:
+		if !rec.IsClient && !rec.IsBackend {
+			return false
+		}
+	case f.client:
+		if !rec.IsClient {
+			return false
+		}
+	case f.backend:
+		if !rec.IsBackend {
+			return false
+		}
+	}
+	switch {
+	case matchTagRegexp(f.selectRe, rec):
+		return true
+	case f.selectTags[rec.Tag]:
+		return true
+	case matchTagRegexp(f.suppressRe, rec):
+		return false
+	case f.suppressTags[rec.Tag]:
+		return false
+	}
+	return true
+}
+
+func matchTagRegexp(res []tagRegexp, rec Record) bool {
+	for _, r := range res {
+		if r.tag == rec.Tag && r.re.MatchString(rec.Data) {
+			return true
+		}
+	}
+	return false
+}
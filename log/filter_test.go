@@ -0,0 +1,212 @@
+package log_test
+
+import (
+	"reflect"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+// filterCases are record filters applied to test1_log.bin, with a check of
+// the transactions they let through.
+var filterCases = []struct {
+	name     string
+	grouping varnishlog.Grouping
+	setup    func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder
+	check    func(t *testing.T, txns []varnishlog.Transaction)
+}{
+	{
+		name:     "include tags",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.IncludeTags(varnishlog.TagReqURL, varnishlog.TagBereqURL)
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			checkRecords(t, txns, 6, func(rec varnishlog.Record) bool {
+				return rec.Tag == varnishlog.TagReqURL || rec.Tag == varnishlog.TagBereqURL
+			})
+		},
+	},
+	{
+		name:     "exclude tags",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.ExcludeTags(varnishlog.TagTimestamp, varnishlog.TagReqHeader)
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			checkRecords(t, txns, -1, func(rec varnishlog.Record) bool {
+				return rec.Tag != varnishlog.TagTimestamp && rec.Tag != varnishlog.TagReqHeader
+			})
+		},
+	},
+	{
+		name:     "include regex",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.IncludeRegex(varnishlog.TagReqURL, "^/unk")
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			checkRecords(t, txns, 2, func(rec varnishlog.Record) bool {
+				return rec.Tag == varnishlog.TagReqURL && rec.Data == "/unknown"
+			})
+		},
+	},
+	{
+		name:     "exclude regex",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.ExcludeRegex(varnishlog.TagReqURL, "^/unk")
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			checkRecords(t, txns, -1, func(rec varnishlog.Record) bool {
+				return rec.Tag != varnishlog.TagReqURL || rec.Data == "/"
+			})
+		},
+	},
+	{
+		// an include wins over an exclude, and an exclude given first
+		// keeps the records no filter mentions
+		name:     "include overrides exclude",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.ExcludeTags(varnishlog.TagTimestamp, varnishlog.TagVCLCall).IncludeTags(varnishlog.TagTimestamp)
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			var ts int
+			checkRecords(t, txns, -1, func(rec varnishlog.Record) bool {
+				if rec.Tag == varnishlog.TagTimestamp {
+					ts++
+				}
+				return rec.Tag != varnishlog.TagVCLCall
+			})
+			if ts == 0 {
+				t.Error("expected Timestamp records")
+			}
+		},
+	},
+	{
+		name:     "backend only",
+		grouping: varnishlog.GroupingRaw,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.SetBackendOnly(true)
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			checkRecords(t, txns, -1, func(rec varnishlog.Record) bool {
+				return rec.IsBackend && (rec.VXID == 3 || rec.VXID == 32771 || rec.VXID == 32773)
+			})
+		},
+	},
+	{
+		name:     "client only",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.SetClientOnly(true)
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			checkRecords(t, txns, -1, func(rec varnishlog.Record) bool { return rec.IsClient })
+			for _, txn := range txns {
+				if txn.Type == varnishlog.TypeBackend && len(txn.Records) > 0 {
+					t.Errorf("backend transaction %d has records", txn.VXID)
+				}
+			}
+		},
+	},
+	{
+		name:     "transaction limit",
+		grouping: varnishlog.GroupingVXID,
+		setup: func(b *varnishlog.LogReaderBuilder) *varnishlog.LogReaderBuilder {
+			return b.SetTransactionLimit(1)
+		},
+		check: func(t *testing.T, txns []varnishlog.Transaction) {
+			var forced int
+			for _, txn := range txns {
+				last := txn.Records[len(txn.Records)-1]
+				switch {
+				case last.Tag == varnishlog.TagVSL && last.Data == "store overflow":
+					forced++
+				case last.Tag != varnishlog.TagEnd:
+					t.Errorf("transaction %d ends with %s %q", txn.VXID, last.Tag, last.Data)
+				}
+			}
+			if forced == 0 {
+				t.Error("expected transactions to be forced out")
+			}
+		},
+	},
+}
+
+// checkRecords verifies that every record of txns satisfies ok, and that
+// there are want of them (if want isn't negative).
+func checkRecords(t *testing.T, txns []varnishlog.Transaction, want int, ok func(varnishlog.Record) bool) {
+	t.Helper()
+	var n int
+	for _, txn := range txns {
+		for _, rec := range txn.Records {
+			if !ok(rec) {
+				t.Errorf("unexpected record in %d: %s %q", txn.VXID, rec.Tag, rec.Data)
+			}
+			n++
+		}
+	}
+	if n == 0 || (want >= 0 && n != want) {
+		t.Errorf("got %d records, want %d", n, want)
+	}
+}
+
+func TestRecordFiltersPureGo(t *testing.T) {
+	t.Parallel()
+	for _, tc := range filterCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := tc.setup(varnishlog.New().SetGrouping(tc.grouping).SetFile(testBinPath()).SetPureGo(true)).Attach()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			tc.check(t, collect(t, r))
+		})
+	}
+}
+
+// TestRecordFiltersParity verifies that the pure-Go reader applies the
+// filters exactly like libvarnishapi.
+func TestRecordFiltersParity(t *testing.T) {
+	t.Parallel()
+	skipIfEnterprise(t)
+	for _, tc := range filterCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := tc.setup(varnishlog.New().SetGrouping(tc.grouping).SetFile(testBinPath())).Attach()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := collect(t, r)
+			r.Close()
+			tc.check(t, want)
+
+			r, err = tc.setup(varnishlog.New().SetGrouping(tc.grouping).SetFile(testBinPath()).SetPureGo(true)).Attach()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := collect(t, r)
+			r.Close()
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("pure-Go transactions differ:\ngot:  %+v\nwant: %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRecordFilterErrors(t *testing.T) {
+	t.Parallel()
+	for name, b := range map[string]*varnishlog.LogReaderBuilder{
+		"no tags":     varnishlog.New().IncludeTags(),
+		"invalid tag": varnishlog.New().ExcludeTags(varnishlog.TagReqURL, 0),
+		"limit":       varnishlog.New().SetTransactionLimit(0),
+		"timeout":     varnishlog.New().SetTransactionTimeout(-1),
+		"go regexp":   varnishlog.New().SetFile(testBinPath()).SetPureGo(true).IncludeRegex(varnishlog.TagReqURL, `^/(?!api)`),
+	} {
+		if r, err := b.Attach(); err == nil {
+			r.Close()
+			t.Errorf("%s: expected Attach to fail", name)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package log
+
+import (
+	"net/http"
+	"net/textproto"
+	"slices"
+)
+
+// Message is one of the HTTP messages whose headers VSL logs.
+type Message int
+
+const (
+	// MessageReq: the client request (ReqHeader, ReqUnset).
+	MessageReq Message = iota
+	// MessageBereq: the backend request (BereqHeader, BereqUnset).
+	MessageBereq
+	// MessageBeresp: the backend response (BerespHeader, BerespUnset).
+	MessageBeresp
+	// MessageResp: the client response (RespHeader, RespUnset).
+	MessageResp
+	// MessageObj: the cached object (ObjHeader, ObjUnset).
+	MessageObj
+)
+
+// String returns the VCL name of the message: "req", "bereq", "beresp",
+// "resp" or "obj". Implements [fmt.Stringer].
+func (m Message) String() string {
+	switch m {
+	case MessageReq:
+		return "req"
+	case MessageBereq:
+		return "bereq"
+	case MessageBeresp:
+		return "beresp"
+	case MessageResp:
+		return "resp"
+	case MessageObj:
+		return "obj"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the message as its VCL name. Implements [encoding.TextMarshaler];
+// see https://pkg.go.dev/encoding#TextMarshaler.
+func (m Message) MarshalText() ([]byte, error) { return []byte(m.String()), nil }
+
+// HeaderChange is a header set or unset, as logged by a header record.
+type HeaderChange struct {
+	Message Message `json:"message" yaml:"message"`
+	Name    string  `json:"name"    yaml:"name"` // as logged, e.g. "Content-type"
+	Value   string  `json:"value"   yaml:"value"`
+	Unset   bool    `json:"unset"   yaml:"unset"`
+	// Sub is the VCL subroutine that made the change, as logged by VCL_call
+	// (e.g. "RECV", "BACKEND_RESPONSE"), or empty if Varnish did, e.g. when
+	// receiving the message or preparing the response.
+	Sub string `json:"sub,omitempty" yaml:"sub,omitempty"`
+	// Index is the position of the record in [Transaction.Records].
+	Index int `json:"index" yaml:"index"`
+}
+
+// Headers are the headers of the HTTP messages of a transaction, in their
+// final state, as returned by [ReplayHeaders]. A message without header
+// records is nil.
+type Headers struct {
+	Req    http.Header `json:"req,omitempty"    yaml:"req,omitempty"`
+	Bereq  http.Header `json:"bereq,omitempty"  yaml:"bereq,omitempty"`
+	Beresp http.Header `json:"beresp,omitempty" yaml:"beresp,omitempty"`
+	Resp   http.Header `json:"resp,omitempty"   yaml:"resp,omitempty"`
+	Obj    http.Header `json:"obj,omitempty"    yaml:"obj,omitempty"`
+	// History lists the changes to each header, by canonical name (see
+	// [http.CanonicalHeaderKey]), in log order. The changes made by VCL are
+	// the ones with a Sub.
+	History map[string][]HeaderChange `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+// Get returns the headers of message m.
+func (h Headers) Get(m Message) http.Header {
+	switch m {
+	case MessageReq:
+		return h.Req
+	case MessageBereq:
+		return h.Bereq
+	case MessageBeresp:
+		return h.Beresp
+	case MessageResp:
+		return h.Resp
+	case MessageObj:
+		return h.Obj
+	default:
+		return nil
+	}
+}
+
+func (h *Headers) ptr(m Message) *http.Header {
+	switch m {
+	case MessageReq:
+		return &h.Req
+	case MessageBereq:
+		return &h.Bereq
+	case MessageBeresp:
+		return &h.Beresp
+	case MessageResp:
+		return &h.Resp
+	default:
+		return &h.Obj
+	}
+}
+
+// messageTags are the tags logging a message: its header sets and unsets, and
+// the first two records of its first line, logged back to back when Varnish
+// starts a new message.
+type messageTags struct {
+	header, unset, first, second Tag
+}
+
+// headerTags returns the tags of every message, indexed by [Message]. The tags
+// being set at runtime, they can't be a package variable.
+func headerTags() []messageTags {
+	return []messageTags{
+		MessageReq:    {TagReqHeader, TagReqUnset, TagReqMethod, TagReqURL},
+		MessageBereq:  {TagBereqHeader, TagBereqUnset, TagBereqMethod, TagBereqURL},
+		MessageBeresp: {TagBerespHeader, TagBerespUnset, TagBerespProtocol, TagBerespStatus},
+		MessageResp:   {TagRespHeader, TagRespUnset, TagRespProtocol, TagRespStatus},
+		MessageObj:    {TagObjHeader, TagObjUnset, TagObjProtocol, TagObjStatus},
+	}
+}
+
+// ReplayHeaders applies the header records of txn in order to find the
+// headers its HTTP messages ended up with: those Varnish sent, for the
+// backend request and the client response.
+//
+// An unset removes the first value logged with the same name (compared case
+// insensitively) and value. A message starts over when Varnish logs a new
+// one outside of VCL, e.g. a synthetic response replacing the delivered one,
+// or the response of a retried backend fetch.
+func ReplayHeaders(txn Transaction) Headers {
+	tags := headerTags()
+	var h Headers
+	var sub string
+	for i, rec := range txn.Records {
+		if rec.Tag == 0 {
+			continue // unsupported tags are zero and must never match
+		}
+		switch rec.Tag {
+		case TagVCLCall:
+			sub = rec.Data
+			continue
+		case TagVCLReturn:
+			sub = ""
+			continue
+		}
+		for m, mt := range tags {
+			hdr := h.ptr(Message(m))
+			switch rec.Tag {
+			case mt.header, mt.unset:
+				parsed, err := ParseHeader(rec.Data)
+				if err != nil {
+					continue
+				}
+				change := HeaderChange{
+					Message: Message(m),
+					Name:    parsed.Name,
+					Value:   parsed.Value,
+					Unset:   rec.Tag == mt.unset,
+					Sub:     sub,
+					Index:   i,
+				}
+				key := textproto.CanonicalMIMEHeaderKey(parsed.Name)
+				if h.History == nil {
+					h.History = map[string][]HeaderChange{}
+				}
+				h.History[key] = append(h.History[key], change)
+				if *hdr == nil {
+					*hdr = http.Header{}
+				}
+				if !change.Unset {
+					hdr.Add(key, parsed.Value)
+					continue
+				}
+				if j := slices.Index((*hdr)[key], parsed.Value); j >= 0 {
+					(*hdr)[key] = slices.Delete((*hdr)[key], j, j+1)
+				}
+				if len((*hdr)[key]) == 0 {
+					delete(*hdr, key)
+				}
+			case mt.first:
+				if sub == "" && *hdr != nil && i+1 < len(txn.Records) && txn.Records[i+1].Tag == mt.second {
+					*hdr = http.Header{}
+				}
+			}
+		}
+	}
+	return h
+}
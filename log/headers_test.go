@@ -0,0 +1,171 @@
+package log_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func TestReplayHeadersFile(t *testing.T) {
+	t.Parallel()
+	tree := varnishlog.NewTree(collect(t, newPureGoReader(t)))
+
+	h := varnishlog.ReplayHeaders(tree.Node(2).Transaction)
+	wantResp := http.Header{
+		"Server":         {"SimpleHTTP/0.6 Python/3.14.4"},
+		"Date":           {"Fri, 08 May 2026 21:26:16 GMT"},
+		"Content-Type":   {"text/html; charset=utf-8"},
+		"Content-Length": {"2965"},
+		"X-Varnish":      {"2"},
+		"Age":            {"0"},
+		"Accept-Ranges":  {"bytes"},
+		"Connection":     {"keep-alive"},
+	}
+	if !reflect.DeepEqual(h.Resp, wantResp) {
+		t.Errorf("resp: got %v, want %v", h.Resp, wantResp)
+	}
+	if got := h.Req.Get("Via"); got != "1.1 flamp (Varnish/9.0)" {
+		t.Errorf("req Via: got %q", got)
+	}
+	if h.Bereq != nil || h.Beresp != nil || h.Obj != nil {
+		t.Errorf("expected no backend headers in a client request, got %+v", h)
+	}
+	wantVia := []varnishlog.HeaderChange{
+		{Message: varnishlog.MessageReq, Name: "Via", Value: "1.1 flamp (Varnish/9.0)", Index: 12},
+		{Message: varnishlog.MessageResp, Name: "Via", Value: "1.1 flamp (Varnish/9.0)", Index: 31},
+		{Message: varnishlog.MessageResp, Name: "Via", Value: "1.1 flamp (Varnish/9.0)", Unset: true, Sub: "DELIVER", Index: 34},
+	}
+	if got := h.History["Via"]; !reflect.DeepEqual(got, wantVia) {
+		t.Errorf("Via history: got %+v, want %+v", got, wantVia)
+	}
+
+	be := varnishlog.ReplayHeaders(tree.Node(32771).Transaction)
+	if got := be.Bereq.Get("X-Varnish"); got != "32771" {
+		t.Errorf("bereq X-Varnish: got %q", got)
+	}
+	if got := be.Beresp.Get("Content-Length"); got != "460" {
+		t.Errorf("beresp Content-Length: got %q", got)
+	}
+	if be.Req != nil || be.Resp != nil {
+		t.Errorf("expected no client headers in a backend request, got %+v", be)
+	}
+}
+
+func TestReplayHeaders(t *testing.T) {
+	t.Parallel()
+	call := func(s string) varnishlog.Record { return rec(varnishlog.TagVCLCall, s) }
+	ret := func(s string) varnishlog.Record { return rec(varnishlog.TagVCLReturn, s) }
+
+	tests := []struct {
+		name    string
+		records []varnishlog.Record
+		msg     varnishlog.Message
+		want    http.Header
+	}{
+		{
+			name: "unset one of several values",
+			records: []varnishlog.Record{
+				rec(varnishlog.TagReqHeader, "Cookie: a=1"),
+				rec(varnishlog.TagReqHeader, "cookie: b=2"),
+				call("RECV"),
+				rec(varnishlog.TagReqUnset, "COOKIE: a=1"),
+				ret("hash"),
+			},
+			msg:  varnishlog.MessageReq,
+			want: http.Header{"Cookie": {"b=2"}},
+		},
+		{
+			name: "header changed by VCL",
+			records: []varnishlog.Record{
+				rec(varnishlog.TagBereqHeader, "Host: example.com"),
+				call("BACKEND_FETCH"),
+				rec(varnishlog.TagBereqUnset, "Host: example.com"),
+				rec(varnishlog.TagBereqHeader, "Host: origin.example.com"),
+				ret("fetch"),
+			},
+			msg:  varnishlog.MessageBereq,
+			want: http.Header{"Host": {"origin.example.com"}},
+		},
+		{
+			name: "synthetic response",
+			records: []varnishlog.Record{
+				rec(varnishlog.TagRespProtocol, "HTTP/1.1"),
+				rec(varnishlog.TagRespStatus, "200"),
+				rec(varnishlog.TagRespHeader, "Content-Length: 12"),
+				rec(varnishlog.TagRespProtocol, "HTTP/1.1"),
+				rec(varnishlog.TagRespHeader, "X-Varnish: 2"),
+				call("DELIVER"),
+				rec(varnishlog.TagRespStatus, "500"),
+				ret("synth"),
+				rec(varnishlog.TagRespProtocol, "HTTP/1.1"),
+				rec(varnishlog.TagRespStatus, "500"),
+				rec(varnishlog.TagRespReason, "Internal Server Error"),
+				rec(varnishlog.TagRespHeader, "X-Varnish: 2"),
+				call("SYNTH"),
+				rec(varnishlog.TagRespHeader, "X-Error: yes"),
+				ret("deliver"),
+			},
+			msg:  varnishlog.MessageResp,
+			want: http.Header{"X-Varnish": {"2"}, "X-Error": {"yes"}},
+		},
+		{
+			name: "retried fetch",
+			records: []varnishlog.Record{
+				rec(varnishlog.TagBerespProtocol, "HTTP/1.1"),
+				rec(varnishlog.TagBerespStatus, "503"),
+				rec(varnishlog.TagBerespHeader, "Retry-After: 1"),
+				call("BACKEND_RESPONSE"),
+				ret("retry"),
+				call("BACKEND_FETCH"),
+				ret("fetch"),
+				rec(varnishlog.TagBerespProtocol, "HTTP/1.1"),
+				rec(varnishlog.TagBerespStatus, "200"),
+				rec(varnishlog.TagBerespHeader, "Content-Length: 3"),
+			},
+			msg:  varnishlog.MessageBeresp,
+			want: http.Header{"Content-Length": {"3"}},
+		},
+		{
+			name: "all unset",
+			records: []varnishlog.Record{
+				rec(varnishlog.TagObjHeader, "Set-Cookie: a=1"),
+				rec(varnishlog.TagObjUnset, "Set-Cookie: a=1"),
+			},
+			msg:  varnishlog.MessageObj,
+			want: http.Header{},
+		},
+		{"none", nil, varnishlog.MessageResp, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := varnishlog.ReplayHeaders(txn(0, 2, 1, varnishlog.TypeRequest, varnishlog.ReasonRxReq, tt.records...))
+			if got := h.Get(tt.msg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayHeadersHistory(t *testing.T) {
+	t.Parallel()
+	h := varnishlog.ReplayHeaders(txn(0, 2, 1, varnishlog.TypeRequest, varnishlog.ReasonRxReq,
+		rec(varnishlog.TagReqHeader, "accept-encoding: gzip, br"),
+		rec(varnishlog.TagVCLCall, "RECV"),
+		rec(varnishlog.TagReqUnset, "accept-encoding: gzip, br"),
+		rec(varnishlog.TagReqHeader, "Accept-Encoding: gzip"),
+		rec(varnishlog.TagVCLReturn, "hash"),
+	))
+	want := []varnishlog.HeaderChange{
+		{Message: varnishlog.MessageReq, Name: "accept-encoding", Value: "gzip, br", Index: 0},
+		{Message: varnishlog.MessageReq, Name: "accept-encoding", Value: "gzip, br", Unset: true, Sub: "RECV", Index: 2},
+		{Message: varnishlog.MessageReq, Name: "Accept-Encoding", Value: "gzip", Sub: "RECV", Index: 3},
+	}
+	if got := h.History["Accept-Encoding"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if len(h.History) != 1 {
+		t.Errorf("expected the history of one header, got %+v", h.History)
+	}
+}
@@ -3,7 +3,13 @@ package log
 
 // The main entry point is [New], which returns a [LogReaderBuilder]. Configure it
 // with optional name, timeout, query, and grouping, then call [LogReaderBuilder.Attach]
-// to get a [LogReader]. Call [LogReader.Run] to start streaming transactions.
+// to get a [LogReader]. Call [LogReader.Run] to start streaming transactions, or
+// consume them with a range loop over [LogReader.Transactions], or from a channel
+// with [LogReader.Stream].
+//
+// With [LogReaderBuilder.SetPureGo], VSL files are decoded in Go instead, without
+// libvarnishapi; the package then also builds with CGO_ENABLED=0, with the tags
+// of Varnish Cache built in (see [Tag]).
 //
 // # Usage
 //
@@ -29,47 +35,11 @@ package log
 //	    return nil
 //	})
 
-// #cgo pkg-config: varnishapi
-// #include <stdint.h>
-// #include <stdio.h>
-// #include <stdlib.h>
-// #include <vapi/vsm.h>
-// #include <vapi/vsl.h>
-//
-// extern int dispatchCallback(struct VSL_data*, struct VSL_transaction* const*, void*);
-//
-// static int callVSLQDispatch(struct VSLQ *vslq, uintptr_t priv) {
-//     return VSLQ_Dispatch(vslq, dispatchCallback, (void*)priv);
-// }
-//
-// static int callVSLQFlush(struct VSLQ *vslq, uintptr_t priv) {
-//     return VSLQ_Flush(vslq, dispatchCallback, (void*)priv);
-// }
-//
-// static const char* vslTagName(int tag) {
-//     if (tag <= 0 || tag >= SLT__MAX) return NULL;
-//     return VSL_tags[tag];
-// }
-//
-import "C"
-
 import (
 	"context"
 	"fmt"
-	"runtime/cgo"
-	"strconv"
+	"sync"
 	"time"
-	"unsafe"
-)
-
-// VSL dispatch status codes, matching the C enum vsl_status.
-const (
-	vslMore     = 1
-	vslEnd      = 0
-	vslEEOF     = -1
-	vslEAbandon = -2
-	vslEOverrun = -3
-	vslEIO      = -4
 )
 
 // LogErr describes a recoverable VSL read condition — equivalent to the
@@ -122,37 +92,39 @@ func (e LogErr) String() string {
 // see https://pkg.go.dev/encoding#TextMarshaler.
 func (e LogErr) MarshalText() ([]byte, error) { return []byte(e.String()), nil }
 
-// How VSL records are grouped into transactions.
+// How VSL records are grouped into transactions. The values are those of
+// libvarnishapi's enum VSL_grouping_e.
 type Grouping int
 
 const (
 	// Each record is delivered as its own transaction, with no parent-child relationships.
 	// Use this to notably read Backend_health records and logs occuring outside of sessions and requests.
-	GroupingRaw Grouping = Grouping(C.VSL_g_raw)
+	GroupingRaw Grouping = iota
 	// Records are grouped into a single transaction
-	GroupingVXID Grouping = Grouping(C.VSL_g_vxid)
+	GroupingVXID
 	// HTTP transactions are grouped using the Link records, a group will contain the backend requests,
 	// restarts and ESI transactions it directly or indirectly triggered.
-	GroupingRequest Grouping = Grouping(C.VSL_g_request)
+	GroupingRequest
 	// Same as [GroupingRequest] but the entry point is the connection itself, meaning the group will
 	// contain all the transactions triggered by the connection.
-	GroupingSession Grouping = Grouping(C.VSL_g_session)
+	GroupingSession
 )
 
 // TransactionType describes what kind of processing a transaction represents.
+// The values are those of libvarnishapi's enum VSL_transaction_e.
 type TransactionType int
 
 const (
 	// Unknown type, should not occur in practice.
-	TypeUnknown TransactionType = TransactionType(C.VSL_t_unknown)
+	TypeUnknown TransactionType = iota
 	// Session, represents a client connection.
-	TypeSession TransactionType = TransactionType(C.VSL_t_sess)
+	TypeSession
 	// Client request
-	TypeRequest TransactionType = TransactionType(C.VSL_t_req)
+	TypeRequest
 	// Backend request
-	TypeBackend TransactionType = TransactionType(C.VSL_t_bereq)
+	TypeBackend
 	// Raw log entry
-	TypeRaw TransactionType = TransactionType(C.VSL_t_raw)
+	TypeRaw
 )
 
 // String returns the name of the transaction type. Implements [fmt.Stringer].
@@ -175,28 +147,29 @@ func (t TransactionType) String() string {
 // see https://pkg.go.dev/encoding#TextMarshaler.
 func (t TransactionType) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
 
-// Reason describes why a transaction was initiated.
+// Reason describes why a transaction was initiated. The values are those of
+// libvarnishapi's enum VSL_reason_e.
 type Reason int
 
 const (
 	// Unknown reason, should not occur in practice.
-	ReasonUnknown Reason = Reason(C.VSL_r_unknown)
+	ReasonUnknown Reason = iota
 	// HTTP/1.x request
-	ReasonHTTP1 Reason = Reason(C.VSL_r_http_1)
+	ReasonHTTP1
 	// Received request
-	ReasonRxReq Reason = Reason(C.VSL_r_rxreq)
+	ReasonRxReq
 	// ESI processing
-	ReasonESI Reason = Reason(C.VSL_r_esi)
+	ReasonESI
 	// Restarted request
-	ReasonRestart Reason = Reason(C.VSL_r_restart)
+	ReasonRestart
 	// Backend request started because of a pass
-	ReasonPass Reason = Reason(C.VSL_r_pass)
+	ReasonPass
 	// Backend request started to fetch a cache miss
-	ReasonFetch Reason = Reason(C.VSL_r_fetch)
+	ReasonFetch
 	// Backend request started to refresh a graced object
-	ReasonBgFetch Reason = Reason(C.VSL_r_bgfetch)
+	ReasonBgFetch
 	// Piped request
-	ReasonPipe Reason = Reason(C.VSL_r_pipe)
+	ReasonPipe
 )
 
 // String returns the name of the reason. Implements [fmt.Stringer].
@@ -229,18 +202,25 @@ func (r Reason) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
 
 // Tag is a VSL log tag (e.g. [TagReqURL], [TagRespStatus]).
 // Use [TagByName] to look up a tag by its string name.
+//
+// Tags are numbered and named by the installed libvarnishapi. When built
+// without CGo, a built-in table of the tags of Varnish Cache 7 and later is
+// used instead.
 type Tag int
 
 // String returns the tag's name as known to Varnish (e.g. "ReqURL", "RespStatus").
 // Implements [fmt.Stringer].
 func (t Tag) String() string {
-	s := C.vslTagName(C.int(t))
-	if s == nil {
-		return fmt.Sprintf("tag#%d", int(t))
+	if name := tagName(t); name != "" {
+		return name
 	}
-	return C.GoString(s)
+	return fmt.Sprintf("tag#%d", int(t))
 }
 
+// isBinary reports whether records with this tag carry binary data instead of
+// NUL-terminated text.
+func (t Tag) isBinary() bool { return tagBinary(t) }
+
 // MarshalText encodes the tag as its Varnish name. Implements [encoding.TextMarshaler];
 // see https://pkg.go.dev/encoding#TextMarshaler.
 func (t Tag) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
@@ -248,9 +228,7 @@ func (t Tag) MarshalText() ([]byte, error) { return []byte(t.String()), nil }
 // TagByName looks up a Tag by name (case-insensitive; prefix match is accepted
 // when unambiguous). Returns an error if the name matches zero or multiple tags.
 func TagByName(name string) (Tag, error) {
-	cs := C.CString(name)
-	defer C.free(unsafe.Pointer(cs))
-	n := C.VSL_Name2Tag(cs, -1)
+	n := name2Tag(name)
 	switch {
 	case n >= 0:
 		return Tag(n), nil
@@ -261,6 +239,18 @@ func TagByName(name string) (Tag, error) {
 	}
 }
 
+// Tags returns every tag known to the installed Varnish version, in numeric order.
+// Without CGo, these are the tags of Varnish Cache 7 and later, see [Tag].
+func Tags() []Tag {
+	var tags []Tag
+	for i := 1; i < tagMax; i++ {
+		if tagName(Tag(i)) != "" {
+			tags = append(tags, Tag(i))
+		}
+	}
+	return tags
+}
+
 // Record is a single VSL log entry within a transaction.
 type Record struct {
 	Tag       Tag    `json:"tag"       yaml:"tag"`
@@ -278,74 +268,58 @@ type Transaction struct {
 	Type       TransactionType `json:"type"       yaml:"type"`
 	Reason     Reason          `json:"reason"     yaml:"reason"`
 	Records    []Record        `json:"records"    yaml:"records"`
+
+	// Instance is the name of the Varnish instance the transaction was read
+	// from, set by [MultiReader].
+	Instance string `json:"instance,omitempty" yaml:"instance,omitempty"`
 }
 
 // LogReaderBuilder configures a connection to the Varnish VSL.
 // Obtain one with [New], configure with the Set* methods, then call [LogReaderBuilder.Attach].
 type LogReaderBuilder struct {
-	vsm        *C.struct_vsm
-	vsl        *C.struct_VSL_data
+	name       string         // see SetName, SetFile and MultiReader
+	timeout    *time.Duration // nil: libvarnishapi's default
 	grouping   Grouping
 	query      string
 	errHandler func(LogErr)
 	backlog    bool   // start cursor at log head instead of tail
 	live       *bool  // nil=stop at end, true=follow, false=stop
 	file       string // read from binary VSL file instead of live instance
+	pureGo     bool   // decode file in Go instead of libvarnishapi
+	recordTags *[256]bool
+	filters    []filterArg
+	clientOnly bool
+	backOnly   bool
+	txnLimit   int
+	txnTimeout time.Duration
+	resume     *Checkpoint
+	checkpoint bool // track the position, see SetCheckpoints
 	err        error
 }
 
 // New returns a default  LogReaderBuilder with VXID grouping
 func New() *LogReaderBuilder {
-	vsm := C.VSM_New()
-	if vsm == nil {
-		return &LogReaderBuilder{err: fmt.Errorf("VSM_New failed")}
-	}
-	vsl := C.VSL_New()
-	if vsl == nil {
-		C.VSM_Destroy(&vsm)
-		return &LogReaderBuilder{err: fmt.Errorf("VSL_New failed")}
-	}
-	return &LogReaderBuilder{
-		vsm:      vsm,
-		vsl:      vsl,
-		grouping: GroupingVXID,
-	}
+	return &LogReaderBuilder{grouping: GroupingVXID}
 }
 
 // SetName sets the Varnish instance name (workdir path, the -n argument to varnishd).
 func (b *LogReaderBuilder) SetName(name string) *LogReaderBuilder {
-	if b.err != nil {
-		return b
-	}
-	cs := C.CString(name)
-	defer C.free(unsafe.Pointer(cs))
-	if ret := C.VSM_Arg(b.vsm, 'n', cs); ret < 0 {
-		b.err = fmt.Errorf("VSM_Arg -n: %s", C.GoString(C.VSM_Error(b.vsm)))
-	}
+	b.name = name
 	return b
 }
 
 // SetTimeout sets how long [LogReaderBuilder.Attach] will wait for the Varnish manager.
 // A negative duration disables the timeout (waits forever).
 func (b *LogReaderBuilder) SetTimeout(timeout time.Duration) *LogReaderBuilder {
-	if b.err != nil {
-		return b
-	}
-	var cs *C.char
-	if timeout < 0 {
-		cs = C.CString("off")
-	} else {
-		cs = C.CString(strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
-	}
-	defer C.free(unsafe.Pointer(cs))
-	if ret := C.VSM_Arg(b.vsm, 't', cs); ret < 0 {
-		b.err = fmt.Errorf("VSM_Arg -t: %s", C.GoString(C.VSM_Error(b.vsm)))
-	}
+	b.timeout = &timeout
 	return b
 }
 
 // SetQuery sets a VSL query expression to filter which transactions are delivered.
 // See vsl-query(7) for syntax.
+// The [github.com/varnish/varnish-go/log/query] package implements the same
+// language in Go, to validate queries ahead of time or filter transactions
+// that were already collected.
 func (b *LogReaderBuilder) SetQuery(query string) *LogReaderBuilder {
 	b.query = query
 	return b
@@ -393,47 +367,194 @@ func (b *LogReaderBuilder) SetFile(filename string) *LogReaderBuilder {
 	return b
 }
 
-// Attach connects to the Varnish shared memory segment and returns a [LogReader].
-// On failure, all underlying handles are freed and the builder must not be reused.
-func (b *LogReaderBuilder) Attach() (*LogReader, error) {
+// SetPureGo makes [LogReader.Run] decode the file given to [SetFile] in Go,
+// instead of going through libvarnishapi's file cursor. Only [GroupingRaw] and
+// [GroupingVXID] are supported, and [SetQuery] can't be used;
+// [LogReaderBuilder.Attach] returns an error otherwise.
+//
+// This is the only way to read logs when built without CGo. Tags are then
+// numbered as in Varnish Cache 7 and later, see [Tag]: files written by
+// Varnish Enterprise or older versions may number some tags differently, and
+// get wrong tag names without any error.
+//
+// See also the [github.com/varnish/varnish-go/log/vslfile] package, which
+// returns the raw records of VSL files.
+func (b *LogReaderBuilder) SetPureGo(enable bool) *LogReaderBuilder {
+	b.pureGo = enable
+	return b
+}
+
+// SetRecordTags restricts the records delivered to the handler to the given
+// tags; the others are skipped before their payload is copied, which saves
+// most of the decoding work when only a few tags are of interest. Grouping and
+// [SetQuery] still see every record. With [GroupingRaw], transactions whose
+// record is skipped aren't delivered at all; with the other groupings,
+// transactions are delivered even if none of their records is kept.
+//
+// Calling SetRecordTags without arguments delivers all records again, which
+// is the default.
+func (b *LogReaderBuilder) SetRecordTags(tags ...Tag) *LogReaderBuilder {
+	if len(tags) == 0 {
+		b.recordTags = nil
+		return b
+	}
+	b.recordTags = new([256]bool)
+	for _, t := range tags {
+		if t > 0 && t < 256 {
+			b.recordTags[t] = true
+		}
+	}
+	return b
+}
+
+// IncludeTags only delivers records with the given tags, like varnishlog's -i
+// option. The filters set by IncludeTags, ExcludeTags, IncludeRegex and
+// ExcludeRegex combine as in varnishlog, and are applied to the records of
+// the transactions selected by [SetQuery]: a record is delivered if it's
+// included by a tag or regex, else dropped if it's excluded. If the first of
+// these filters is an include, records that no filter mentions are dropped;
+// otherwise they're delivered.
+//
+// As with [SetRecordTags], transactions are still delivered when all their
+// records are filtered out, except with [GroupingRaw].
+func (b *LogReaderBuilder) IncludeTags(tags ...Tag) *LogReaderBuilder {
+	return b.addFilter(filterArg{opt: 'i', tags: tags})
+}
+
+// ExcludeTags drops records with the given tags, like varnishlog's -x option.
+// See [LogReaderBuilder.IncludeTags].
+func (b *LogReaderBuilder) ExcludeTags(tags ...Tag) *LogReaderBuilder {
+	return b.addFilter(filterArg{opt: 'x', tags: tags})
+}
+
+// IncludeRegex only delivers records with the given tag whose payload matches
+// re, like varnishlog's -I option. The expression is handed to
+// libvarnishapi, which uses PCRE2; with [SetPureGo], it must also be valid for
+// Go's [regexp] package. See [LogReaderBuilder.IncludeTags].
+func (b *LogReaderBuilder) IncludeRegex(tag Tag, re string) *LogReaderBuilder {
+	return b.addFilter(filterArg{opt: 'I', tags: []Tag{tag}, re: re})
+}
+
+// ExcludeRegex drops records with the given tag whose payload matches re,
+// like varnishlog's -X option. See [LogReaderBuilder.IncludeRegex].
+func (b *LogReaderBuilder) ExcludeRegex(tag Tag, re string) *LogReaderBuilder {
+	return b.addFilter(filterArg{opt: 'X', tags: []Tag{tag}, re: re})
+}
+
+func (b *LogReaderBuilder) addFilter(f filterArg) *LogReaderBuilder {
 	if b.err != nil {
-		return nil, b.err
+		return b
 	}
+	if len(f.tags) == 0 {
+		b.err = fmt.Errorf("-%c: no tag given", f.opt)
+		return b
+	}
+	for _, t := range f.tags {
+		if t <= 0 || t >= 256 {
+			b.err = fmt.Errorf("-%c: invalid tag %d", f.opt, int(t))
+			return b
+		}
+	}
+	b.filters = append(b.filters, f)
+	return b
+}
+
+// SetClientOnly only delivers the records of client-side transactions, like
+// varnishlog's -c option. Combined with [SetBackendOnly], records of both
+// sides are delivered, but not the non-transactional ones.
+func (b *LogReaderBuilder) SetClientOnly(enable bool) *LogReaderBuilder {
+	b.clientOnly = enable
+	return b
+}
 
-	var cquery *C.char
-	if b.query != "" {
-		cquery = C.CString(b.query)
-		defer C.free(unsafe.Pointer(cquery))
+// SetBackendOnly only delivers the records of backend-side transactions, like
+// varnishlog's -b option. See [SetClientOnly].
+func (b *LogReaderBuilder) SetBackendOnly(enable bool) *LogReaderBuilder {
+	b.backOnly = enable
+	return b
+}
+
+// SetTransactionLimit sets how many incomplete transactions are kept while
+// waiting for their End record, like varnishlog's -L option. Past the limit,
+// the oldest one is delivered as is, with a synthetic VSL "store overflow"
+// record. The default is 1000.
+func (b *LogReaderBuilder) SetTransactionLimit(n int) *LogReaderBuilder {
+	if b.err != nil {
+		return b
 	}
+	if n <= 0 {
+		b.err = fmt.Errorf("transaction limit must be positive, got %d", n)
+		return b
+	}
+	b.txnLimit = n
+	return b
+}
 
-	vslq := C.VSLQ_New(b.vsl, nil, C.enum_VSL_grouping_e(b.grouping), cquery)
-	if vslq == nil {
-		err := fmt.Errorf("VSLQ_New: %s", C.GoString(C.VSL_Error(b.vsl)))
-		C.VSL_Delete(b.vsl)
-		C.VSM_Destroy(&b.vsm)
-		return nil, err
+// SetTransactionTimeout sets how long an incomplete transaction is waited for,
+// like varnishlog's -T option. Past the timeout, it's delivered as is, with a
+// synthetic VSL "timeout" record. The default is 120 seconds.
+func (b *LogReaderBuilder) SetTransactionTimeout(timeout time.Duration) *LogReaderBuilder {
+	if b.err != nil {
+		return b
 	}
+	if timeout <= 0 {
+		b.err = fmt.Errorf("transaction timeout must be positive, got %s", timeout)
+		return b
+	}
+	b.txnTimeout = timeout
+	return b
+}
 
-	if b.file == "" {
-		if ret := C.VSM_Attach(b.vsm, 0); ret != 0 {
-			err := fmt.Errorf("VSM_Attach: %s", C.GoString(C.VSM_Error(b.vsm)))
-			C.VSLQ_Delete(&vslq)
-			C.VSL_Delete(b.vsl)
-			C.VSM_Destroy(&b.vsm)
-			return nil, err
+// Attach connects to the Varnish shared memory segment and returns a [LogReader].
+// On failure, all underlying handles are freed and the builder must not be reused.
+//
+// Without CGo, only readers set up with [LogReaderBuilder.SetPureGo] can be
+// attached.
+func (b *LogReaderBuilder) Attach() (*LogReader, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	var filter *recordFilter
+	var err error
+	if b.pureGo {
+		switch {
+		case b.file == "":
+			err = fmt.Errorf("SetPureGo requires SetFile")
+		case b.grouping != GroupingRaw && b.grouping != GroupingVXID:
+			err = fmt.Errorf("SetPureGo only supports raw and vxid grouping")
+		case b.query != "":
+			err = fmt.Errorf("SetPureGo does not support queries")
+		case len(b.filters) > 0 || b.clientOnly || b.backOnly:
+			filter, err = newRecordFilter(b.filters, b.clientOnly, b.backOnly)
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	r := &LogReader{
-		vsm:        b.vsm,
-		vsl:        b.vsl,
-		vslq:       vslq,
 		errHandler: b.errHandler,
 		backlog:    b.backlog,
 		live:       b.live,
 		file:       b.file,
+		grouping:   b.grouping,
+		pureGo:     b.pureGo,
+		recordTags: b.recordTags,
+		vslMatch:   len(b.filters) > 0 || b.clientOnly || b.backOnly,
+		filter:     filter,
+		txnLimit:   b.txnLimit,
+		txnTimeout: b.txnTimeout,
+		tracking:   b.checkpoint,
+	}
+	if !b.pureGo {
+		// the file is decoded in Go with SetPureGo, without libvarnishapi
+		if r.vapi, err = attachVapi(b, r); err != nil {
+			return nil, err
+		}
+	}
+	if b.resume != nil {
+		r.resumeFrom(*b.resume)
 	}
-	r.handle = cgo.NewHandle(r)
 	return r, nil
 }
 
@@ -441,18 +562,37 @@ func (b *LogReaderBuilder) Attach() (*LogReader, error) {
 // Obtain one via [LogReaderBuilder.Attach] and [LogReader.Run] to start streaming.
 // Call [LogReader.Close] when done.
 type LogReader struct {
-	vsm     *C.struct_vsm
-	vsl     *C.struct_VSL_data
-	vslq    *C.struct_VSLQ
-	handle  cgo.Handle
-	backlog bool   // start cursor at log head instead of tail
-	live    *bool  // nil=stop at end, true=follow, false=stop
-	file    string // non-empty: read from this VSL file
+	vapi     *vapi    // nil with SetPureGo
+	backlog  bool     // start cursor at log head instead of tail
+	live     *bool    // nil=stop at end, true=follow, false=stop
+	file     string   // non-empty: read from this VSL file
+	grouping Grouping // used by readFile and SetRecordTags
+	pureGo   bool     // decode file in Go, see readFile
+
+	recordTags *[256]bool // nil: deliver all records, see SetRecordTags
+	vslMatch   bool       // IncludeTags and friends are set: check records with VSL_Match
+	filter     *recordFilter
+	txnLimit   int           // only used by readFile, 0 for the default
+	txnTimeout time.Duration // only used by readFile, 0 for the default
+
+	// see Checkpoint; resume is nil once caught up with ResumeFrom's checkpoint
+	tracking bool // see SetCheckpoints
+	cpMu     sync.Mutex
+	cp       Checkpoint
+	resume   *resumeState
+
+	stats readerStats
 
 	// set for the duration of a Run call; accessed only on the Run goroutine
-	handler    func([]Transaction) error
-	handlerErr error
-	errHandler func(LogErr)
+	handler     func([]Transaction) error
+	viewHandler func([]TransactionView) error
+	handlerErr  error
+	errHandler  func(LogErr)
+
+	// reused by every RunView callback, see dispatchView
+	views      []TransactionView
+	viewRecs   []RecordView
+	viewBounds []int
 }
 
 // Run streams VSL transactions, calling handler for each group, until ctx is
@@ -466,138 +606,19 @@ type LogReader struct {
 func (r *LogReader) Run(ctx context.Context, handler func([]Transaction) error) error {
 	r.handler = handler
 	defer func() { r.handler = nil }()
-	priv := C.uintptr_t(r.handle)
-	if r.file != "" {
-		return r.runFile(ctx, priv)
-	}
-	return r.runLive(ctx, priv)
-}
-
-func (r *LogReader) runFile(ctx context.Context, priv C.uintptr_t) error {
-	cs := C.CString(r.file)
-	defer C.free(unsafe.Pointer(cs))
-	c := C.VSL_CursorFile(r.vsl, cs, 0)
-	if c == nil {
-		return fmt.Errorf("VSL_CursorFile: %s", C.GoString(C.VSL_Error(r.vsl)))
-	}
-	C.VSLQ_SetCursor(r.vslq, &c)
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-		i := int(C.callVSLQDispatch(r.vslq, priv))
-		if err := r.takeHandlerErr(); err != nil {
-			return err
-		}
-		switch i {
-		case vslMore:
-			// keep going
-		case vslEnd, vslEEOF:
-			C.callVSLQFlush(r.vslq, priv)
-			return r.takeHandlerErr()
-		default:
-			return fmt.Errorf("VSL read error on %s: status %d", r.file, i)
-		}
-	}
+	return r.run(ctx)
 }
 
-func (r *LogReader) runLive(ctx context.Context, priv C.uintptr_t) error {
-	hascursor := false
-	for {
-		if ctx.Err() != nil {
-			return ctx.Err()
-		}
-
-		status := uint(C.VSM_Status(r.vsm))
-
-		if !hascursor {
-			if status&uint(C.VSM_WRK_RUNNING) == 0 {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case <-time.After(100 * time.Millisecond):
-				}
-				continue
-			}
-			opts := C.uint(C.VSL_COPT_BATCH)
-			if !r.backlog {
-				opts |= C.uint(C.VSL_COPT_TAIL)
-			}
-			c := C.VSL_CursorVSM(r.vsl, r.vsm, opts)
-			if c == nil {
-				r.notifyErr(ErrCursorLost)
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case <-time.After(100 * time.Millisecond):
-				}
-				continue
-			}
-			C.VSLQ_SetCursor(r.vslq, &c)
-			hascursor = true
-		} else if status&uint(C.VSM_WRK_RESTARTED|C.VSM_WRK_CHANGED) != 0 {
-			// Worker restarted or VSM changed (e.g. VCL reload on Varnish Plus):
-			// existing cursor is stale — flush pending records and reconnect.
-			r.notifyErr(ErrWorkerRestarted)
-			C.callVSLQFlush(r.vslq, priv)
-			if err := r.takeHandlerErr(); err != nil {
-				return err
-			}
-			C.VSLQ_SetCursor(r.vslq, nil)
-			hascursor = false
-			continue
-		}
-
-		i := int(C.callVSLQDispatch(r.vslq, priv))
-		if err := r.takeHandlerErr(); err != nil {
-			return err
-		}
-
-		switch i {
-		case vslMore:
-			// more data available — loop immediately
-		case vslEnd:
-			// caught up to the live tail
-			if r.live != nil && !*r.live {
-				C.callVSLQFlush(r.vslq, priv)
-				return r.takeHandlerErr()
-			}
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(10 * time.Millisecond):
-			}
-		case vslEEOF:
-			return nil
-		case vslEOverrun:
-			r.notifyErr(ErrOverrun)
-			C.callVSLQFlush(r.vslq, priv)
-			if err := r.takeHandlerErr(); err != nil {
-				return err
-			}
-			C.VSLQ_SetCursor(r.vslq, nil)
-			hascursor = false
-		case vslEIO:
-			r.notifyErr(ErrIO)
-			C.callVSLQFlush(r.vslq, priv)
-			if err := r.takeHandlerErr(); err != nil {
-				return err
-			}
-			C.VSLQ_SetCursor(r.vslq, nil)
-			hascursor = false
-		default: // vslEAbandon and any unexpected status
-			r.notifyErr(ErrAbandoned)
-			C.callVSLQFlush(r.vslq, priv)
-			if err := r.takeHandlerErr(); err != nil {
-				return err
-			}
-			C.VSLQ_SetCursor(r.vslq, nil)
-			hascursor = false
-		}
+// run reads with the handlers set by Run or RunView.
+func (r *LogReader) run(ctx context.Context) error {
+	if r.pureGo {
+		return r.readFile(ctx)
 	}
+	return r.vapi.run(ctx, r)
 }
 
 func (r *LogReader) notifyErr(e LogErr) {
+	r.stats.logErr(e)
 	if r.errHandler != nil {
 		r.errHandler(e)
 	}
@@ -615,8 +636,7 @@ func (r *LogReader) takeHandlerErr() error {
 // Close releases all resources held by the LogReader. It must be called exactly
 // once when the LogReader is no longer needed.
 func (r *LogReader) Close() {
-	C.VSLQ_Delete(&r.vslq)
-	C.VSL_Delete(r.vsl)
-	C.VSM_Destroy(&r.vsm)
-	r.handle.Delete()
+	if r.vapi != nil {
+		r.vapi.close()
+	}
 }
@@ -0,0 +1,315 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMergeWindow is how long a [MultiReader] holds transactions back by
+// default, to deliver those of the different instances in order.
+const DefaultMergeWindow = 100 * time.Millisecond
+
+// MultiReaderBuilder configures a [MultiReader]. Obtain one with [NewMulti],
+// configure with the Set* methods, then call [MultiReaderBuilder.Attach].
+type MultiReaderBuilder struct {
+	builders   []*LogReaderBuilder
+	window     time.Duration
+	errHandler func(string, LogErr)
+	err        error
+}
+
+// NewMulti returns a builder for a [MultiReader] reading with each of the
+// given builders, typically set up for different instances with
+// [LogReaderBuilder.SetName]. The builders must not be used afterwards.
+//
+// Each instance is identified by the name given to SetName, or the file given
+// to [LogReaderBuilder.SetFile]; they must be unique.
+func NewMulti(builders ...*LogReaderBuilder) *MultiReaderBuilder {
+	return &MultiReaderBuilder{builders: builders, window: DefaultMergeWindow}
+}
+
+// SetWindow sets how long transactions are held back to be merged in order of
+// completion time, [DefaultMergeWindow] by default. A window of zero delivers
+// transactions as they come.
+func (b *MultiReaderBuilder) SetWindow(window time.Duration) *MultiReaderBuilder {
+	if b.err != nil {
+		return b
+	}
+	if window < 0 {
+		b.err = fmt.Errorf("merge window must not be negative, got %s", window)
+		return b
+	}
+	b.window = window
+	return b
+}
+
+// SetErrHandler registers a callback that is invoked whenever a recoverable
+// VSL read error occurs on one of the instances, with its name. Handlers set
+// on the builders with [LogReaderBuilder.SetErrHandler] are still called.
+//
+// The callback is called from the goroutine reading the instance, so it may
+// be called concurrently for different instances.
+func (b *MultiReaderBuilder) SetErrHandler(h func(instance string, e LogErr)) *MultiReaderBuilder {
+	b.errHandler = h
+	return b
+}
+
+// Attach attaches every builder and returns a [MultiReader]. On failure, the
+// readers that were attached are closed.
+func (b *MultiReaderBuilder) Attach() (*MultiReader, error) {
+	err := b.err
+	if err == nil && len(b.builders) == 0 {
+		err = fmt.Errorf("no log reader given")
+	}
+
+	m := &MultiReader{window: b.window}
+	for _, lb := range b.builders {
+		name := lb.instanceName()
+		if err == nil && slices.Contains(m.names, name) {
+			err = fmt.Errorf("instance %q given twice", name)
+		}
+		if h := b.errHandler; h != nil {
+			prev := lb.errHandler
+			lb.errHandler = func(e LogErr) {
+				if prev != nil {
+					prev(e)
+				}
+				h(name, e)
+			}
+		}
+		// track from the first group, see MultiReader.Checkpoint
+		lb.SetCheckpoints(true)
+		// attach them all anyway, as Attach frees the builder on failure
+		r, aerr := lb.Attach()
+		if aerr != nil {
+			if err == nil {
+				err = fmt.Errorf("%s: %w", name, aerr)
+			}
+			continue
+		}
+		m.readers = append(m.readers, r)
+		m.names = append(m.names, name)
+		m.held = append(m.held, nil)
+	}
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// instanceName identifies the instance read by the builder.
+func (b *LogReaderBuilder) instanceName() string {
+	if b.file != "" {
+		return b.file
+	}
+	return b.name
+}
+
+// MultiReader reads the logs of several Varnish instances at once, and merges
+// them into one stream. Obtain one with [NewMulti], call [MultiReader.Run] to
+// start streaming and [MultiReader.Close] when done.
+type MultiReader struct {
+	readers []*LogReader
+	names   []string
+	window  time.Duration
+
+	// held are the groups handed over by each reader and not delivered yet,
+	// in the reader's order, see Checkpoint
+	heldMu sync.Mutex
+	held   [][]heldGroup
+}
+
+// heldGroup is a group handed over by a reader, and the checkpoint of the
+// reader before it.
+type heldGroup struct {
+	seq    uint64
+	before Checkpoint
+}
+
+// Instances returns the names of the instances, in the order of the builders
+// given to [NewMulti].
+func (m *MultiReader) Instances() []string {
+	return slices.Clone(m.names)
+}
+
+// Reader returns the reader of the named instance, for its [LogReader.Stats],
+// or nil if there's no such instance. It must not be run or closed
+// separately.
+//
+// The reader hands its groups over to the merge rather than to the handler of
+// [MultiReader.Run], so its statistics and its [LogReader.Checkpoint] count
+// groups that may still be held back: resume from [MultiReader.Checkpoint]
+// instead.
+func (m *MultiReader) Reader(instance string) *LogReader {
+	if i := slices.Index(m.names, instance); i >= 0 {
+		return m.readers[i]
+	}
+	return nil
+}
+
+// Checkpoint returns the position of the named instance to resume its reader
+// with [LogReaderBuilder.ResumeFrom]: the [LogReader.Checkpoint] of the reader
+// before the first of its groups the handler of [MultiReader.Run] didn't
+// return from yet. As groups of an instance can be delivered out of order,
+// the groups delivered after that one may be delivered again on resumption.
+// It's the zero Checkpoint if there's no such instance.
+//
+// Checkpoint can be called from the handler, or concurrently with Run.
+func (m *MultiReader) Checkpoint(instance string) Checkpoint {
+	i := slices.Index(m.names, instance)
+	if i < 0 {
+		return Checkpoint{}
+	}
+	m.heldMu.Lock()
+	defer m.heldMu.Unlock()
+	if len(m.held[i]) > 0 {
+		return m.held[i][0].before
+	}
+	// the reader's checkpoint only moves past a group once the group is held
+	return m.readers[i].Checkpoint()
+}
+
+// hold records that a group of the given reader is handed over to the merge.
+func (m *MultiReader) hold(reader int, seq uint64, before Checkpoint) {
+	m.heldMu.Lock()
+	defer m.heldMu.Unlock()
+	m.held[reader] = append(m.held[reader], heldGroup{seq: seq, before: before})
+}
+
+// delivered records that a held group was delivered.
+func (m *MultiReader) delivered(reader int, seq uint64) {
+	m.heldMu.Lock()
+	defer m.heldMu.Unlock()
+	m.held[reader] = slices.DeleteFunc(m.held[reader], func(h heldGroup) bool { return h.seq == seq })
+}
+
+// timedGroup is a group of transactions waiting to be merged.
+type timedGroup struct {
+	txns    []Transaction
+	reader  int       // index of the reader in MultiReader.readers
+	seq     uint64    // position of the group in the reader's output
+	end     time.Time // see groupEnd
+	arrival time.Time
+}
+
+// Run reads every instance concurrently and calls handler with their groups
+// of transactions, each tagged with [Transaction.Instance]. handler is only
+// called from the goroutine running Run.
+//
+// Groups are held back for the merge window, and delivered in order of
+// completion time: the time of their last Timestamp record. A group is
+// delivered once a group that completed more than a window later was read,
+// or once it waited a window, whichever comes first. Groups without a
+// Timestamp record, e.g. with [LogReaderBuilder.SetRecordTags], are
+// delivered right away.
+//
+// Run returns nil once every reader stopped cleanly (see [LogReader.Run]),
+// after delivering the groups still held back. Otherwise it stops every
+// reader and returns ctx.Err() on cancellation, or the first error returned
+// by a reader or by handler.
+func (m *MultiReader) Run(ctx context.Context, handler func([]Transaction) error) error {
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	groups := make(chan timedGroup)
+	done := make(chan error, len(m.readers))
+	for i, r := range m.readers {
+		name := m.names[i]
+		go func() {
+			var seq uint64
+			err := r.Run(rctx, func(txns []Transaction) error {
+				for j := range txns {
+					txns[j].Instance = name
+				}
+				seq++
+				m.hold(i, seq, r.Checkpoint())
+				g := timedGroup{txns: txns, reader: i, seq: seq, end: groupEnd(txns), arrival: time.Now()}
+				select {
+				case groups <- g:
+					return nil
+				case <-rctx.Done():
+					return rctx.Err()
+				}
+			})
+			if err != nil && err != rctx.Err() {
+				err = fmt.Errorf("%s: %w", name, err)
+			} else {
+				err = nil
+			}
+			done <- err
+		}()
+	}
+
+	var tick <-chan time.Time
+	if m.window > 0 {
+		t := time.NewTicker(max(m.window/4, time.Millisecond))
+		defer t.Stop()
+		tick = t.C
+	}
+
+	var pending []timedGroup // by completion time
+	var latest time.Time     // latest completion time read
+	release := func(all bool) error {
+		now := time.Now()
+		for len(pending) > 0 {
+			g := pending[0]
+			if !all && g.end.After(latest.Add(-m.window)) && now.Sub(g.arrival) < m.window {
+				break
+			}
+			pending = pending[1:]
+			if err := handler(g.txns); err != nil {
+				return err
+			}
+			m.delivered(g.reader, g.seq)
+		}
+		return nil
+	}
+
+	var err error
+	for running := len(m.readers); running > 0; {
+		select {
+		case g := <-groups:
+			if err != nil {
+				continue
+			}
+			if g.end.After(latest) {
+				latest = g.end
+			}
+			i := sort.Search(len(pending), func(i int) bool { return pending[i].end.After(g.end) })
+			pending = slices.Insert(pending, i, g)
+			err = release(m.window == 0)
+		case <-tick:
+			if err == nil {
+				err = release(false)
+			}
+		case rerr := <-done:
+			running--
+			if err == nil {
+				err = rerr
+			}
+		}
+		if err != nil {
+			cancel()
+		}
+	}
+
+	switch {
+	case err != nil:
+		return err
+	case ctx.Err() != nil:
+		return ctx.Err()
+	}
+	return release(true)
+}
+
+// Close closes every reader.
+func (m *MultiReader) Close() {
+	for _, r := range m.readers {
+		r.Close()
+	}
+}
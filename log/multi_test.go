@@ -0,0 +1,195 @@
+package log_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+// copyFixture copies test1_log.bin to n files, standing for n instances.
+func copyFixture(t *testing.T, n int) []string {
+	t.Helper()
+	data, err := os.ReadFile(testBinPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for i := range n {
+		path := filepath.Join(t.TempDir(), string(rune('a'+i))+".bin")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func newMulti(paths ...string) *varnishlog.MultiReaderBuilder {
+	var builders []*varnishlog.LogReaderBuilder
+	for _, path := range paths {
+		builders = append(builders, varnishlog.New().SetFile(path).SetPureGo(true))
+	}
+	return varnishlog.NewMulti(builders...)
+}
+
+// groupTime returns the completion time of a group, the time of its last
+// Timestamp record.
+func groupTime(txns []varnishlog.Transaction) time.Time {
+	var end time.Time
+	for _, txn := range txns {
+		for _, rec := range txn.Records {
+			if ts, err := varnishlog.ParseTimestamp(rec.Data); rec.Tag == varnishlog.TagTimestamp && err == nil && ts.Abs.After(end) {
+				end = ts.Abs
+			}
+		}
+	}
+	return end
+}
+
+func TestMultiReader(t *testing.T) {
+	t.Parallel()
+	paths := copyFixture(t, 3)
+	m, err := newMulti(paths...).SetWindow(time.Hour).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if got := m.Instances(); len(got) != 3 || got[1] != paths[1] {
+		t.Errorf("Instances: got %v, want %v", got, paths)
+	}
+	if m.Reader(paths[2]) == nil || m.Reader("nope") != nil {
+		t.Error("Reader: unexpected result")
+	}
+
+	counts := map[string]int{}
+	var last time.Time
+	err = m.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		instance := txns[0].Instance
+		// the groups held back aren't part of the checkpoint yet
+		if cp := m.Checkpoint(instance); counts[instance] == 0 && !cp.IsZero() {
+			t.Errorf("%s: checkpoint %+v before the first group was delivered", instance, cp)
+		}
+		for _, txn := range txns {
+			counts[txn.Instance]++
+		}
+		// with a long window, everything is merged at the end
+		end := groupTime(txns)
+		if end.Before(last) {
+			t.Errorf("group %d of %s completed at %s, before the previous one (%s)", txns[0].VXID, instance, end, last)
+		}
+		last = end
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	for _, path := range paths {
+		if counts[path] != 8 {
+			t.Errorf("%s: got %d transactions, want 8", path, counts[path])
+		}
+		if cp := m.Checkpoint(path); cp.IsZero() {
+			t.Errorf("%s: no checkpoint after the run", path)
+		}
+	}
+	if cp := m.Checkpoint("nope"); !cp.IsZero() {
+		t.Errorf("Checkpoint of an unknown instance: got %+v", cp)
+	}
+
+	// resuming from the checkpoints delivers nothing more
+	var builders []*varnishlog.LogReaderBuilder
+	for _, path := range paths {
+		builders = append(builders, varnishlog.New().SetFile(path).SetPureGo(true).ResumeFrom(m.Checkpoint(path)))
+	}
+	resumed, err := varnishlog.NewMulti(builders...).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	err = resumed.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		t.Errorf("resumed reader delivered group %d of %s", txns[0].VXID, txns[0].Instance)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("resumed Run: %v", err)
+	}
+	if s := m.Reader(paths[0]).Stats(); s.Transactions != 8 {
+		t.Errorf("reader stats: got %d transactions, want 8", s.Transactions)
+	}
+}
+
+func TestMultiReaderNoWindow(t *testing.T) {
+	t.Parallel()
+	m, err := newMulti(copyFixture(t, 2)...).SetWindow(0).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var n int
+	err = m.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		n += len(txns)
+		return nil
+	})
+	if err != nil || n != 16 {
+		t.Errorf("got %d transactions and %v, want 16 and nil", n, err)
+	}
+}
+
+func TestMultiReaderErrors(t *testing.T) {
+	t.Parallel()
+	paths := copyFixture(t, 2)
+
+	// the handler's error stops every reader
+	m, err := newMulti(paths...).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Run(context.Background(), func([]varnishlog.Transaction) error { return errStop })
+	m.Close()
+	if err != errStop {
+		t.Errorf("handler error: got %v, want %v", err, errStop)
+	}
+
+	// so does a read error, which names the instance
+	missing := filepath.Join(t.TempDir(), "missing.bin")
+	m, err = newMulti(paths[0], missing).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Run(context.Background(), func([]varnishlog.Transaction) error { return nil })
+	m.Close()
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("read error: got %v, want an error about %s", err, missing)
+	}
+
+	// and cancellation
+	m, err = newMulti(paths...).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = m.Run(ctx, func([]varnishlog.Transaction) error { return nil })
+	m.Close()
+	if err != context.Canceled {
+		t.Errorf("cancelled: got %v, want %v", err, context.Canceled)
+	}
+
+	for name, b := range map[string]*varnishlog.MultiReaderBuilder{
+		"no readers":      varnishlog.NewMulti(),
+		"same instance":   newMulti(paths[0], paths[0]),
+		"negative window": newMulti(paths...).SetWindow(-time.Second),
+		"bad reader":      varnishlog.NewMulti(varnishlog.New().SetPureGo(true)),
+	} {
+		if m, err := b.Attach(); err == nil {
+			m.Close()
+			t.Errorf("%s: expected Attach to fail", name)
+		}
+	}
+}
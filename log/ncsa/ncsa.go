@@ -0,0 +1,635 @@
+// Format VSL transactions as access log lines (like varnishncsa)
+package ncsa
+
+// The main entry point is [New], which returns a [FormatterBuilder]. Configure
+// it with an optional format string and mode, then call [FormatterBuilder.Build]
+// to get a [Formatter]. Its [Formatter.Handler] plugs straight into
+// [log.LogReader.Run].
+//
+// # Usage
+//
+//	f, err := ncsa.New().
+//	    SetFormat(`%h %l %u %t "%r" %s %b %D %{Varnish:handling}x`).
+//	    Build()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+//	r, err := varnishlog.New().SetName("/tmp/my-varnish").Attach()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer r.Close()
+//
+//	err = r.Run(ctx, f.Handler(os.Stdout))
+//
+// # Format
+//
+// The format string follows varnishncsa(1). Supported directives:
+//
+//	%b  response body size in bytes, "-" when zero
+//	%D  time taken to serve the request, in microseconds
+//	%H  request protocol
+//	%h  remote host (client IP, or backend IP in backend mode)
+//	%I  total bytes received
+//	%{X}i  contents of request header X
+//	%l  remote logname, always "-"
+//	%m  request method
+//	%{X}o  contents of response header X
+//	%O  total bytes sent
+//	%q  query string, including the leading "?", empty if none
+//	%r  first line of the request
+//	%s  response status
+//	%t  time the request was received, in CLF format
+//	%{X}t  time the request was received, in strftime(3) format X
+//	%T  time taken to serve the request, in seconds
+//	%U  request URL without the query string
+//	%u  remote user from basic authentication
+//	%{Varnish:time_firstbyte}x  time until the first byte, in seconds
+//	%{Varnish:hitmiss}x  "hit" or "miss"
+//	%{Varnish:handling}x  "hit", "miss", "pass", "pipe" or "synth"
+//	%{Varnish:side}x  "c" for client transactions, "b" for backend ones
+//	%{Varnish:vxid}x  the transaction VXID
+//	%{VSL:Tag:Prefix[field]}x  first record with the given tag, optional
+//	    header prefix and optional 1-based whitespace-separated field
+//	%%  a literal percent sign
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// DefaultFormat is the format varnishncsa uses when none is given.
+const DefaultFormat = `%h %l %u %t "%r" %s %b "%{Referer}i" "%{User-agent}i"`
+
+// FormatterBuilder configures a [Formatter].
+// Obtain one with [New], configure with the Set* methods, then call [FormatterBuilder.Build].
+type FormatterBuilder struct {
+	format  string
+	backend bool
+	esi     bool
+	loc     *time.Location
+}
+
+// New returns a FormatterBuilder using [DefaultFormat] in client mode, with
+// times rendered in the local time zone.
+func New() *FormatterBuilder {
+	return &FormatterBuilder{format: DefaultFormat, loc: time.Local}
+}
+
+// SetFormat sets the varnishncsa format string.
+func (b *FormatterBuilder) SetFormat(format string) *FormatterBuilder {
+	b.format = format
+	return b
+}
+
+// SetBackend switches the Formatter to backend mode: lines are rendered for
+// backend transactions instead of client ones. Equivalent to varnishncsa's -b flag.
+func (b *FormatterBuilder) SetBackend(enable bool) *FormatterBuilder {
+	b.backend = enable
+	return b
+}
+
+// SetESI makes the Formatter render ESI subrequests too; they are skipped by
+// default. Equivalent to varnishncsa's -E flag. Has no effect in backend mode.
+func (b *FormatterBuilder) SetESI(enable bool) *FormatterBuilder {
+	b.esi = enable
+	return b
+}
+
+// SetLocation sets the time zone used by %t and %{X}t. Defaults to [time.Local].
+func (b *FormatterBuilder) SetLocation(loc *time.Location) *FormatterBuilder {
+	b.loc = loc
+	return b
+}
+
+// Build parses the format string and returns a [Formatter].
+func (b *FormatterBuilder) Build() (*Formatter, error) {
+	items, err := parseFormat(b.format)
+	if err != nil {
+		return nil, err
+	}
+	loc := b.loc
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Formatter{items: items, backend: b.backend, esi: b.esi, loc: loc}, nil
+}
+
+// Formatter renders transactions as access log lines. It is safe for concurrent use.
+type Formatter struct {
+	items   []item
+	backend bool
+	esi     bool
+	loc     *time.Location
+}
+
+// Format renders txn as a single line, without a trailing newline. It reports
+// false if txn is not a transaction this Formatter logs: client requests in
+// client mode (ESI subrequests only if [FormatterBuilder.SetESI] was used),
+// backend requests in backend mode.
+func (f *Formatter) Format(txn log.Transaction) (string, bool) {
+	if f.backend {
+		if txn.Type != log.TypeBackend {
+			return "", false
+		}
+	} else if txn.Type != log.TypeRequest || (txn.Reason == log.ReasonESI && !f.esi) {
+		return "", false
+	}
+
+	c := newFields(txn, f.backend)
+	var sb strings.Builder
+	for _, it := range f.items {
+		it(&sb, c, f)
+	}
+	return sb.String(), true
+}
+
+// Handler returns a function suitable for [log.LogReader.Run] that writes one
+// line per logged transaction to w. Any grouping works; transactions this
+// Formatter doesn't log are skipped.
+func (f *Formatter) Handler(w io.Writer) func([]log.Transaction) error {
+	return func(txns []log.Transaction) error {
+		for _, txn := range txns {
+			line, ok := f.Format(txn)
+			if !ok {
+				continue
+			}
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// fields holds the values extracted from a transaction that format items draw on.
+type fields struct {
+	txn      log.Transaction
+	backend  bool
+	method   string
+	url      string
+	proto    string
+	status   string
+	remote   string
+	start    time.Time
+	total    time.Duration // time to the end of the response
+	ttfb     time.Duration // time to the first byte
+	acct     log.Acct
+	hasAcct  bool
+	reqHdr   map[string]string
+	respHdr  map[string]string
+	hitmiss  string
+	handling string
+	hasTotal bool
+	hasTTFB  bool
+}
+
+func newFields(txn log.Transaction, backend bool) *fields {
+	c := &fields{
+		txn:     txn,
+		backend: backend,
+		reqHdr:  map[string]string{},
+		respHdr: map[string]string{},
+	}
+	methodTag, urlTag, protoTag, statusTag := log.TagReqMethod, log.TagReqURL, log.TagReqProtocol, log.TagRespStatus
+	reqHdrTag, respHdrTag, acctTag := log.TagReqHeader, log.TagRespHeader, log.TagReqAcct
+	reqUnsetTag, respUnsetTag := log.TagReqUnset, log.TagRespUnset
+	totalLabel, ttfbLabel := "Resp", "Process"
+	if backend {
+		methodTag, urlTag, protoTag, statusTag = log.TagBereqMethod, log.TagBereqURL, log.TagBereqProtocol, log.TagBerespStatus
+		reqHdrTag, respHdrTag, acctTag = log.TagBereqHeader, log.TagBerespHeader, log.TagBereqAcct
+		reqUnsetTag, respUnsetTag = log.TagBereqUnset, log.TagBerespUnset
+		totalLabel, ttfbLabel = "BerespBody", "Beresp"
+	}
+
+	for _, rec := range txn.Records {
+		switch {
+		case rec.Tag == 0:
+			// unsupported tags are zero and must never match
+		case rec.Tag == methodTag:
+			c.method = rec.Data
+		case rec.Tag == urlTag:
+			c.url = rec.Data
+		case rec.Tag == protoTag:
+			c.proto = rec.Data
+		case rec.Tag == statusTag:
+			c.status = rec.Data
+		case rec.Tag == reqHdrTag, rec.Tag == respHdrTag, rec.Tag == reqUnsetTag, rec.Tag == respUnsetTag:
+			h, err := log.ParseHeader(rec.Data)
+			if err != nil {
+				continue
+			}
+			m := c.reqHdr
+			if rec.Tag == respHdrTag || rec.Tag == respUnsetTag {
+				m = c.respHdr
+			}
+			// like varnishncsa, an unset clears the header whatever its value
+			if rec.Tag == reqUnsetTag || rec.Tag == respUnsetTag {
+				delete(m, strings.ToLower(h.Name))
+			} else {
+				m[strings.ToLower(h.Name)] = h.Value
+			}
+		case rec.Tag == acctTag:
+			var err error
+			if backend {
+				c.acct, err = log.ParseBereqAcct(rec.Data)
+			} else {
+				c.acct, err = log.ParseReqAcct(rec.Data)
+			}
+			c.hasAcct = err == nil
+		case rec.Tag == log.TagTimestamp:
+			ts, err := log.ParseTimestamp(rec.Data)
+			if err != nil {
+				continue
+			}
+			switch ts.Label {
+			case "Start":
+				c.start = ts.Abs
+			case totalLabel:
+				c.total, c.hasTotal = ts.SinceStart, true
+			case ttfbLabel:
+				c.ttfb, c.hasTTFB = ts.SinceStart, true
+			}
+		case !backend && rec.Tag == log.TagReqStart:
+			if rs, err := log.ParseReqStart(rec.Data); err == nil {
+				c.remote = rs.ClientAddr
+			}
+		case backend && rec.Tag == log.TagBackendOpen:
+			if bo, err := log.ParseBackendOpen(rec.Data); err == nil {
+				c.remote = bo.RemoteAddr
+			}
+		case !backend && rec.Tag == log.TagVCLCall:
+			switch strings.ToLower(rec.Data) {
+			case "hit":
+				c.hitmiss, c.handling = "hit", "hit"
+			case "miss":
+				c.hitmiss, c.handling = "miss", "miss"
+			case "pass":
+				c.hitmiss, c.handling = "miss", "pass"
+			case "synth":
+				// Arguably, synth isn't a hit or a miss, but miss is less wrong
+				c.hitmiss, c.handling = "miss", "synth"
+			}
+		case !backend && rec.Tag == log.TagVCLReturn:
+			if strings.EqualFold(rec.Data, "pipe") {
+				c.hitmiss, c.handling = "miss", "pipe"
+			}
+		}
+	}
+	return c
+}
+
+// item renders one piece of a formatted line.
+type item func(sb *strings.Builder, c *fields, f *Formatter)
+
+func literal(s string) item {
+	return func(sb *strings.Builder, _ *fields, _ *Formatter) { sb.WriteString(s) }
+}
+
+func parseFormat(format string) ([]item, error) {
+	var items []item
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			items = append(items, literal(lit.String()))
+			lit.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		if ch != '%' {
+			lit.WriteByte(ch)
+			continue
+		}
+		i++
+		if i >= len(format) {
+			return nil, fmt.Errorf("format %q: trailing %%", format)
+		}
+		var arg string
+		if format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("format %q: unterminated %%{", format)
+			}
+			arg = format[i+1 : i+end]
+			i += end + 1
+			if i >= len(format) {
+				return nil, fmt.Errorf("format %q: missing directive after %%{%s}", format, arg)
+			}
+		}
+		if format[i] == '%' && arg == "" {
+			lit.WriteByte('%')
+			continue
+		}
+		it, err := directive(format[i], arg)
+		if err != nil {
+			return nil, fmt.Errorf("format %q: %w", format, err)
+		}
+		flush()
+		items = append(items, it)
+	}
+	flush()
+	return items, nil
+}
+
+func directive(d byte, arg string) (item, error) {
+	simple := func(fn func(c *fields, f *Formatter) string) item {
+		return func(sb *strings.Builder, c *fields, f *Formatter) { sb.WriteString(fn(c, f)) }
+	}
+	if arg != "" && d != 'i' && d != 'o' && d != 't' && d != 'x' {
+		return nil, fmt.Errorf("%%%c does not take an argument", d)
+	}
+
+	switch d {
+	case 'b':
+		return simple(func(c *fields, _ *Formatter) string {
+			if !c.hasAcct || bodyBytes(c) == 0 {
+				return "-"
+			}
+			return strconv.FormatInt(bodyBytes(c), 10)
+		}), nil
+	case 'D':
+		return simple(func(c *fields, _ *Formatter) string {
+			if !c.hasTotal {
+				return "-"
+			}
+			return strconv.FormatInt(c.total.Microseconds(), 10)
+		}), nil
+	case 'H':
+		return simple(func(c *fields, _ *Formatter) string { return orDash(c.proto) }), nil
+	case 'h':
+		return simple(func(c *fields, _ *Formatter) string { return orDash(c.remote) }), nil
+	case 'I':
+		return simple(func(c *fields, _ *Formatter) string {
+			if !c.hasAcct {
+				return "-"
+			}
+			return strconv.FormatInt(c.acct.TotalRx, 10)
+		}), nil
+	case 'i':
+		if arg == "" {
+			return nil, fmt.Errorf("%%i requires a header name")
+		}
+		name := strings.ToLower(arg)
+		return simple(func(c *fields, _ *Formatter) string { return headerOrDash(c.reqHdr, name) }), nil
+	case 'l':
+		return literal("-"), nil
+	case 'm':
+		return simple(func(c *fields, _ *Formatter) string { return orDash(c.method) }), nil
+	case 'o':
+		if arg == "" {
+			return nil, fmt.Errorf("%%o requires a header name")
+		}
+		name := strings.ToLower(arg)
+		return simple(func(c *fields, _ *Formatter) string { return headerOrDash(c.respHdr, name) }), nil
+	case 'O':
+		return simple(func(c *fields, _ *Formatter) string {
+			if !c.hasAcct {
+				return "-"
+			}
+			return strconv.FormatInt(c.acct.TotalTx, 10)
+		}), nil
+	case 'q':
+		return simple(func(c *fields, _ *Formatter) string {
+			if i := strings.IndexByte(c.url, '?'); i >= 0 {
+				return c.url[i:]
+			}
+			return ""
+		}), nil
+	case 'r':
+		return simple(func(c *fields, _ *Formatter) string {
+			method, host, proto := c.method, c.reqHdr["host"], c.proto
+			if method == "" {
+				method = "-"
+			}
+			if host == "" {
+				host = "localhost"
+			}
+			if proto == "" {
+				proto = "HTTP/1.0"
+			}
+			return method + " http://" + host + orDash(c.url) + " " + proto
+		}), nil
+	case 's':
+		return simple(func(c *fields, _ *Formatter) string { return orDash(c.status) }), nil
+	case 't':
+		format := func(t time.Time) string { return t.Format("[02/Jan/2006:15:04:05 -0700]") }
+		if arg != "" {
+			format = strftime(arg)
+		}
+		return simple(func(c *fields, f *Formatter) string {
+			if c.start.IsZero() {
+				return "-"
+			}
+			return format(c.start.In(f.loc))
+		}), nil
+	case 'T':
+		return simple(func(c *fields, _ *Formatter) string {
+			if !c.hasTotal {
+				return "-"
+			}
+			return strconv.FormatInt(int64(c.total/time.Second), 10)
+		}), nil
+	case 'U':
+		return simple(func(c *fields, _ *Formatter) string {
+			u, _, _ := strings.Cut(c.url, "?")
+			return orDash(u)
+		}), nil
+	case 'u':
+		return simple(func(c *fields, _ *Formatter) string { return basicAuthUser(c.reqHdr["authorization"]) }), nil
+	case 'x':
+		return extended(arg)
+	default:
+		return nil, fmt.Errorf("unknown directive %%%c", d)
+	}
+}
+
+// extended handles the %{...}x directives.
+func extended(arg string) (item, error) {
+	str := func(fn func(c *fields) string) item {
+		return func(sb *strings.Builder, c *fields, _ *Formatter) { sb.WriteString(fn(c)) }
+	}
+	switch arg {
+	case "Varnish:time_firstbyte":
+		return str(func(c *fields) string {
+			if !c.hasTTFB {
+				return "-"
+			}
+			return strconv.FormatFloat(c.ttfb.Seconds(), 'f', 6, 64)
+		}), nil
+	case "Varnish:hitmiss":
+		return str(func(c *fields) string { return orDash(c.hitmiss) }), nil
+	case "Varnish:handling":
+		return str(func(c *fields) string { return orDash(c.handling) }), nil
+	case "Varnish:side":
+		return str(func(c *fields) string {
+			if c.backend {
+				return "b"
+			}
+			return "c"
+		}), nil
+	case "Varnish:vxid":
+		return str(func(c *fields) string { return strconv.FormatInt(c.txn.VXID, 10) }), nil
+	}
+
+	spec, ok := strings.CutPrefix(arg, "VSL:")
+	if !ok {
+		return nil, fmt.Errorf("unknown extended directive %%{%s}x", arg)
+	}
+	field := 0
+	if i := strings.IndexByte(spec, '['); i >= 0 {
+		if !strings.HasSuffix(spec, "]") {
+			return nil, fmt.Errorf("%%{%s}x: unterminated field index", arg)
+		}
+		n, err := strconv.Atoi(spec[i+1 : len(spec)-1])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%%{%s}x: invalid field index", arg)
+		}
+		field = n
+		spec = spec[:i]
+	}
+	tagName, prefix, _ := strings.Cut(spec, ":")
+	tag, err := log.TagByName(tagName)
+	if err != nil {
+		return nil, fmt.Errorf("%%{%s}x: %w", arg, err)
+	}
+	return str(func(c *fields) string {
+		for _, rec := range c.txn.Records {
+			if rec.Tag != tag {
+				continue
+			}
+			data := rec.Data
+			if prefix != "" {
+				name, value, ok := strings.Cut(data, ":")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), prefix) {
+					continue
+				}
+				data = strings.TrimSpace(value)
+			}
+			if field == 0 {
+				return data
+			}
+			f := strings.Fields(data)
+			if field > len(f) {
+				return "-"
+			}
+			return f[field-1]
+		}
+		return "-"
+	}), nil
+}
+
+func bodyBytes(c *fields) int64 {
+	if c.backend {
+		return c.acct.BodyRx
+	}
+	return c.acct.BodyTx
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func headerOrDash(m map[string]string, name string) string {
+	if v, ok := m[name]; ok {
+		return v
+	}
+	return "-"
+}
+
+// basicAuthUser extracts the user name from a basic Authorization header.
+func basicAuthUser(h string) string {
+	scheme, cred, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "basic") {
+		return "-"
+	}
+	dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(cred))
+	if err != nil {
+		return "-"
+	}
+	user, _, _ := strings.Cut(string(dec), ":")
+	return orDash(user)
+}
+
+// strftime compiles a strftime(3) format: the common conversions are
+// rendered with the equivalent Go time layout, one at a time so that the text
+// around them isn't mistaken for layout elements. Unknown conversions are
+// copied verbatim.
+func strftime(f string) func(time.Time) string {
+	type piece struct {
+		layout  string // Go layout of a conversion
+		literal string // or text copied as is
+	}
+	var pieces []piece
+	var lit strings.Builder
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' || i+1 == len(f) {
+			lit.WriteByte(f[i])
+			continue
+		}
+		i++
+		layout := strftimeLayouts[f[i]]
+		if layout == "" {
+			lit.WriteByte('%')
+			if f[i] != '%' {
+				lit.WriteByte(f[i])
+			}
+			continue
+		}
+		if lit.Len() > 0 {
+			pieces = append(pieces, piece{literal: lit.String()})
+			lit.Reset()
+		}
+		pieces = append(pieces, piece{layout: layout})
+	}
+	if lit.Len() > 0 {
+		pieces = append(pieces, piece{literal: lit.String()})
+	}
+	return func(t time.Time) string {
+		var sb strings.Builder
+		for _, p := range pieces {
+			if p.layout == "" {
+				sb.WriteString(p.literal)
+			} else {
+				sb.WriteString(t.Format(p.layout))
+			}
+		}
+		return sb.String()
+	}
+}
+
+// strftimeLayouts maps the strftime(3) conversions strftime supports to Go
+// time layouts.
+var strftimeLayouts = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'd': "02",
+	'e': "_2",
+	'F': "2006-01-02",
+	'H': "15",
+	'I': "03",
+	'j': "002",
+	'm': "01",
+	'M': "04",
+	'p': "PM",
+	'S': "05",
+	'T': "15:04:05",
+	'y': "06",
+	'Y': "2006",
+	'z': "-0700",
+	'Z': "MST",
+}
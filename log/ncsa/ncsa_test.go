@@ -0,0 +1,189 @@
+package ncsa_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+	"github.com/varnish/varnish-go/log/ncsa"
+	"github.com/varnish/varnish-go/version"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// extendedFormat exercises every directive that has a stable value in test1_log.bin.
+const extendedFormat = `%{Varnish:vxid}x %{Varnish:side}x %m %U%q %H %s %b %I %O %D %T ` +
+	`%{Varnish:time_firstbyte}x %{Varnish:handling}x %{Varnish:hitmiss}x %{X-Varnish}o ` +
+	`%{VSL:Timestamp:Start[1]}x %{VSL:VCL_call}x %{%Y-%m-%dT%H:%M:%S}t %%`
+
+// render runs the formatter over test1_log.bin, using VXID grouping like varnishncsa.
+func render(t *testing.T, f *ncsa.Formatter) string {
+	t.Helper()
+	if version.IsEnterprise() {
+		t.Skip("test1_log.bin not compatible with Varnish Plus")
+	}
+	r, err := varnishlog.New().
+		SetGrouping(varnishlog.GroupingVXID).
+		SetFile(filepath.Join("..", "testdata", "test1_log.bin")).
+		Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if err := r.Run(context.Background(), f.Handler(&buf)); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return buf.String()
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: output mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		name    string
+		format  string
+		backend bool
+	}{
+		{"client", ncsa.DefaultFormat, false},
+		{"backend", ncsa.DefaultFormat, true},
+		{"client_extended", extendedFormat, false},
+		{"backend_extended", extendedFormat, true},
+		// literals around time conversions aren't layout elements
+		{"client_literal", "%{Varnish:vxid}x %{week 1 %Y at %H:%M:%S}t", false},
+		// Via is unset from the responses of VXIDs 2 and 32772
+		{"client_unset", "%{Varnish:vxid}x %{Via}o", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			f, err := ncsa.New().
+				SetFormat(tt.format).
+				SetBackend(tt.backend).
+				SetLocation(time.UTC).
+				Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name, render(t, f))
+		})
+	}
+}
+
+func TestFormatSkipsOtherTransactions(t *testing.T) {
+	t.Parallel()
+	f, err := ncsa.New().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range []varnishlog.Transaction{
+		{Type: varnishlog.TypeSession},
+		{Type: varnishlog.TypeBackend},
+		{Type: varnishlog.TypeRequest, Reason: varnishlog.ReasonESI},
+	} {
+		if line, ok := f.Format(txn); ok {
+			t.Errorf("Format(%v/%v): expected the transaction to be skipped, got %q", txn.Type, txn.Reason, line)
+		}
+	}
+
+	f, err = ncsa.New().SetESI(true).SetFormat("%{Varnish:vxid}x").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, ok := f.Format(varnishlog.Transaction{VXID: 7, Type: varnishlog.TypeRequest, Reason: varnishlog.ReasonESI})
+	if !ok || line != "7" {
+		t.Errorf("Format with SetESI: got %q, %v, want \"7\", true", line, ok)
+	}
+}
+
+func TestFormatUnsetHeaders(t *testing.T) {
+	t.Parallel()
+	rec := func(tag varnishlog.Tag, data string) varnishlog.Record {
+		return varnishlog.Record{Tag: tag, Data: data}
+	}
+	for _, tt := range []struct {
+		backend bool
+		records []varnishlog.Record
+		want    string
+	}{
+		{false, []varnishlog.Record{
+			rec(varnishlog.TagReqHeader, "Cookie: a=1"),
+			rec(varnishlog.TagRespHeader, "Via: 1.1 varnish"),
+			rec(varnishlog.TagReqUnset, "cookie: a=1"),
+			rec(varnishlog.TagRespUnset, "Via: 1.1 varnish"),
+		}, "- -"},
+		{false, []varnishlog.Record{
+			rec(varnishlog.TagReqHeader, "Cookie: a=1"),
+			rec(varnishlog.TagReqUnset, "Cookie: a=1"),
+			rec(varnishlog.TagReqHeader, "Cookie: b=2"),
+		}, "b=2 -"},
+		{true, []varnishlog.Record{
+			rec(varnishlog.TagBereqHeader, "Cookie: a=1"),
+			rec(varnishlog.TagBerespHeader, "Via: 1.1 backend"),
+			rec(varnishlog.TagBereqUnset, "Cookie: a=1"),
+		}, "- 1.1 backend"},
+		{true, []varnishlog.Record{
+			rec(varnishlog.TagBereqHeader, "Cookie: a=1"),
+			rec(varnishlog.TagBerespHeader, "Via: 1.1 backend"),
+			rec(varnishlog.TagBerespUnset, "Via: 1.1 backend"),
+		}, "a=1 -"},
+	} {
+		f, err := ncsa.New().SetFormat("%{Cookie}i %{Via}o").SetBackend(tt.backend).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		txn := varnishlog.Transaction{Type: varnishlog.TypeRequest, Records: tt.records}
+		if tt.backend {
+			txn.Type = varnishlog.TypeBackend
+		}
+		if line, _ := f.Format(txn); line != tt.want {
+			t.Errorf("Format(%v): got %q, want %q", tt.records, line, tt.want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	t.Parallel()
+	for _, format := range []string{
+		"%",
+		"%{Referer",
+		"%{Referer}",
+		"%i",
+		"%o",
+		"%{foo}s",
+		"%Z",
+		"%{Varnish:nope}x",
+		"%{VSL:NoSuchTag}x",
+		"%{VSL:ReqURL[0]}x",
+		"%{VSL:ReqURL[1}x",
+	} {
+		if _, err := ncsa.New().SetFormat(format).Build(); err == nil {
+			t.Errorf("Build(%q): expected an error", format)
+		} else if !strings.Contains(err.Error(), "format") {
+			t.Errorf("Build(%q): error %q does not mention the format", format, err)
+		}
+	}
+}
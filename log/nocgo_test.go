@@ -0,0 +1,58 @@
+package log_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+// TestBuildWithoutCgo builds a program reading test1_log.bin with SetPureGo
+// with CGO_ENABLED=0, and checks that it resolves the tags and groups the
+// transactions like the package does here.
+func TestBuildWithoutCgo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	skipIfEnterprise(t)
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	bin := filepath.Join(t.TempDir(), "nocgo")
+	cmd := exec.Command(gobin, "build", "-o", bin, "./testdata/nocgo")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	got, err := exec.Command(bin, testBinPath()).Output()
+	if err != nil {
+		t.Fatalf("nocgo: %v", err)
+	}
+
+	r, err := varnishlog.New().SetFile(testBinPath()).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var want strings.Builder
+	err = r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		for _, t := range txns {
+			for _, rec := range t.Records {
+				fmt.Fprintf(&want, "%d %s %s %s\n", t.VXID, t.Type, rec.Tag, rec.Data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if string(got) != want.String() {
+		t.Errorf("without cgo:\n%s\nwith cgo:\n%s", got, want.String())
+	}
+}
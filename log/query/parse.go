@@ -0,0 +1,494 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// token is a lexical token of a query. kind is "VAL" for strings and bare
+// words, "EOI" at the end of a line, and the token text itself for operators,
+// punctuation and keywords.
+type token struct {
+	kind string
+	val  string // decoded value of VAL tokens
+	off  int    // offset in the query
+}
+
+// isWord matches the characters allowed in bare words, like vxp_lexer.c.
+func isWord(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '+' || c == '.' || c == '*'
+}
+
+var keywords = map[string]bool{"and": true, "or": true, "not": true, "eq": true, "ne": true, "vxid": true}
+
+// fixedTokens are tried in order, so two-character operators come first.
+var fixedTokens = []string{"==", "!=", "<=", ">=", "!~", "<", ">", "~", "(", ")", "[", "]", "{", "}", ":", ","}
+
+func lex(q string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case c == '\\' && i+1 < len(q) && q[i+1] == '\n':
+			i += 2
+			continue
+		case c == '#':
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '\n':
+			toks = append(toks, token{kind: "EOI", off: i})
+			i++
+			continue
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(q) && q[j] != c && q[j] != '\n'; j++ {
+				if q[j] == '\\' && j+1 < len(q) && (q[j+1] == c || q[j+1] == '\\') {
+					j++
+				}
+				sb.WriteByte(q[j])
+			}
+			if j == len(q) || q[j] != c {
+				return nil, errorAt(q, i, "unterminated string")
+			}
+			toks = append(toks, token{kind: "VAL", val: sb.String(), off: i})
+			i = j + 1
+			continue
+		case isWord(c):
+			j := i
+			for j < len(q) && isWord(q[j]) {
+				j++
+			}
+			w := q[i:j]
+			if keywords[w] {
+				toks = append(toks, token{kind: w, off: i})
+			} else {
+				toks = append(toks, token{kind: "VAL", val: w, off: i})
+			}
+			i = j
+			continue
+		}
+		matched := false
+		for _, f := range fixedTokens {
+			if strings.HasPrefix(q[i:], f) {
+				toks = append(toks, token{kind: f, off: i})
+				i += len(f)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, errorAt(q, i, fmt.Sprintf("syntax error at %q", q[i:i+1]))
+		}
+	}
+	return append(toks, token{kind: "EOI", off: len(q)}), nil
+}
+
+func errorAt(q string, off int, msg string) error {
+	return fmt.Errorf("query %q: %s (offset %d)", q, msg, off)
+}
+
+type parser struct {
+	q    string
+	toks []token
+	pos  int
+}
+
+func (p *parser) tok() token { return p.toks[p.pos] }
+func (p *parser) next()      { p.pos++ }
+
+func (p *parser) errorf(format string, args ...any) error {
+	return errorAt(p.q, p.tok().off, fmt.Sprintf(format, args...))
+}
+
+// describe renders the current token for error messages.
+func (p *parser) describe() string {
+	t := p.tok()
+	switch t.kind {
+	case "EOI":
+		return "end of query"
+	case "VAL":
+		return strconv.Quote(t.val)
+	default:
+		return strconv.Quote(t.kind)
+	}
+}
+
+// parse compiles every line of q. Empty lines and comments are skipped.
+func parse(q string) ([]expr, error) {
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{q: q, toks: toks}
+	var exprs []expr
+	for p.pos < len(p.toks) {
+		if p.tok().kind == "EOI" {
+			p.next()
+			continue
+		}
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok().kind != "EOI" {
+			return nil, p.errorf("expected end of query, got %s", p.describe())
+		}
+		exprs = append(exprs, e)
+	}
+	if len(exprs) == 0 {
+		return nil, errorAt(q, 0, "empty query")
+	}
+	return exprs, nil
+}
+
+func (p *parser) or() (expr, error) {
+	a, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok().kind == "or" {
+		p.next()
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		a = orExpr{a, b}
+	}
+	return a, nil
+}
+
+func (p *parser) and() (expr, error) {
+	a, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok().kind == "and" {
+		p.next()
+		b, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		a = andExpr{a, b}
+	}
+	return a, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.tok().kind != "not" {
+		return p.group()
+	}
+	p.next()
+	a, err := p.group()
+	if err != nil {
+		return nil, err
+	}
+	return notExpr{a}, nil
+}
+
+func (p *parser) group() (expr, error) {
+	if p.tok().kind != "(" {
+		return p.cmp()
+	}
+	p.next()
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok().kind != ")" {
+		return nil, p.errorf("expected \")\", got %s", p.describe())
+	}
+	p.next()
+	return e, nil
+}
+
+func (p *parser) cmp() (expr, error) {
+	e := &cmpExpr{}
+	if err := p.lhs(&e.lhs); err != nil {
+		return nil, err
+	}
+
+	switch p.tok().kind {
+	case "EOI", "and", "or", ")":
+		if e.lhs.vxid {
+			return nil, p.errorf("expected vxid operator, got %s", p.describe())
+		}
+		e.op = opTrue
+		return e, nil
+	case "==":
+		e.op = opEq
+	case "!=":
+		e.op = opNeq
+	case "<":
+		e.op = opLt
+	case "<=":
+		e.op = opLeq
+	case ">":
+		e.op = opGt
+	case ">=":
+		e.op = opGeq
+	case "eq":
+		e.op = opSeq
+	case "ne":
+		e.op = opSneq
+	case "~":
+		e.op = opMatch
+	case "!~":
+		e.op = opNomatch
+	default:
+		return nil, p.errorf("expected operator, got %s", p.describe())
+	}
+	if e.lhs.vxid && e.op > opGeq {
+		return nil, p.errorf("expected vxid operator, got %s", p.describe())
+	}
+	p.next()
+
+	switch e.op {
+	case opSeq, opSneq:
+		if p.tok().kind != "VAL" {
+			return nil, p.errorf("expected string, got %s", p.describe())
+		}
+		e.str = p.tok().val
+	case opMatch, opNomatch:
+		if p.tok().kind != "VAL" {
+			return nil, p.errorf("expected regular expression, got %s", p.describe())
+		}
+		re, err := regexp.Compile(p.tok().val)
+		if err != nil {
+			return nil, p.errorf("regular expression error: %v", err)
+		}
+		e.re = re
+	default:
+		if p.tok().kind != "VAL" {
+			return nil, p.errorf("expected number, got %s", p.describe())
+		}
+		s := p.tok().val
+		if strings.Contains(s, ".") {
+			if e.lhs.vxid {
+				return nil, p.errorf("expected integer, got %q", s)
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || math.IsNaN(f) {
+				return nil, p.errorf("floating point parse error: %q", s)
+			}
+			e.isFloat, e.f = true, f
+		} else {
+			i, rest, ok := parseIntPrefix(s)
+			if !ok || strings.TrimLeft(rest, spaces) != "" {
+				return nil, p.errorf("integer parse error: %q", s)
+			}
+			e.i = i
+		}
+	}
+	p.next()
+	return e, nil
+}
+
+func (p *parser) lhs(l *lhs) error {
+	l.level = -1
+	if p.tok().kind == "{" {
+		p.next()
+		if p.tok().kind != "VAL" {
+			return p.errorf("expected integer, got %s", p.describe())
+		}
+		s := p.tok().val
+		switch {
+		case strings.HasSuffix(s, "+"):
+			l.levelPM, s = 1, s[:len(s)-1]
+		case strings.HasSuffix(s, "-"):
+			l.levelPM, s = -1, s[:len(s)-1]
+		}
+		n, rest, ok := parseIntPrefix(s)
+		if !ok || rest != "" || n < 0 || n > math.MaxInt32 {
+			return p.errorf("syntax error in level limit: %q", p.tok().val)
+		}
+		l.level = int(n)
+		p.next()
+		if p.tok().kind != "}" {
+			return p.errorf("expected \"}\", got %s", p.describe())
+		}
+		p.next()
+	}
+
+	if p.tok().kind == "vxid" {
+		l.vxid = true
+		p.next()
+		return nil
+	}
+
+	l.tags = map[log.Tag]bool{}
+	for {
+		if p.tok().kind != "VAL" {
+			return p.errorf("expected VSL tag name, got %s", p.describe())
+		}
+		tags, err := globTags(p.tok().val)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		for _, t := range tags {
+			l.tags[t] = true
+		}
+		p.next()
+		if p.tok().kind != "," {
+			break
+		}
+		p.next()
+	}
+
+	if p.tok().kind == ":" {
+		p.next()
+		if p.tok().kind != "VAL" {
+			return p.errorf("expected string, got %s", p.describe())
+		}
+		l.prefix = p.tok().val
+		p.next()
+	}
+
+	if p.tok().kind == "[" {
+		p.next()
+		if p.tok().kind != "VAL" {
+			return p.errorf("expected integer, got %s", p.describe())
+		}
+		n, rest, ok := parseIntPrefix(p.tok().val)
+		if !ok || rest != "" || n <= 0 || n > math.MaxInt32 {
+			return p.errorf("expected positive integer, got %q", p.tok().val)
+		}
+		l.field = int(n)
+		p.next()
+		if p.tok().kind != "]" {
+			return p.errorf("expected \"]\", got %s", p.describe())
+		}
+		p.next()
+	}
+	return nil
+}
+
+// globTags resolves a tag name or glob like VSL_Glob2Tags: a single "*" may
+// start or end the pattern, names are compared case-insensitively, and plain
+// names may be abbreviated as long as they stay unambiguous.
+func globTags(glob string) ([]log.Tag, error) {
+	star := strings.IndexByte(glob, '*')
+	if star < 0 {
+		t, err := log.TagByName(glob)
+		if err != nil {
+			return nil, err
+		}
+		return []log.Tag{t}, nil
+	}
+	if strings.Count(glob, "*") > 1 || (star != 0 && star != len(glob)-1) {
+		return nil, fmt.Errorf("syntax error in tag name %q", glob)
+	}
+
+	lower := strings.ToLower(glob)
+	var tags []log.Tag
+	for _, t := range log.Tags() {
+		name := strings.ToLower(t.String())
+		if (star == 0 && strings.HasSuffix(name, lower[1:])) ||
+			(star != 0 && strings.HasPrefix(name, lower[:star])) {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("tag name %q matches zero tags", glob)
+	}
+	return tags, nil
+}
+
+// parseIntPrefix parses the integer at the start of s like strtoll(3) with
+// base 0: decimal, 0x hexadecimal or 0 octal. It returns the rest of s, and
+// false if s doesn't start with a number. Out of range values saturate.
+func parseIntPrefix(s string) (int64, string, bool) {
+	i := 0
+	neg := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		neg = s[i] == '-'
+		i++
+	}
+	base := 10
+	if i+2 < len(s) && s[i] == '0' && (s[i+1] == 'x' || s[i+1] == 'X') && digitVal(s[i+2]) < 16 {
+		base = 16
+		i += 2
+	} else if i < len(s) && s[i] == '0' {
+		base = 8
+	}
+	start := i
+	for i < len(s) && digitVal(s[i]) < base {
+		i++
+	}
+	if i == start {
+		return 0, s, false
+	}
+	u, err := strconv.ParseUint(s[start:i], base, 64)
+	switch {
+	case neg && (err != nil || u > 1<<63):
+		return math.MinInt64, s[i:], true
+	case neg:
+		return -int64(u), s[i:], true
+	case err != nil || u > math.MaxInt64:
+		return math.MaxInt64, s[i:], true
+	}
+	return int64(u), s[i:], true
+}
+
+func digitVal(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 99
+}
+
+// parseFloatPrefix parses the decimal number at the start of s like strtod(3),
+// returning the rest of s.
+func parseFloatPrefix(s string) (float64, string, bool) {
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	digits := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+		digits++
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, s, false
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			i = j
+		}
+	}
+	// s[:i] is a valid decimal number: ParseFloat can only fail with a range
+	// error, and then returns ±Inf or 0 like strtod does
+	f, _ := strconv.ParseFloat(s[:i], 64)
+	return f, s[i:], true
+}
@@ -0,0 +1,302 @@
+// Evaluate VSL queries (see vsl-query(7)) against transactions in Go
+package query
+
+// [log.LogReaderBuilder.SetQuery] hands the query to libvarnishapi, which only
+// reports syntax errors on Attach and only filters live or file streams. This
+// package implements the same query language in Go, so queries can be checked
+// ahead of time and applied to transactions that were already collected.
+//
+// # Usage
+//
+//	q, err := query.Compile(`ReqURL ~ "^/api" and RespStatus >= 500`)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, txn := range txns {
+//	    if q.Match(txn) {
+//	        fmt.Println(txn.VXID)
+//	    }
+//	}
+//
+// # Syntax
+//
+// A query compares records of the transaction, selected by tag, to a value:
+//
+//	{level} taglist:prefix[field] operator operand
+//
+//   - taglist is a comma-separated list of tag names or globs (Req*, *Header),
+//     or the vxid keyword to test the transaction ID.
+//   - :prefix only selects records starting with "prefix:" (case-insensitive),
+//     typically a header name, and strips it from the value.
+//   - [field] selects the n-th whitespace-separated field of the value, from 1.
+//   - {level} restricts the test to transactions of that level in the group
+//     (the root transaction is level 1); {level+} also selects the deeper
+//     levels, {level-} the shallower ones.
+//   - ==, !=, <, <=, >, >= compare numbers: the operand is an integer, or a
+//     float if it contains a dot. eq and ne compare strings, ~ and !~ test a
+//     regular expression.
+//
+// Without an operator, the query matches if a selected record exists.
+// Comparisons can be combined with not, and, or (in decreasing precedence) and
+// parentheses. Several queries can be given on separate lines: a transaction
+// matches if any of them does. "#" starts a comment.
+//
+// A comparison matches if any selected record satisfies it, so `RespStatus != 200`
+// matches transactions with at least one status that isn't 200, and doesn't
+// match transactions without a status at all.
+//
+// Regular expressions use Go's [regexp] syntax rather than PCRE; the common
+// subset behaves the same.
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/varnish/varnish-go/log"
+)
+
+// Query is a compiled VSL query. It is safe for concurrent use.
+type Query struct {
+	src   string
+	exprs []expr // one per line, or-ed together
+}
+
+// Compile parses a VSL query.
+func Compile(q string) (*Query, error) {
+	exprs, err := parse(q)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{src: q, exprs: exprs}, nil
+}
+
+// MustCompile is like [Compile] but panics if the query can't be parsed.
+func MustCompile(q string) *Query {
+	query, err := Compile(q)
+	if err != nil {
+		panic(err)
+	}
+	return query
+}
+
+// String returns the source of the query.
+func (q *Query) String() string { return q.src }
+
+// Match reports whether txn, taken on its own, matches the query. Use it with
+// transactions delivered with [log.GroupingRaw] or [log.GroupingVXID].
+func (q *Query) Match(txn log.Transaction) bool {
+	return q.MatchGroup([]log.Transaction{txn})
+}
+
+// MatchGroup reports whether a group of transactions, as delivered in one
+// [log.LogReader.Run] handler call, matches the query. As with libvarnishapi,
+// the query applies to the whole group: any of its transactions can satisfy
+// each comparison.
+func (q *Query) MatchGroup(txns []log.Transaction) bool {
+	for _, e := range q.exprs {
+		if e.match(txns) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the transactions of txns that match the query, each taken on its own.
+func (q *Query) Filter(txns []log.Transaction) []log.Transaction {
+	var out []log.Transaction
+	for _, txn := range txns {
+		if q.Match(txn) {
+			out = append(out, txn)
+		}
+	}
+	return out
+}
+
+type expr interface {
+	match(txns []log.Transaction) bool
+}
+
+type orExpr struct{ a, b expr }
+
+func (e orExpr) match(txns []log.Transaction) bool { return e.a.match(txns) || e.b.match(txns) }
+
+type andExpr struct{ a, b expr }
+
+func (e andExpr) match(txns []log.Transaction) bool { return e.a.match(txns) && e.b.match(txns) }
+
+type notExpr struct{ a expr }
+
+func (e notExpr) match(txns []log.Transaction) bool { return !e.a.match(txns) }
+
+// lhs selects the values a comparison applies to.
+type lhs struct {
+	level   int // -1: any level
+	levelPM int // -1: {level-}, 1: {level+}, 0: exact level
+	vxid    bool
+	tags    map[log.Tag]bool
+	prefix  string
+	field   int // 0: whole record
+}
+
+func (l *lhs) levelOK(level int) bool {
+	switch {
+	case l.level < 0:
+		return true
+	case l.levelPM < 0:
+		return level <= l.level
+	case l.levelPM > 0:
+		return level >= l.level
+	default:
+		return level == l.level
+	}
+}
+
+// value extracts the part of a record the comparison applies to, following
+// vslq_test_rec.
+func (l *lhs) value(data string) (string, bool) {
+	b := data
+	if l.prefix != "" {
+		n := len(l.prefix)
+		if len(b) <= n || !strings.EqualFold(b[:n], l.prefix) || b[n] != ':' {
+			return "", false
+		}
+		b = strings.TrimLeft(b[n+1:], spaces)
+	}
+	if l.field > 0 {
+		var f string
+		for i := 0; i < l.field; i++ {
+			b = strings.TrimLeft(b, spaces)
+			if b == "" {
+				return "", false
+			}
+			end := strings.IndexAny(b, spaces)
+			if end < 0 {
+				end = len(b)
+			}
+			f, b = b[:end], b[end:]
+		}
+		return f, true
+	}
+	return b, true
+}
+
+// spaces are the characters isspace(3) accepts in the C locale.
+const spaces = " \t\n\v\f\r"
+
+type op int
+
+const (
+	opTrue op = iota // no operator: the record exists
+	opEq
+	opNeq
+	opLt
+	opLeq
+	opGt
+	opGeq
+	opSeq
+	opSneq
+	opMatch
+	opNomatch
+)
+
+// cmpExpr is a single comparison.
+type cmpExpr struct {
+	lhs     lhs
+	op      op
+	str     string
+	isFloat bool
+	i       int64
+	f       float64
+	re      *regexp.Regexp
+}
+
+func (e *cmpExpr) match(txns []log.Transaction) bool {
+	for _, txn := range txns {
+		if !e.lhs.levelOK(txn.Level) {
+			continue
+		}
+		if e.lhs.vxid {
+			if e.cmpInt(txn.VXID) {
+				return true
+			}
+			continue
+		}
+		for _, rec := range txn.Records {
+			if e.lhs.tags[rec.Tag] && e.matchRecord(rec.Data) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *cmpExpr) matchRecord(data string) bool {
+	v, ok := e.lhs.value(data)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case opTrue:
+		return true
+	case opSeq:
+		return v == e.str
+	case opSneq:
+		return v != e.str
+	case opMatch:
+		return e.re.MatchString(v)
+	case opNomatch:
+		return !e.re.MatchString(v)
+	}
+
+	// numerical comparison: like strtoll/strtod, the number may be followed by
+	// whitespace and more data, but not by anything else
+	v = strings.TrimLeft(v, spaces)
+	if e.isFloat {
+		f, rest, ok := parseFloatPrefix(v)
+		if !ok || (rest != "" && !strings.ContainsRune(spaces, rune(rest[0]))) {
+			return false
+		}
+		return e.cmpFloat(f)
+	}
+	i, rest, ok := parseIntPrefix(v)
+	if !ok || (rest != "" && !strings.ContainsRune(spaces, rune(rest[0]))) {
+		return false
+	}
+	return e.cmpInt(i)
+}
+
+func (e *cmpExpr) cmpInt(v int64) bool {
+	switch e.op {
+	case opEq:
+		return v == e.i
+	case opNeq:
+		return v != e.i
+	case opLt:
+		return v < e.i
+	case opLeq:
+		return v <= e.i
+	case opGt:
+		return v > e.i
+	case opGeq:
+		return v >= e.i
+	}
+	return false
+}
+
+func (e *cmpExpr) cmpFloat(v float64) bool {
+	switch e.op {
+	case opEq:
+		return v == e.f
+	case opNeq:
+		return v != e.f
+	case opLt:
+		return v < e.f
+	case opLeq:
+		return v <= e.f
+	case opGt:
+		return v > e.f
+	case opGeq:
+		return v >= e.f
+	}
+	return false
+}
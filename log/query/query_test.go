@@ -0,0 +1,275 @@
+package query_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+	"github.com/varnish/varnish-go/log/query"
+	"github.com/varnish/varnish-go/version"
+)
+
+func rec(tag varnishlog.Tag, data string) varnishlog.Record {
+	return varnishlog.Record{Tag: tag, Data: data}
+}
+
+// request is a trimmed down version of req 2 from test1_log.bin.
+var request = varnishlog.Transaction{
+	Level:  1,
+	VXID:   2,
+	Type:   varnishlog.TypeRequest,
+	Reason: varnishlog.ReasonRxReq,
+	Records: []varnishlog.Record{
+		rec(varnishlog.TagBegin, "req 1 rxreq"),
+		rec(varnishlog.TagTimestamp, "Start: 1778275576.943963 0.000000 0.000000"),
+		rec(varnishlog.TagReqMethod, "GET"),
+		rec(varnishlog.TagReqURL, "/index.html?page=2"),
+		rec(varnishlog.TagReqHeader, "Host: 0.0.0.0:8888"),
+		rec(varnishlog.TagReqHeader, "User-Agent: curl/8.20.0"),
+		rec(varnishlog.TagVCLCall, "MISS"),
+		rec(varnishlog.TagRespStatus, "200"),
+		rec(varnishlog.TagRespHeader, "Content-Length:   2965"),
+		rec(varnishlog.TagRespHeader, "X-Varnish: 2"),
+		rec(varnishlog.TagTimestamp, "Resp: 1778275576.948458 0.004495 0.000129"),
+		rec(varnishlog.TagReqAcct, "76 0 76 224 2965 3189"),
+		rec(varnishlog.TagEnd, ""),
+	},
+}
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		q    string
+		want bool
+	}{
+		{`ReqURL`, true},
+		{`BereqURL`, false},
+		{`ReqURL eq "/index.html?page=2"`, true},
+		{`ReqURL eq "/index.html"`, false},
+		{`ReqURL ne "/"`, true},
+		{`ReqURL ~ "^/index\\."`, true},
+		{`ReqURL ~ index`, true},
+		{`ReqURL !~ "^/index"`, false},
+		{`requrl eq '/index.html?page=2'`, true},
+		{`RespStatus == 200`, true},
+		{`RespStatus != 200`, false},
+		{`RespStatus >= 200 and RespStatus < 300`, true},
+		{`RespStatus > 0x10`, true},
+		{`RespStatus == 200.0`, true},
+		{`RespStatus eq 200`, true},
+		{`ReqHeader:host eq "0.0.0.0:8888"`, true},
+		{`ReqHeader:User-Agent ~ "^curl/"`, true},
+		{`ReqHeader:Host-Name`, false},
+		{`RespHeader:Content-Length == 2965`, true},
+		{`RespHeader:X-Varnish[1] == 2`, true},
+		{`RespHeader:X-Varnish[2]`, false},
+		{`Timestamp:Resp[2] > 0.004`, true},
+		{`Timestamp:Resp[2] > 0.005`, false},
+		{`Timestamp:Resp == 1778275576`, false}, // "1778275576.948458" isn't an integer
+		{`Timestamp:Resp[1] >= 1778275576.9`, true},
+		{`Timestamp[1] eq "Start:"`, true},
+		{`ReqAcct[5] == 2965`, true},
+		{`ReqAcct[7]`, false},
+		{`ReqAcct == 76`, true}, // the first number, followed by whitespace
+		{`Begin[3] eq rxreq`, true},
+		{`VCL_call eq MISS or VCL_call eq HIT`, true},
+		{`VCL_call eq HIT or RespStatus == 404`, false},
+		{`not VCL_call eq PASS`, true},
+		{`not (ReqMethod eq GET and RespStatus == 200)`, false},
+		{`ReqMethod eq POST or ReqMethod eq GET and RespStatus == 200`, true},
+		{`Req* ~ "index"`, true},
+		{`*Status == 200`, true},
+		{`*Status == 404`, false},
+		{`BereqURL,ReqURL ~ "index"`, true},
+		{`vxid == 2`, true},
+		{`vxid != 2`, false},
+		{`vxid > 1 and vxid <= 2`, true},
+		{`{1} ReqURL`, true},
+		{`{2} ReqURL`, false},
+		{`{2-} ReqURL`, true},
+		{`{2+} ReqURL`, false},
+		{"ReqURL eq \"/nope\"\nRespStatus == 200", true},
+		{"# comment\n\nRespStatus == 404 # another one\n", false},
+	} {
+		q, err := query.Compile(tt.q)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.q, err)
+			continue
+		}
+		if got := q.Match(request); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGroup(t *testing.T) {
+	t.Parallel()
+	bereq := varnishlog.Transaction{
+		Level:      2,
+		VXID:       3,
+		ParentVXID: 2,
+		Type:       varnishlog.TypeBackend,
+		Reason:     varnishlog.ReasonFetch,
+		Records: []varnishlog.Record{
+			rec(varnishlog.TagBerespStatus, "503"),
+		},
+	}
+	group := []varnishlog.Transaction{request, bereq}
+	for _, tt := range []struct {
+		q    string
+		want bool
+	}{
+		{`RespStatus == 200 and BerespStatus == 503`, true},
+		{`{2} BerespStatus == 503`, true},
+		{`{1} BerespStatus == 503`, false},
+		{`{2+} *Status >= 500`, true},
+		{`{1-} *Status >= 500`, false},
+		{`vxid == 3`, true},
+		{`{1} vxid == 3`, false},
+	} {
+		q := query.MustCompile(tt.q)
+		if got := q.MatchGroup(group); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	q := query.MustCompile(`BerespStatus`)
+	if got := q.Filter(group); len(got) != 1 || got[0].VXID != 3 {
+		t.Errorf("Filter: got %+v, want bereq 3 only", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	t.Parallel()
+	for _, q := range []string{
+		``,
+		"# only a comment\n",
+		`NoSuchTag`,
+		`Req`,        // ambiguous
+		`Re*q*`,      // two globs
+		`R*L`,        // glob in the middle
+		`*Nothing`,   // matches zero tags
+		`ReqURL eq`,  // missing operand
+		`ReqURL ==`,  // missing operand
+		`ReqURL = 1`, // unknown operator
+		`ReqURL foo`,
+		`ReqURL eq "unterminated`,
+		`ReqURL ~ "("`,
+		`RespStatus == abc`,
+		`RespStatus == 1x`,
+		`RespStatus[0] == 1`,
+		`RespStatus[a]`,
+		`RespStatus[1`,
+		`{a} ReqURL`,
+		`{1 ReqURL`,
+		`vxid`,
+		`vxid eq 1`,
+		`vxid == 1.5`,
+		`(ReqURL`,
+		`ReqURL)`,
+		`ReqURL and`,
+		`not`,
+		`ReqURL $ 1`,
+	} {
+		if _, err := query.Compile(q); err == nil {
+			t.Errorf("Compile(%q): expected an error", q)
+		}
+	}
+}
+
+// parityQueries are evaluated by both libvarnishapi and this package against
+// test1_log.bin.
+var parityQueries = []string{
+	`ReqURL eq "/"`,
+	`ReqURL ne "/"`,
+	`RespStatus == 404`,
+	`RespStatus >= 400 and ReqMethod eq GET`,
+	`BerespStatus != 200`,
+	`ReqHeader:Host eq "0.0.0.0:8888"`,
+	`ReqHeader:host`,
+	`RespHeader:X-Varnish[1] == 32772`,
+	`Timestamp:Resp[2] > 0.004`,
+	`Timestamp:Process[2] < 0.003`,
+	`VCL_call eq PASS`,
+	`VCL_call eq "MISS" or VCL_return eq restart`,
+	`Begin[3] eq restart`,
+	`Link[3] eq restart`,
+	`Req* ~ "unknown"`,
+	`*Status == 404`,
+	`ReqURL,BereqURL ~ "^/unk"`,
+	`{1} ReqURL ~ unknown`,
+	`{2+} RespStatus == 404`,
+	`{2-} BerespStatus == 200`,
+	`vxid == 32772`,
+	`vxid > 10 and not BerespStatus`,
+	`not ReqURL eq "/" or VCL_return eq deliver`,
+	`(ReqMethod eq GET or ReqMethod eq POST) and RespStatus == 200`,
+	`ReqAcct[5] > 1000`,
+	`BereqAcct == 171`,
+	`SessClose[2] >= 0.005`,
+	`BerespHeader:Content-Type ~ "text/html"`,
+	`RespHeader:Content-Length !~ "^2"`,
+}
+
+// readGroups returns the VXIDs of the transactions of each group delivered for
+// test1_log.bin, filtered by libvarnishapi if q isn't empty.
+func readGroups(t *testing.T, grouping varnishlog.Grouping, q string) ([][]varnishlog.Transaction, [][]int64) {
+	t.Helper()
+	r, err := varnishlog.New().
+		SetGrouping(grouping).
+		SetQuery(q).
+		SetFile(filepath.Join("..", "testdata", "test1_log.bin")).
+		Attach()
+	if err != nil {
+		t.Fatalf("%q: %v", q, err)
+	}
+	defer r.Close()
+
+	var groups [][]varnishlog.Transaction
+	var vxids [][]int64
+	err = r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		groups = append(groups, txns)
+		var ids []int64
+		for _, txn := range txns {
+			ids = append(ids, txn.VXID)
+		}
+		vxids = append(vxids, ids)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%q: Run: %v", q, err)
+	}
+	return groups, vxids
+}
+
+// TestParity checks that every query selects the same groups as libvarnishapi.
+func TestParity(t *testing.T) {
+	t.Parallel()
+	if version.IsEnterprise() {
+		t.Skip("test1_log.bin not compatible with Varnish Plus")
+	}
+	for _, grouping := range []varnishlog.Grouping{varnishlog.GroupingVXID, varnishlog.GroupingRequest} {
+		all, _ := readGroups(t, grouping, "")
+		for _, qs := range parityQueries {
+			_, want := readGroups(t, grouping, qs)
+
+			q := query.MustCompile(qs)
+			var got [][]int64
+			for _, txns := range all {
+				if !q.MatchGroup(txns) {
+					continue
+				}
+				var ids []int64
+				for _, txn := range txns {
+					ids = append(ids, txn.VXID)
+				}
+				got = append(got, ids)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("grouping %d, %q: got groups %v, want %v", grouping, qs, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/varnish/varnish-go/log/vslfile"
+)
+
+// readFile is the [LogReaderBuilder.SetPureGo] counterpart of runFile: it reads
+// r.file with [vslfile] and groups the records in Go, following the same rules
+// as libvarnishapi's VSLQ for raw and vxid grouping.
+func (r *LogReader) readFile(ctx context.Context) error {
+	f, err := os.Open(r.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	vr, err := vslfile.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.file, err)
+	}
+
+	g := newFileGrouper(r.grouping, r.resumable(r.filterRecords(r.measured(r.handler))))
+	if r.txnLimit > 0 {
+		g.limit = r.txnLimit
+	}
+	if r.txnTimeout > 0 {
+		g.timeout = r.txnTimeout
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rec, err := vr.Next()
+		if err == io.EOF {
+			return g.flush()
+		}
+		if err != nil {
+			return fmt.Errorf("VSL read error on %s: %w", r.file, err)
+		}
+		if err := g.add(recordFromFile(rec)); err != nil {
+			return err
+		}
+	}
+}
+
+// filterRecords applies [LogReaderBuilder.SetRecordTags] and the record
+// filters to the transactions assembled by fileGrouper, which needs to see
+// every record to group them.
+func (r *LogReader) filterRecords(handler func([]Transaction) error) func([]Transaction) error {
+	if r.recordTags == nil && r.filter == nil {
+		return handler
+	}
+	return func(txns []Transaction) error {
+		kept := txns[:0]
+		for _, txn := range txns {
+			recs := txn.Records[:0]
+			for _, rec := range txn.Records {
+				if r.keepRecord(rec) {
+					recs = append(recs, rec)
+				}
+			}
+			if len(recs) == 0 {
+				if r.skipEmpty() {
+					continue
+				}
+				recs = nil
+			}
+			txn.Records = recs
+			kept = append(kept, txn)
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		return handler(kept)
+	}
+}
+
+// recordFromFile converts a record read by vslfile, dropping the NUL that
+// terminates text payloads like the CGo callback does.
+func recordFromFile(rec vslfile.Record) Record {
+	tag := Tag(rec.Tag)
+	data := rec.Data
+	if !tag.isBinary() && len(data) > 0 && data[len(data)-1] == 0 {
+		data = data[:len(data)-1]
+	}
+	return Record{
+		Tag:       tag,
+		VXID:      rec.VXID,
+		IsClient:  rec.Client,
+		IsBackend: rec.Backend,
+		Data:      string(data),
+	}
+}
+
+// fileGrouper assembles records into transactions and hands them to handler.
+type fileGrouper struct {
+	grouping Grouping
+	handler  func([]Transaction) error
+	limit    int           // -L: incomplete transactions kept at most
+	timeout  time.Duration // -T: how long an incomplete transaction is kept
+
+	// vxid grouping: transactions whose End record hasn't been seen yet,
+	// and their creation order, which is the order VSLQ_Flush uses.
+	pending map[uint64]*pendingTxn
+	order   []uint64
+}
+
+type pendingTxn struct {
+	Transaction
+	start time.Time
+}
+
+// Defaults of libvarnishapi's -L and -T options.
+const (
+	defaultTxnLimit   = 1000
+	defaultTxnTimeout = 120 * time.Second
+)
+
+func newFileGrouper(grouping Grouping, handler func([]Transaction) error) *fileGrouper {
+	return &fileGrouper{
+		grouping: grouping,
+		handler:  handler,
+		limit:    defaultTxnLimit,
+		timeout:  defaultTxnTimeout,
+		pending:  map[uint64]*pendingTxn{},
+	}
+}
+
+func (g *fileGrouper) add(rec Record) error {
+	if g.grouping == GroupingRaw {
+		return g.handler([]Transaction{{
+			Level:   0,
+			VXID:    int64(rec.VXID),
+			Type:    TypeRaw,
+			Reason:  ReasonUnknown,
+			Records: []Record{rec},
+		}})
+	}
+
+	// non-transactional records (CLI, Backend_health, ...) are only
+	// visible with raw grouping
+	if rec.VXID == 0 {
+		return nil
+	}
+	txn, ok := g.pending[rec.VXID]
+	if !ok {
+		// like VSLQ, make room by forcing out the oldest transactions
+		if err := g.expire(); err != nil {
+			return err
+		}
+		txn = &pendingTxn{Transaction: Transaction{Level: 1, VXID: int64(rec.VXID)}, start: time.Now()}
+		g.pending[rec.VXID] = txn
+		g.order = append(g.order, rec.VXID)
+	}
+	txn.Records = append(txn.Records, rec)
+
+	switch rec.Tag {
+	case TagBegin:
+		if b, err := ParseBegin(rec.Data); err == nil {
+			txn.Type, txn.Reason = b.Type, b.Reason
+		}
+	case TagEnd:
+		g.remove(rec.VXID)
+		return g.handler([]Transaction{txn.Transaction})
+	}
+	return nil
+}
+
+// expire forces out the incomplete transactions that timed out, then the
+// oldest ones until there's room for a new one.
+func (g *fileGrouper) expire() error {
+	now := time.Now()
+	for len(g.order) > 0 && now.Sub(g.pending[g.order[0]].start) > g.timeout {
+		if err := g.force(g.order[0], "timeout"); err != nil {
+			return err
+		}
+	}
+	for len(g.order) >= g.limit {
+		if err := g.force(g.order[0], "store overflow"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *fileGrouper) remove(vxid uint64) {
+	delete(g.pending, vxid)
+	for i, v := range g.order {
+		if v == vxid {
+			g.order = append(g.order[:i], g.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// force delivers an incomplete transaction. Like libvarnishapi, it marks it
+// with a synthetic VSL record giving the reason.
+func (g *fileGrouper) force(vxid uint64, reason string) error {
+	txn := g.pending[vxid]
+	g.remove(vxid)
+	txn.Records = append(txn.Records, Record{
+		Tag:       TagVSL,
+		VXID:      vxid,
+		IsClient:  txn.Type == TypeRequest,
+		IsBackend: txn.Type == TypeBackend,
+		Data:      reason,
+	})
+	return g.handler([]Transaction{txn.Transaction})
+}
+
+// flush delivers the transactions that were still incomplete at the end of the
+// file, in creation order, like VSLQ_Flush.
+func (g *fileGrouper) flush() error {
+	for len(g.order) > 0 {
+		if err := g.force(g.order[0], "flush"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
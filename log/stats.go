@@ -0,0 +1,218 @@
+package log
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ReaderStats is a snapshot of the activity of a [LogReader], see
+// [LogReader.Stats]. Counters start at zero when the LogReader is attached and
+// only go up.
+type ReaderStats struct {
+	Time time.Time `json:"time" yaml:"time"` // when the snapshot was taken
+
+	Batches      uint64 `json:"batches"      yaml:"batches"`      // handler calls
+	Transactions uint64 `json:"transactions" yaml:"transactions"` // transactions passed to the handler
+	Records      uint64 `json:"records"      yaml:"records"`      // records passed to the handler
+
+	// HandlerTime is the total time spent in the handler, MaxHandlerTime the
+	// longest call; divide HandlerTime by Batches for the average latency.
+	HandlerTime    time.Duration `json:"handlerTime"    yaml:"handlerTime"`
+	MaxHandlerTime time.Duration `json:"maxHandlerTime" yaml:"maxHandlerTime"`
+
+	// Reconnects counts the times the log cursor was opened again after a
+	// read error or a worker restart. The other counters track the conditions
+	// reported to the handler of [LogReaderBuilder.SetErrHandler], by kind.
+	Reconnects     uint64 `json:"reconnects"     yaml:"reconnects"`
+	Overruns       uint64 `json:"overruns"       yaml:"overruns"`
+	Abandoned      uint64 `json:"abandoned"      yaml:"abandoned"`
+	WorkerRestarts uint64 `json:"workerRestarts" yaml:"workerRestarts"`
+	CursorLost     uint64 `json:"cursorLost"     yaml:"cursorLost"`
+	IOErrors       uint64 `json:"ioErrors"       yaml:"ioErrors"`
+}
+
+// Errors returns the number of times e occurred.
+func (s ReaderStats) Errors(e LogErr) uint64 {
+	switch e {
+	case ErrOverrun:
+		return s.Overruns
+	case ErrAbandoned:
+		return s.Abandoned
+	case ErrWorkerRestarted:
+		return s.WorkerRestarts
+	case ErrCursorLost:
+		return s.CursorLost
+	case ErrIO:
+		return s.IOErrors
+	default:
+		return 0
+	}
+}
+
+// RecordRate returns the number of records delivered per second between the
+// prev snapshot and s.
+func (s ReaderStats) RecordRate(prev ReaderStats) float64 {
+	return rate(s.Records-prev.Records, s.Time.Sub(prev.Time))
+}
+
+// TransactionRate returns the number of transactions delivered per second
+// between the prev snapshot and s.
+func (s ReaderStats) TransactionRate(prev ReaderStats) float64 {
+	return rate(s.Transactions-prev.Transactions, s.Time.Sub(prev.Time))
+}
+
+func rate(n uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// MetricType is the type of a [Metric], with the meaning Prometheus gives it.
+type MetricType int
+
+const (
+	MetricCounter MetricType = iota // only goes up
+	MetricGauge                     // can go up and down
+)
+
+// String returns "counter" or "gauge". Implements [fmt.Stringer].
+func (t MetricType) String() string {
+	if t == MetricGauge {
+		return "gauge"
+	}
+	return "counter"
+}
+
+// Metric is a reader statistic in the shape metric systems expect, named
+// following the Prometheus conventions.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   MetricType
+	Labels map[string]string
+	Value  float64
+}
+
+// Metrics returns s as metrics named varnish_log_reader_*, so a LogReader can
+// be exported by a collector. With Prometheus, for instance:
+//
+//	func (c collector) Collect(ch chan<- prometheus.Metric) {
+//	    for _, m := range c.reader.Stats().Metrics() {
+//	        vt := prometheus.CounterValue
+//	        if m.Type == log.MetricGauge {
+//	            vt = prometheus.GaugeValue
+//	        }
+//	        desc := prometheus.NewDesc(m.Name, m.Help, nil, m.Labels)
+//	        ch <- prometheus.MustNewConstMetric(desc, vt, m.Value)
+//	    }
+//	}
+//
+// Errors are counted by a single varnish_log_reader_errors_total metric,
+// with a "kind" label identifying the [LogErr]: overrun, abandoned,
+// worker_restarted, cursor_lost or io_error.
+func (s ReaderStats) Metrics() []Metric {
+	const prefix = "varnish_log_reader_"
+	m := []Metric{
+		{Name: prefix + "batches_total", Help: "Handler calls.", Value: float64(s.Batches)},
+		{Name: prefix + "transactions_total", Help: "Transactions passed to the handler.", Value: float64(s.Transactions)},
+		{Name: prefix + "records_total", Help: "Records passed to the handler.", Value: float64(s.Records)},
+		{Name: prefix + "handler_seconds_total", Help: "Time spent in the handler.", Value: s.HandlerTime.Seconds()},
+		{Name: prefix + "handler_max_seconds", Help: "Longest handler call.", Type: MetricGauge, Value: s.MaxHandlerTime.Seconds()},
+		{Name: prefix + "reconnects_total", Help: "Log cursors reopened after an error or a worker restart.", Value: float64(s.Reconnects)},
+	}
+	for _, e := range []LogErr{ErrOverrun, ErrAbandoned, ErrWorkerRestarted, ErrCursorLost, ErrIO} {
+		m = append(m, Metric{
+			Name:   prefix + "errors_total",
+			Help:   "Recoverable log read errors, by kind.",
+			Labels: map[string]string{"kind": errKind(e)},
+			Value:  float64(s.Errors(e)),
+		})
+	}
+	return m
+}
+
+// errKind returns the stable identifier of e used as a metric label, as
+// [LogErr.String] is meant for humans.
+func errKind(e LogErr) string {
+	switch e {
+	case ErrOverrun:
+		return "overrun"
+	case ErrAbandoned:
+		return "abandoned"
+	case ErrWorkerRestarted:
+		return "worker_restarted"
+	case ErrCursorLost:
+		return "cursor_lost"
+	case ErrIO:
+		return "io_error"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats returns a snapshot of the reader's statistics. It can be called at any
+// time, including concurrently with [LogReader.Run].
+func (r *LogReader) Stats() ReaderStats {
+	s := &r.stats
+	return ReaderStats{
+		Time:           time.Now(),
+		Batches:        s.batches.Load(),
+		Transactions:   s.txns.Load(),
+		Records:        s.records.Load(),
+		HandlerTime:    time.Duration(s.handlerTime.Load()),
+		MaxHandlerTime: time.Duration(s.maxHandlerTime.Load()),
+		Reconnects:     s.reconnects.Load(),
+		Overruns:       s.errors[ErrOverrun].Load(),
+		Abandoned:      s.errors[ErrAbandoned].Load(),
+		WorkerRestarts: s.errors[ErrWorkerRestarted].Load(),
+		CursorLost:     s.errors[ErrCursorLost].Load(),
+		IOErrors:       s.errors[ErrIO].Load(),
+	}
+}
+
+// readerStats holds the counters behind [LogReader.Stats].
+type readerStats struct {
+	batches        atomic.Uint64
+	txns           atomic.Uint64
+	records        atomic.Uint64
+	handlerTime    atomic.Int64
+	maxHandlerTime atomic.Int64
+	reconnects     atomic.Uint64
+	errors         [ErrIO + 1]atomic.Uint64
+}
+
+// delivered accounts for a handler call.
+func (s *readerStats) delivered(txns, records int, d time.Duration) {
+	s.batches.Add(1)
+	s.txns.Add(uint64(txns))
+	s.records.Add(uint64(records))
+	s.handlerTime.Add(int64(d))
+	for {
+		cur := s.maxHandlerTime.Load()
+		if int64(d) <= cur || s.maxHandlerTime.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+}
+
+func (s *readerStats) logErr(e LogErr) {
+	if e >= 0 && int(e) < len(s.errors) {
+		s.errors[e].Add(1)
+	}
+}
+
+// measured wraps handler with the accounting of Stats, for the pure-Go file
+// reader; the CGo callbacks do the same on their own.
+func (r *LogReader) measured(handler func([]Transaction) error) func([]Transaction) error {
+	return func(txns []Transaction) error {
+		var records int
+		for _, txn := range txns {
+			records += len(txn.Records)
+		}
+		start := time.Now()
+		err := handler(txns)
+		r.stats.delivered(len(txns), records, time.Since(start))
+		return err
+	}
+}
@@ -0,0 +1,74 @@
+package log_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+	before := r.Stats()
+
+	var records int
+	err := r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		for _, txn := range txns {
+			records += len(txn.Records)
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := r.Stats()
+	if s.Batches != 8 || s.Transactions != 8 || s.Records != uint64(records) {
+		t.Errorf("got %d batches, %d transactions, %d records, want 8, 8, %d", s.Batches, s.Transactions, s.Records, records)
+	}
+	if s.HandlerTime < 8*time.Millisecond || s.MaxHandlerTime < time.Millisecond || s.MaxHandlerTime > s.HandlerTime {
+		t.Errorf("unexpected handler times: total %s, max %s", s.HandlerTime, s.MaxHandlerTime)
+	}
+	if s.Reconnects != 0 || s.Errors(varnishlog.ErrOverrun) != 0 {
+		t.Errorf("unexpected errors: %+v", s)
+	}
+	if rate := s.RecordRate(before); rate <= 0 || rate > float64(records)/(8*time.Millisecond).Seconds() {
+		t.Errorf("unexpected record rate %f", rate)
+	}
+	if rate := s.TransactionRate(s); rate != 0 {
+		t.Errorf("rate over no time: got %f, want 0", rate)
+	}
+}
+
+func TestStatsMetrics(t *testing.T) {
+	t.Parallel()
+	s := varnishlog.ReaderStats{Records: 42, MaxHandlerTime: 2 * time.Second, Overruns: 3}
+	metrics := map[string]varnishlog.Metric{}
+	for _, m := range s.Metrics() {
+		key := m.Name
+		if kind, ok := m.Labels["kind"]; ok {
+			key += "/" + kind
+		}
+		if _, dup := metrics[key]; dup {
+			t.Errorf("duplicate metric %s", key)
+		}
+		metrics[key] = m
+	}
+	for key, want := range map[string]float64{
+		"varnish_log_reader_records_total":                 42,
+		"varnish_log_reader_handler_max_seconds":           2,
+		"varnish_log_reader_errors_total/overrun":          3,
+		"varnish_log_reader_errors_total/worker_restarted": 0,
+		"varnish_log_reader_errors_total/cursor_lost":      0,
+	} {
+		if m, ok := metrics[key]; !ok || m.Value != want {
+			t.Errorf("%s: got %+v, want value %v", key, m, want)
+		}
+	}
+	if m := metrics["varnish_log_reader_handler_max_seconds"]; m.Type != varnishlog.MetricGauge {
+		t.Errorf("handler_max_seconds: got type %s, want gauge", m.Type)
+	}
+}
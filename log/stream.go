@@ -0,0 +1,153 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync/atomic"
+)
+
+// errStopIteration makes Run return once the consumer of an iterator or
+// stream is done. It never reaches the caller.
+var errStopIteration = errors.New("stop iteration")
+
+// Transactions returns an iterator over the transactions [LogReader.Run] would
+// deliver. Grouped transactions are yielded one after the other, the root of
+// each group (Level 1) first. Iteration stops when the input ends or when the
+// loop exits early; if reading fails, or ctx is cancelled, the error is
+// yielded last, with a zero Transaction.
+//
+//	for txn, err := range r.Transactions(ctx) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(txn.VXID)
+//	}
+//
+// As with Run, the LogReader must not be used for anything else while the
+// iteration is in progress.
+func (r *LogReader) Transactions(ctx context.Context) iter.Seq2[Transaction, error] {
+	return func(yield func(Transaction, error) bool) {
+		// The loop body runs from the dispatch callback, under C frames when
+		// reading through libvarnishapi: don't let a panic unwind through them.
+		var panicked bool
+		var panicVal any
+		err := r.Run(ctx, func(txns []Transaction) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked, panicVal, err = true, p, errStopIteration
+				}
+			}()
+			for _, txn := range txns {
+				if !yield(txn, nil) {
+					return errStopIteration
+				}
+			}
+			return nil
+		})
+		if panicked {
+			panic(panicVal)
+		}
+		if err != nil && err != errStopIteration {
+			yield(Transaction{}, err)
+		}
+	}
+}
+
+// Backpressure selects what a [Stream] does when its consumer falls behind.
+type Backpressure int
+
+const (
+	// BackpressureBlock waits for the consumer. Nothing is lost on the Go side,
+	// but a live reader that stays blocked long enough is overrun by varnishd
+	// and reports [ErrOverrun].
+	BackpressureBlock Backpressure = iota
+	// BackpressureDrop discards the groups that don't fit in the channel and
+	// counts them in [Stream.Dropped]. Reading never waits for the consumer.
+	BackpressureDrop
+)
+
+// String returns the name of the policy. Implements [fmt.Stringer].
+func (b Backpressure) String() string {
+	switch b {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDrop:
+		return "drop"
+	default:
+		return "unknown"
+	}
+}
+
+// Stream delivers the transactions of a [LogReader] on a channel. Obtain one
+// with [LogReader.Stream].
+type Stream struct {
+	// C receives the transactions. It is closed once reading stops.
+	C <-chan Transaction
+
+	done    chan struct{}
+	err     error
+	dropped atomic.Uint64
+}
+
+// Stream runs r in a new goroutine and sends its transactions on a channel
+// with a buffer of size transactions. Grouped transactions are sent one after
+// the other, the root of each group first. With [BackpressureDrop], a group is
+// only sent if it fits whole in the free space of the buffer, so size should
+// be at least the size of the largest expected group.
+//
+// Reading stops when the input ends, when ctx is cancelled, or on error; see
+// [Stream.Err]. The LogReader must not be used, nor closed, until [Stream.C]
+// is closed.
+//
+//	s := r.Stream(ctx, 1024, log.BackpressureDrop)
+//	for txn := range s.C {
+//	    fmt.Println(txn.VXID)
+//	}
+//	if err := s.Err(); err != nil && err != context.Canceled {
+//	    return err
+//	}
+func (r *LogReader) Stream(ctx context.Context, size int, policy Backpressure) *Stream {
+	ch := make(chan Transaction, size)
+	s := &Stream{C: ch, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		defer close(ch)
+		s.err = r.Run(ctx, func(txns []Transaction) error {
+			if policy == BackpressureDrop {
+				if cap(ch)-len(ch) < len(txns) {
+					s.dropped.Add(uint64(len(txns)))
+					return nil
+				}
+				// this goroutine is the only sender: the room can only grow
+				for _, txn := range txns {
+					ch <- txn
+				}
+				return nil
+			}
+			for _, txn := range txns {
+				select {
+				case ch <- txn:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}()
+	return s
+}
+
+// Err waits for reading to stop and returns why: nil once a file or
+// non-live reader reaches its end, ctx.Err() on cancellation, or the error
+// that stopped [LogReader.Run].
+func (s *Stream) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Dropped returns the number of transactions discarded so far under
+// [BackpressureDrop].
+func (s *Stream) Dropped() uint64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,137 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+// fileVXIDs is the delivery order of test1_log.bin with VXID grouping.
+var fileVXIDs = []int64{3, 2, 1, 32771, 32770, 32773, 32772, 32769}
+
+func newPureGoReader(t *testing.T) *varnishlog.LogReader {
+	t.Helper()
+	r, err := varnishlog.New().SetFile(testBinPath()).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func TestTransactions(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+
+	var got []int64
+	for txn, err := range r.Transactions(context.Background()) {
+		if err != nil {
+			t.Fatalf("Transactions: %v", err)
+		}
+		got = append(got, txn.VXID)
+	}
+	if !slices.Equal(got, fileVXIDs) {
+		t.Errorf("got %v, want %v", got, fileVXIDs)
+	}
+}
+
+func TestTransactionsBreak(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+
+	var got []int64
+	for txn, err := range r.Transactions(context.Background()) {
+		if err != nil {
+			t.Fatalf("Transactions: %v", err)
+		}
+		got = append(got, txn.VXID)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if !slices.Equal(got, fileVXIDs[:2]) {
+		t.Errorf("got %v, want %v", got, fileVXIDs[:2])
+	}
+}
+
+func TestTransactionsCancelled(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var errs []error
+	for _, err := range r.Transactions(ctx) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("expected a single context.Canceled error, got %v", errs)
+	}
+}
+
+func TestTransactionsPanic(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("expected the loop body's panic, got %v", p)
+		}
+	}()
+	for range r.Transactions(context.Background()) {
+		panic("boom")
+	}
+}
+
+func TestStreamBlock(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+
+	s := r.Stream(context.Background(), 0, varnishlog.BackpressureBlock)
+	var got []int64
+	for txn := range s.C {
+		got = append(got, txn.VXID)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if !slices.Equal(got, fileVXIDs) || s.Dropped() != 0 {
+		t.Errorf("got %v (%d dropped), want %v", got, s.Dropped(), fileVXIDs)
+	}
+}
+
+func TestStreamDrop(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+
+	// nothing is consumed until reading is over: only the first 3 fit
+	s := r.Stream(context.Background(), 3, varnishlog.BackpressureDrop)
+	if err := s.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	var got []int64
+	for txn := range s.C {
+		got = append(got, txn.VXID)
+	}
+	if !slices.Equal(got, fileVXIDs[:3]) || s.Dropped() != 5 {
+		t.Errorf("got %v (%d dropped), want %v (5 dropped)", got, s.Dropped(), fileVXIDs[:3])
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	t.Parallel()
+	r := newPureGoReader(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := r.Stream(ctx, 0, varnishlog.BackpressureBlock)
+	<-s.C
+	cancel()
+	for range s.C {
+	}
+	if err := s.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err: got %v, want context.Canceled", err)
+	}
+}
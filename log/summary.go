@@ -0,0 +1,275 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handling is how Varnish served a client request.
+type Handling int
+
+const (
+	// HandlingUnknown: the request didn't reach a lookup, e.g. it's incomplete.
+	HandlingUnknown Handling = iota
+	// HandlingHit: served from the cache.
+	HandlingHit
+	// HandlingMiss: fetched from the backend and inserted in the cache.
+	HandlingMiss
+	// HandlingHitMiss: a miss on a hit-for-miss object.
+	HandlingHitMiss
+	// HandlingPass: fetched from the backend, bypassing the cache.
+	HandlingPass
+	// HandlingHitPass: a pass on a hit-for-pass object.
+	HandlingHitPass
+	// HandlingPipe: piped to the backend.
+	HandlingPipe
+	// HandlingSynth: a synthetic response generated by VCL.
+	HandlingSynth
+)
+
+// String returns the name of the handling, as used by varnishncsa (plus
+// "hitmiss" and "hitpass"). Implements [fmt.Stringer].
+func (h Handling) String() string {
+	switch h {
+	case HandlingHit:
+		return "hit"
+	case HandlingMiss:
+		return "miss"
+	case HandlingHitMiss:
+		return "hitmiss"
+	case HandlingPass:
+		return "pass"
+	case HandlingHitPass:
+		return "hitpass"
+	case HandlingPipe:
+		return "pipe"
+	case HandlingSynth:
+		return "synth"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the handling as its string name. Implements [encoding.TextMarshaler];
+// see https://pkg.go.dev/encoding#TextMarshaler.
+func (h Handling) MarshalText() ([]byte, error) { return []byte(h.String()), nil }
+
+// RequestSummary is the gist of a client request transaction. When a field is
+// logged several times, e.g. a URL rewritten by VCL, the last value is kept.
+// Fields that weren't logged are left to their zero value.
+type RequestSummary struct {
+	VXID       int64    `json:"vxid"       yaml:"vxid"`
+	Reason     Reason   `json:"reason"     yaml:"reason"`     // rxreq, esi or restart
+	ClientAddr string   `json:"clientAddr" yaml:"clientAddr"` // from ReqStart
+	Method     string   `json:"method"     yaml:"method"`
+	URL        string   `json:"url"        yaml:"url"`
+	Protocol   string   `json:"protocol"   yaml:"protocol"`
+	Status     int      `json:"status"     yaml:"status"`
+	Handling   Handling `json:"handling"   yaml:"handling"`
+	// HitVXID is the VXID of the transaction that fetched the object found by
+	// the lookup (including hit-for-miss and hit-for-pass objects), 0 if none.
+	HitVXID int64 `json:"hitVxid" yaml:"hitVxid"`
+	// FetchVXID is the VXID of the backend transaction started by the request,
+	// 0 if none. For a hit, it's a background fetch.
+	FetchVXID int64 `json:"fetchVxid" yaml:"fetchVxid"`
+	// Restarted is set if the request restarted rather than delivering its
+	// response; Status is then that of the abandoned response.
+	Restarted bool `json:"restarted" yaml:"restarted"`
+
+	// Start is when the client request began. Restarted and ESI transactions
+	// keep the start of the request they derive from, and so do TTFB and
+	// Duration, measured from Start.
+	Start    time.Time     `json:"start"    yaml:"start"`
+	TTFB     time.Duration `json:"ttfb"     yaml:"ttfb"`     // time to the first byte of the response (Process timestamp)
+	Duration time.Duration `json:"duration" yaml:"duration"` // time to the end of the response (Resp timestamp)
+	Acct     Acct          `json:"acct"     yaml:"acct"`     // from ReqAcct
+
+	// Backend is the name of the backend the response came from and Restarts
+	// the number of restarts that led to this transaction. Both need the
+	// other transactions of the group: only [Tree.Summarize] sets them.
+	Backend  string `json:"backend"  yaml:"backend"`
+	Restarts int    `json:"restarts" yaml:"restarts"`
+}
+
+// Summarize extracts a [RequestSummary] from a client request transaction.
+func Summarize(txn Transaction) RequestSummary {
+	s := RequestSummary{VXID: txn.VXID, Reason: txn.Reason}
+	var hitMiss, hitPass bool
+	for _, rec := range txn.Records {
+		switch {
+		case rec.Tag == 0:
+			// unsupported tags are zero and must never match
+		case rec.Tag == TagReqStart:
+			if rs, err := ParseReqStart(rec.Data); err == nil {
+				s.ClientAddr = rs.ClientAddr
+			}
+		case rec.Tag == TagReqMethod:
+			s.Method = rec.Data
+		case rec.Tag == TagReqURL:
+			s.URL = rec.Data
+		case rec.Tag == TagReqProtocol:
+			s.Protocol = rec.Data
+		case rec.Tag == TagRespStatus:
+			s.Status = atoi(rec.Data)
+		case rec.Tag == TagHit:
+			if h, err := ParseHit(rec.Data); err == nil {
+				s.HitVXID = h.VXID
+			}
+		case rec.Tag == TagHitMiss:
+			if h, err := ParseHitMiss(rec.Data); err == nil {
+				s.HitVXID, hitMiss = h.VXID, true
+			}
+		case rec.Tag == TagHitPass:
+			if h, err := ParseHitPass(rec.Data); err == nil {
+				s.HitVXID, hitPass = h.VXID, true
+			}
+		case rec.Tag == TagVCLCall:
+			// same classification as varnishncsa's %{Varnish:handling}x
+			switch strings.ToLower(rec.Data) {
+			case "hit":
+				s.Handling = HandlingHit
+			case "miss":
+				s.Handling = HandlingMiss
+			case "pass":
+				s.Handling = HandlingPass
+			case "synth":
+				s.Handling = HandlingSynth
+			}
+		case rec.Tag == TagVCLReturn:
+			switch strings.ToLower(rec.Data) {
+			case "pipe":
+				s.Handling = HandlingPipe
+			case "restart":
+				s.Restarted = true
+			}
+		case rec.Tag == TagLink:
+			if l, err := ParseLink(rec.Data); err == nil && l.Type == TypeBackend {
+				s.FetchVXID = l.VXID
+			}
+		case rec.Tag == TagReqAcct:
+			if a, err := ParseReqAcct(rec.Data); err == nil {
+				s.Acct = a
+			}
+		case rec.Tag == TagTimestamp:
+			ts, err := ParseTimestamp(rec.Data)
+			if err != nil {
+				continue
+			}
+			switch ts.Label {
+			case "Start":
+				s.Start = ts.Abs.Add(-ts.SinceStart)
+			case "Process":
+				s.TTFB = ts.SinceStart
+			case "Resp":
+				s.Duration = ts.SinceStart
+			}
+		}
+	}
+	switch {
+	case s.Handling == HandlingMiss && hitMiss:
+		s.Handling = HandlingHitMiss
+	case s.Handling == HandlingPass && hitPass:
+		s.Handling = HandlingHitPass
+	}
+	return s
+}
+
+// BackendSummary is the gist of a backend request transaction. As with
+// [RequestSummary], the last value logged for a field is kept.
+type BackendSummary struct {
+	VXID     int64  `json:"vxid"     yaml:"vxid"`
+	Reason   Reason `json:"reason"   yaml:"reason"` // fetch, bgfetch, pass or pipe
+	Method   string `json:"method"   yaml:"method"`
+	URL      string `json:"url"      yaml:"url"`
+	Protocol string `json:"protocol" yaml:"protocol"`
+	Status   int    `json:"status"   yaml:"status"`
+	// Backend is the name of the backend the request was sent to, from
+	// BackendOpen. It's empty if no connection was made.
+	Backend string `json:"backend" yaml:"backend"`
+	// FetchError is the last FetchError record, empty if the fetch succeeded.
+	FetchError string `json:"fetchError" yaml:"fetchError"`
+
+	Start    time.Time     `json:"start"    yaml:"start"`
+	TTFB     time.Duration `json:"ttfb"     yaml:"ttfb"`     // time to the response headers (Beresp timestamp)
+	Duration time.Duration `json:"duration" yaml:"duration"` // time to the end of the response body (BerespBody timestamp)
+	Acct     Acct          `json:"acct"     yaml:"acct"`     // from BereqAcct
+}
+
+// SummarizeBackend extracts a [BackendSummary] from a backend request transaction.
+func SummarizeBackend(txn Transaction) BackendSummary {
+	s := BackendSummary{VXID: txn.VXID, Reason: txn.Reason}
+	for _, rec := range txn.Records {
+		switch {
+		case rec.Tag == 0:
+		case rec.Tag == TagBereqMethod:
+			s.Method = rec.Data
+		case rec.Tag == TagBereqURL:
+			s.URL = rec.Data
+		case rec.Tag == TagBereqProtocol:
+			s.Protocol = rec.Data
+		case rec.Tag == TagBerespStatus:
+			s.Status = atoi(rec.Data)
+		case rec.Tag == TagBackendOpen:
+			if bo, err := ParseBackendOpen(rec.Data); err == nil {
+				s.Backend = bo.Name
+			}
+		case rec.Tag == TagFetchError:
+			s.FetchError = rec.Data
+		case rec.Tag == TagBereqAcct:
+			if a, err := ParseBereqAcct(rec.Data); err == nil {
+				s.Acct = a
+			}
+		case rec.Tag == TagTimestamp:
+			ts, err := ParseTimestamp(rec.Data)
+			if err != nil {
+				continue
+			}
+			switch ts.Label {
+			case "Start":
+				s.Start = ts.Abs
+			case "Beresp":
+				s.TTFB = ts.SinceStart
+			case "BerespBody":
+				s.Duration = ts.SinceStart
+			}
+		}
+	}
+	return s
+}
+
+// Summarize returns one [RequestSummary] per response sent to the client: the
+// request at the root of the tree, then each ESI subrequest, in [Tree.Walk]
+// order. A request that restarted is summarized by the transaction that
+// finally responded, with Restarts counting the restarts. Backend is set if
+// the response came from a fetch or pass whose transaction is part of the tree.
+func (t *Tree) Summarize() []RequestSummary {
+	var out []RequestSummary
+	t.Walk(func(n *Node) bool {
+		if n.Type != TypeRequest || n.StartReason() == ReasonRestart {
+			return true
+		}
+		final, restarts := n, 0
+		for next := final.Restart(); next != nil; next = final.Restart() {
+			final = next
+			restarts++
+		}
+		s := Summarize(final.Transaction)
+		s.Restarts = restarts
+		switch s.Handling {
+		case HandlingMiss, HandlingHitMiss, HandlingPass, HandlingHitPass, HandlingPipe:
+			if be := t.nodes[s.FetchVXID]; be != nil && be.Type == TypeBackend {
+				s.Backend = SummarizeBackend(be.Transaction).Backend
+			}
+		}
+		out = append(out, s)
+		return true
+	})
+	return out
+}
+
+// atoi parses a status code, returning 0 if it's malformed.
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
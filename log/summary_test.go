@@ -0,0 +1,124 @@
+package log_test
+
+import (
+	"testing"
+	"time"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func rec(tag varnishlog.Tag, data string) varnishlog.Record {
+	return varnishlog.Record{Tag: tag, Data: data}
+}
+
+func TestSummarizeHandling(t *testing.T) {
+	t.Parallel()
+	call := func(s string) varnishlog.Record { return rec(varnishlog.TagVCLCall, s) }
+	ret := func(s string) varnishlog.Record { return rec(varnishlog.TagVCLReturn, s) }
+
+	tests := []struct {
+		name    string
+		records []varnishlog.Record
+		want    varnishlog.Handling
+		hitVXID int64
+	}{
+		{"none", nil, varnishlog.HandlingUnknown, 0},
+		{"hit", []varnishlog.Record{call("RECV"), call("HASH"),
+			rec(varnishlog.TagHit, "7 119.9 10.0 0.0 7 0"), call("HIT"), call("DELIVER")}, varnishlog.HandlingHit, 7},
+		{"miss", []varnishlog.Record{call("RECV"), call("MISS")}, varnishlog.HandlingMiss, 0},
+		{"hitmiss", []varnishlog.Record{rec(varnishlog.TagHitMiss, "8 10.0"), call("MISS")}, varnishlog.HandlingHitMiss, 8},
+		{"hitpass", []varnishlog.Record{rec(varnishlog.TagHitPass, "9 10.0"), call("PASS")}, varnishlog.HandlingHitPass, 9},
+		{"pass from hit", []varnishlog.Record{call("HIT"), call("PASS")}, varnishlog.HandlingPass, 0},
+		{"synth", []varnishlog.Record{call("RECV"), ret("synth"), call("SYNTH")}, varnishlog.HandlingSynth, 0},
+		{"pipe", []varnishlog.Record{call("RECV"), ret("pipe"), call("PIPE")}, varnishlog.HandlingPipe, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := varnishlog.Summarize(txn(1, 2, 1, varnishlog.TypeRequest, varnishlog.ReasonRxReq, tt.records...))
+			if s.Handling != tt.want || s.HitVXID != tt.hitVXID {
+				t.Errorf("got %v (hit %d), want %v (hit %d)", s.Handling, s.HitVXID, tt.want, tt.hitVXID)
+			}
+		})
+	}
+}
+
+func TestTreeSummarize(t *testing.T) {
+	t.Parallel()
+	// req 10 restarts into 14, which passes (bereq 15) and includes ESI 12,
+	// a hit with a background fetch (bereq 13).
+	tree := varnishlog.NewTree([]varnishlog.Transaction{
+		txn(1, 10, 0, varnishlog.TypeRequest, varnishlog.ReasonRxReq,
+			rec(varnishlog.TagRespStatus, "404"), rec(varnishlog.TagVCLReturn, "restart"), link("req 14 restart")),
+		txn(2, 14, 10, varnishlog.TypeRequest, varnishlog.ReasonRestart,
+			rec(varnishlog.TagVCLCall, "PASS"), link("bereq 15 pass"), rec(varnishlog.TagRespStatus, "200"), link("req 12 esi 1")),
+		txn(3, 15, 14, varnishlog.TypeBackend, varnishlog.ReasonPass,
+			rec(varnishlog.TagBackendOpen, "31 api 10.0.0.1 80 10.0.0.2 4242 connect")),
+		txn(3, 12, 14, varnishlog.TypeRequest, varnishlog.ReasonESI,
+			rec(varnishlog.TagVCLCall, "HIT"), link("bereq 13 bgfetch"), rec(varnishlog.TagRespStatus, "200")),
+		txn(4, 13, 12, varnishlog.TypeBackend, varnishlog.ReasonBgFetch,
+			rec(varnishlog.TagBackendOpen, "32 static 10.0.0.3 80 10.0.0.2 4243 connect")),
+	})
+
+	got := tree.Summarize()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 summaries, got %+v", got)
+	}
+	if s := got[0]; s.VXID != 14 || s.Restarts != 1 || s.Status != 200 || s.Backend != "api" || s.Restarted {
+		t.Errorf("restarted request: got %+v", s)
+	}
+	if s := got[1]; s.VXID != 12 || s.Reason != varnishlog.ReasonESI || s.FetchVXID != 13 || s.Backend != "" {
+		t.Errorf("ESI hit: got %+v", s)
+	}
+}
+
+// TestSummarizeFile summarizes the transactions of test1_log.bin.
+func TestSummarizeFile(t *testing.T) {
+	t.Parallel()
+	r, err := varnishlog.New().SetFile(testBinPath()).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	tree := varnishlog.NewTree(collect(t, r))
+
+	be := varnishlog.SummarizeBackend(tree.Node(3).Transaction)
+	if be.Backend != "default" || be.Status != 200 || be.Method != "GET" || be.URL != "/" ||
+		be.Reason != varnishlog.ReasonFetch || be.TTFB != 3848*time.Microsecond ||
+		be.Duration != 4139*time.Microsecond || be.Acct.BodyRx != 2965 || be.FetchError != "" {
+		t.Errorf("SummarizeBackend(3): got %+v", be)
+	}
+
+	restarted := varnishlog.Summarize(tree.Node(32770).Transaction)
+	if !restarted.Restarted || restarted.Status != 404 || restarted.Handling != varnishlog.HandlingPass {
+		t.Errorf("Summarize(32770): got %+v", restarted)
+	}
+
+	got := tree.Summarize()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 summaries, got %+v", got)
+	}
+	want := []varnishlog.RequestSummary{{
+		VXID: 2, Reason: varnishlog.ReasonRxReq, ClientAddr: "127.0.0.1",
+		Method: "GET", URL: "/", Protocol: "HTTP/1.1", Status: 200, Handling: varnishlog.HandlingMiss, FetchVXID: 3,
+		Start: got[0].Start, TTFB: 4365 * time.Microsecond, Duration: 4495 * time.Microsecond,
+		Acct:    varnishlog.Acct{HeaderRx: 76, TotalRx: 76, HeaderTx: 224, BodyTx: 2965, TotalTx: 3189},
+		Backend: "default",
+	}, {
+		VXID: 32772, Reason: varnishlog.ReasonRestart, ClientAddr: "127.0.0.1",
+		Method: "GET", URL: "/unknown", Protocol: "HTTP/1.1", Status: 404, Handling: varnishlog.HandlingPass, FetchVXID: 32773,
+		Start: got[1].Start, TTFB: 4961 * time.Microsecond, Duration: 5110 * time.Microsecond,
+		Acct:    varnishlog.Acct{HeaderRx: 110, TotalRx: 110, HeaderTx: 216, BodyTx: 460, TotalTx: 676},
+		Backend: "default", Restarts: 1,
+	}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("summary %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+
+	// the restarted transaction keeps the start of the original request
+	start := time.Unix(1778275576, 965108000)
+	if d := got[1].Start.Sub(start); d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("restart Start: got %v, want %v", got[1].Start, start)
+	}
+}
@@ -1,6 +1,7 @@
 package log_test
 
 import (
+	"slices"
 	"testing"
 
 	varnishlog "github.com/varnish/varnish-go/log"
@@ -29,6 +30,26 @@ var tagNames = []string{
 	"VHA6", "VSL", "WAF", "Witness", "WorkThread", "XBody", "YKEY",
 }
 
+// TestTags verifies that every tag returned by Tags can be looked up by name.
+func TestTags(t *testing.T) {
+	t.Parallel()
+	tags := varnishlog.Tags()
+	if len(tags) == 0 {
+		t.Fatal("Tags returned no tags")
+	}
+	for _, tag := range tags {
+		got, err := varnishlog.TagByName(tag.String())
+		if err != nil || got != tag {
+			t.Errorf("TagByName(%q) = %d, %v; want %d", tag, got, err, tag)
+		}
+	}
+	for _, tag := range []varnishlog.Tag{varnishlog.TagBegin, varnishlog.TagReqURL, varnishlog.TagEnd} {
+		if !slices.Contains(tags, tag) {
+			t.Errorf("Tags is missing %s", tag)
+		}
+	}
+}
+
 func BenchmarkTagInit(b *testing.B) {
 	for b.Loop() {
 		for _, name := range tagNames {
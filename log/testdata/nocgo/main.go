@@ -0,0 +1,33 @@
+// Command nocgo prints the transactions of a VSL file, one line per record,
+// reading it with SetPureGo. It is built with CGO_ENABLED=0 by
+// TestBuildWithoutCgo.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func main() {
+	r, err := varnishlog.New().SetFile(os.Args[1]).SetPureGo(true).Attach()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer r.Close()
+	err = r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		for _, t := range txns {
+			for _, rec := range t.Records {
+				fmt.Printf("%d %s %s %s\n", t.VXID, t.Type, rec.Tag, rec.Data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,209 @@
+package log
+
+// Tree arranges a group of transactions, as delivered by [LogReader.Run] with
+// [GroupingRequest] or [GroupingSession], by their parent/child relationship.
+//
+//	err := r.Run(ctx, func(txns []log.Transaction) error {
+//	    t := log.NewTree(txns)
+//	    for _, n := range t.BackendFetches() {
+//	        fmt.Printf("req %d fetched %d (%s)\n", n.Parent.VXID, n.VXID, n.LinkReason)
+//	    }
+//	    return nil
+//	})
+type Tree struct {
+	roots []*Node
+	nodes map[int64]*Node
+}
+
+// Node is a transaction within a [Tree].
+type Node struct {
+	Transaction
+
+	// Parent is the transaction that started this one, nil for a root.
+	Parent *Node
+	// Children are the transactions this one started, in the order of its
+	// Link records.
+	Children []*Node
+	// LinkReason is the reason given by the parent's Link record for this
+	// transaction. It is [ReasonUnknown] for a root, or if the parent has no
+	// Link record for it.
+	LinkReason Reason
+}
+
+// NewTree builds a Tree from txns. Parents are found with [Transaction.ParentVXID],
+// falling back on the Begin record so transactions collected with [GroupingVXID]
+// can be arranged too. Transactions whose parent isn't part of txns are roots.
+func NewTree(txns []Transaction) *Tree {
+	t := &Tree{nodes: make(map[int64]*Node, len(txns))}
+	nodes := make([]*Node, len(txns))
+	for i, txn := range txns {
+		nodes[i] = &Node{Transaction: txn}
+		t.nodes[txn.VXID] = nodes[i]
+	}
+
+	// order[child] is the position of the child's Link record in its parent,
+	// reasons[child] the reason it gives
+	order := map[int64]int{}
+	reasons := map[int64]Reason{}
+	for _, n := range nodes {
+		i := 0
+		for _, rec := range n.Records {
+			if rec.Tag != TagLink {
+				continue
+			}
+			l, err := ParseLink(rec.Data)
+			if err != nil {
+				continue
+			}
+			order[int64(l.VXID)] = i
+			reasons[int64(l.VXID)] = l.Reason
+			i++
+		}
+	}
+
+	for _, n := range nodes {
+		parent := t.nodes[parentVXID(n.Transaction)]
+		if parent == nil || parent == n {
+			t.roots = append(t.roots, n)
+			continue
+		}
+		n.Parent = parent
+		n.LinkReason = reasons[n.VXID]
+		parent.Children = append(parent.Children, n)
+	}
+	for _, n := range nodes {
+		sortChildren(n.Children, order)
+	}
+	return t
+}
+
+// parentVXID returns the VXID of the transaction that started txn, or 0.
+func parentVXID(txn Transaction) int64 {
+	if txn.ParentVXID != 0 {
+		return txn.ParentVXID
+	}
+	for _, rec := range txn.Records {
+		if rec.Tag == TagBegin {
+			if b, err := ParseBegin(rec.Data); err == nil {
+				return int64(b.ParentVXID)
+			}
+			break
+		}
+	}
+	return 0
+}
+
+// sortChildren orders children by the position of their Link record. Children
+// without one keep their delivery order, after the linked ones.
+func sortChildren(children []*Node, order map[int64]int) {
+	pos := func(n *Node) int {
+		if i, ok := order[n.VXID]; ok {
+			return i
+		}
+		return len(order)
+	}
+	// insertion sort: stable, and groups are small
+	for i := 1; i < len(children); i++ {
+		for j := i; j > 0 && pos(children[j]) < pos(children[j-1]); j-- {
+			children[j], children[j-1] = children[j-1], children[j]
+		}
+	}
+}
+
+// Root returns the root of the tree: the client request with [GroupingRequest],
+// the session with [GroupingSession]. If the tree has several roots, the first
+// one is returned; it returns nil for an empty tree.
+func (t *Tree) Root() *Node {
+	if len(t.roots) == 0 {
+		return nil
+	}
+	return t.roots[0]
+}
+
+// Roots returns every transaction whose parent isn't part of the tree.
+func (t *Tree) Roots() []*Node {
+	return t.roots
+}
+
+// Node returns the transaction with the given VXID, or nil.
+func (t *Tree) Node(vxid int64) *Node {
+	return t.nodes[vxid]
+}
+
+// Children returns the transactions started by the transaction with the given
+// VXID, in the order of its Link records.
+func (t *Tree) Children(vxid int64) []*Node {
+	if n := t.nodes[vxid]; n != nil {
+		return n.Children
+	}
+	return nil
+}
+
+// Walk visits every transaction of the tree depth-first, parents before their
+// children, starting with the roots. If fn returns false, the children of that
+// transaction are skipped.
+func (t *Tree) Walk(fn func(n *Node) bool) {
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if !fn(n) {
+			return
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	for _, r := range t.roots {
+		walk(r)
+	}
+}
+
+// find returns the transactions for which keep returns true, in [Tree.Walk] order.
+func (t *Tree) find(keep func(n *Node) bool) []*Node {
+	var out []*Node
+	t.Walk(func(n *Node) bool {
+		if keep(n) {
+			out = append(out, n)
+		}
+		return true
+	})
+	return out
+}
+
+// BackendFetches returns the backend transactions of the tree, in [Tree.Walk] order.
+func (t *Tree) BackendFetches() []*Node {
+	return t.find(func(n *Node) bool { return n.Type == TypeBackend })
+}
+
+// ESIChildren returns the ESI subrequests of the tree, in [Tree.Walk] order.
+func (t *Tree) ESIChildren() []*Node {
+	return t.find(func(n *Node) bool { return n.StartReason() == ReasonESI })
+}
+
+// Restarts returns the client transactions created by a restart, in
+// [Tree.Walk] order: each one is a child of the request it restarted.
+func (t *Tree) Restarts() []*Node {
+	return t.find(func(n *Node) bool { return n.StartReason() == ReasonRestart })
+}
+
+// StartReason returns why n was started: the reason of its parent's Link
+// record, or its Begin reason if the parent didn't log a Link record for it.
+// It is [ReasonUnknown] for a root.
+func (n *Node) StartReason() Reason {
+	if n.LinkReason != ReasonUnknown {
+		return n.LinkReason
+	}
+	if n.Parent == nil {
+		return ReasonUnknown
+	}
+	return n.Reason
+}
+
+// Restart returns the request n restarted into, or nil if it didn't.
+func (n *Node) Restart() *Node {
+	for _, c := range n.Children {
+		if c.Type == TypeRequest && c.StartReason() == ReasonRestart {
+			return c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package log_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func vxids(nodes []*varnishlog.Node) []int64 {
+	var ids []int64
+	for _, n := range nodes {
+		ids = append(ids, n.VXID)
+	}
+	return ids
+}
+
+func txn(level int, vxid, parent int64, typ varnishlog.TransactionType, reason varnishlog.Reason, records ...varnishlog.Record) varnishlog.Transaction {
+	return varnishlog.Transaction{Level: level, VXID: vxid, ParentVXID: parent, Type: typ, Reason: reason, Records: records}
+}
+
+func link(data string) varnishlog.Record {
+	return varnishlog.Record{Tag: varnishlog.TagLink, Data: data}
+}
+
+func TestTree(t *testing.T) {
+	t.Parallel()
+	// req 10 includes ESI 12 then 11 (Link order differs from delivery order),
+	// ESI 11 fetches 13, and req 10 restarts into 14, which fetches 15.
+	tree := varnishlog.NewTree([]varnishlog.Transaction{
+		txn(1, 10, 0, varnishlog.TypeRequest, varnishlog.ReasonRxReq,
+			link("req 12 esi 1"), link("req 11 esi 1"), link("req 14 restart")),
+		txn(2, 11, 10, varnishlog.TypeRequest, varnishlog.ReasonESI, link("bereq 13 fetch")),
+		txn(2, 12, 10, varnishlog.TypeRequest, varnishlog.ReasonESI),
+		txn(3, 13, 11, varnishlog.TypeBackend, varnishlog.ReasonFetch),
+		txn(2, 14, 10, varnishlog.TypeRequest, varnishlog.ReasonRestart, link("bereq 15 pass")),
+		txn(3, 15, 14, varnishlog.TypeBackend, varnishlog.ReasonPass),
+	})
+
+	root := tree.Root()
+	if root == nil || root.VXID != 10 || root.Parent != nil {
+		t.Fatalf("Root: got %+v", root)
+	}
+	if got := vxids(tree.Children(10)); !slices.Equal(got, []int64{12, 11, 14}) {
+		t.Errorf("Children(10): got %v, want [12 11 14]", got)
+	}
+	if n := tree.Node(13); n == nil || n.Parent.VXID != 11 || n.LinkReason != varnishlog.ReasonFetch {
+		t.Errorf("Node(13): got %+v", n)
+	}
+	if tree.Node(99) != nil || tree.Children(99) != nil {
+		t.Error("expected no node for an unknown VXID")
+	}
+
+	var walked []int64
+	tree.Walk(func(n *varnishlog.Node) bool {
+		walked = append(walked, n.VXID)
+		return n.VXID != 11 // prune ESI 11's fetch
+	})
+	if !slices.Equal(walked, []int64{10, 12, 11, 14, 15}) {
+		t.Errorf("Walk: got %v, want [10 12 11 14 15]", walked)
+	}
+
+	if got := vxids(tree.BackendFetches()); !slices.Equal(got, []int64{13, 15}) {
+		t.Errorf("BackendFetches: got %v, want [13 15]", got)
+	}
+	if got := vxids(tree.ESIChildren()); !slices.Equal(got, []int64{12, 11}) {
+		t.Errorf("ESIChildren: got %v, want [12 11]", got)
+	}
+	if got := vxids(tree.Restarts()); !slices.Equal(got, []int64{14}) {
+		t.Errorf("Restarts: got %v, want [14]", got)
+	}
+	if r := root.Restart(); r == nil || r.VXID != 14 || tree.Node(14).Restart() != nil {
+		t.Errorf("Restart: got %+v, want 14 then nil", r)
+	}
+	if root.StartReason() != varnishlog.ReasonUnknown || tree.Node(12).StartReason() != varnishlog.ReasonESI {
+		t.Errorf("StartReason: got %s for the root, %s for 12", root.StartReason(), tree.Node(12).StartReason())
+	}
+}
+
+func TestTreeEmpty(t *testing.T) {
+	t.Parallel()
+	tree := varnishlog.NewTree(nil)
+	if tree.Root() != nil || len(tree.Roots()) != 0 {
+		t.Error("expected an empty tree")
+	}
+	tree.Walk(func(*varnishlog.Node) bool {
+		t.Error("Walk visited a node of an empty tree")
+		return true
+	})
+}
+
+// TestTreeFile builds trees from test1_log.bin with request grouping.
+func TestTreeFile(t *testing.T) {
+	t.Parallel()
+	r := newFileReader(t, varnishlog.GroupingRequest)
+
+	var trees []*varnishlog.Tree
+	err := r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		trees = append(trees, varnishlog.NewTree(txns))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(trees) != 2 {
+		t.Fatalf("expected 2 request groups, got %d", len(trees))
+	}
+
+	checkRestartTree(t, trees[1])
+	if got := vxids(trees[1].BackendFetches()); !slices.Equal(got, []int64{32771, 32773}) {
+		t.Errorf("group 2 BackendFetches: got %v, want [32771 32773]", got)
+	}
+
+	if got := vxids(trees[0].BackendFetches()); !slices.Equal(got, []int64{3}) {
+		t.Errorf("group 1 BackendFetches: got %v, want [3]", got)
+	}
+	if len(trees[0].Restarts()) != 0 || len(trees[0].ESIChildren()) != 0 {
+		t.Error("group 1: expected no restarts and no ESI")
+	}
+}
+
+// TestTreeVXID builds a tree from transactions collected with VXID grouping,
+// which carry no ParentVXID: parents come from the Begin records.
+func TestTreeVXID(t *testing.T) {
+	t.Parallel()
+	r, err := varnishlog.New().SetFile(testBinPath()).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tree := varnishlog.NewTree(collect(t, r))
+	if got := vxids(tree.Roots()); !slices.Equal(got, []int64{1, 32769}) {
+		t.Fatalf("Roots: got %v, want the two sessions [1 32769]", got)
+	}
+	if got := vxids(tree.Children(32769)); !slices.Equal(got, []int64{32770}) {
+		t.Fatalf("Children(32769): got %v, want [32770]", got)
+	}
+	checkRestartTree(t, tree)
+	if got := vxids(tree.BackendFetches()); !slices.Equal(got, []int64{3, 32771, 32773}) {
+		t.Errorf("BackendFetches: got %v, want [3 32771 32773]", got)
+	}
+}
+
+// checkRestartTree checks the second request of test1_log.bin: req 32770
+// passes (bereq 32771) and restarts into req 32772, which passes again (bereq 32773).
+func checkRestartTree(t *testing.T, tree *varnishlog.Tree) {
+	t.Helper()
+	if got := vxids(tree.Children(32770)); !slices.Equal(got, []int64{32771, 32772}) {
+		t.Errorf("Children(32770): got %v, want [32771 32772]", got)
+	}
+	restarts := tree.Restarts()
+	if got := vxids(restarts); !slices.Equal(got, []int64{32772}) {
+		t.Fatalf("Restarts: got %v, want [32772]", got)
+	}
+	if restarts[0].Parent.VXID != 32770 || restarts[0].LinkReason != varnishlog.ReasonRestart {
+		t.Errorf("restart: got parent %d, link reason %s", restarts[0].Parent.VXID, restarts[0].LinkReason)
+	}
+	if n := tree.Node(32773); n == nil || n.LinkReason != varnishlog.ReasonPass {
+		t.Errorf("Node(32773): expected a pass fetch, got %+v", n)
+	}
+}
@@ -0,0 +1,348 @@
+package log
+
+// #cgo pkg-config: varnishapi
+// #include <stdint.h>
+// #include <stdio.h>
+// #include <stdlib.h>
+// #include <vapi/vsm.h>
+// #include <vapi/vsl.h>
+//
+// extern int dispatchCallback(struct VSL_data*, struct VSL_transaction* const*, void*);
+//
+// static int callVSLQDispatch(struct VSLQ *vslq, uintptr_t priv) {
+//     return VSLQ_Dispatch(vslq, dispatchCallback, (void*)priv);
+// }
+//
+// static int callVSLQFlush(struct VSLQ *vslq, uintptr_t priv) {
+//     return VSLQ_Flush(vslq, dispatchCallback, (void*)priv);
+// }
+//
+// static const char* vslTagName(int tag) {
+//     if (tag <= 0 || tag >= SLT__MAX) return NULL;
+//     return VSL_tags[tag];
+// }
+//
+// static int vslTagMax(void) { return SLT__MAX; }
+//
+// static int vslTagBinary(int tag) {
+//     if (tag <= 0 || tag >= SLT__MAX) return 0;
+//     return (VSL_tagflags[tag] & SLT_F_BINARY) != 0;
+// }
+//
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"runtime/cgo"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// The Go values of the enums of libvarnishapi must match the C ones.
+var (
+	_ = [1]struct{}{}[GroupingSession-C.VSL_g_session]
+	_ = [1]struct{}{}[TypeRaw-C.VSL_t_raw]
+	_ = [1]struct{}{}[ReasonPipe-C.VSL_r_pipe]
+)
+
+// tagMax bounds the tag numbers, see Tags.
+var tagMax = int(C.vslTagMax())
+
+// tagName returns the name of t, "" if libvarnishapi doesn't know it.
+func tagName(t Tag) string {
+	s := C.vslTagName(C.int(t))
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
+
+func tagBinary(t Tag) bool { return C.vslTagBinary(C.int(t)) != 0 }
+
+// name2Tag is VSL_Name2Tag: it returns -1 for an unknown name, -2 for an
+// ambiguous one.
+func name2Tag(name string) int {
+	cs := C.CString(name)
+	defer C.free(unsafe.Pointer(cs))
+	return int(C.VSL_Name2Tag(cs, -1))
+}
+
+// VSL dispatch status codes, matching the C enum vsl_status.
+const (
+	vslMore     = 1
+	vslEnd      = 0
+	vslEEOF     = -1
+	vslEAbandon = -2
+	vslEOverrun = -3
+	vslEIO      = -4
+)
+
+// vapi reads the log through libvarnishapi's VSM, VSL and VSLQ handles.
+type vapi struct {
+	vsm    *C.struct_vsm
+	vsl    *C.struct_VSL_data
+	vslq   *C.struct_VSLQ
+	handle cgo.Handle
+}
+
+// attachVapi creates the handles configured by b, and attaches them for r.
+// On failure the handles are freed.
+func attachVapi(b *LogReaderBuilder, r *LogReader) (*vapi, error) {
+	a := &vapi{vsm: C.VSM_New()}
+	if a.vsm == nil {
+		return nil, fmt.Errorf("VSM_New failed")
+	}
+	if a.vsl = C.VSL_New(); a.vsl == nil {
+		C.VSM_Destroy(&a.vsm)
+		return nil, fmt.Errorf("VSL_New failed")
+	}
+	err := a.vsmArgs(b)
+	if err == nil {
+		err = a.vslArgs(b)
+	}
+	if err != nil {
+		C.VSL_Delete(a.vsl)
+		C.VSM_Destroy(&a.vsm)
+		return nil, err
+	}
+
+	var cquery *C.char
+	if b.query != "" {
+		cquery = C.CString(b.query)
+		defer C.free(unsafe.Pointer(cquery))
+	}
+
+	a.vslq = C.VSLQ_New(a.vsl, nil, C.enum_VSL_grouping_e(b.grouping), cquery)
+	if a.vslq == nil {
+		err := fmt.Errorf("VSLQ_New: %s", C.GoString(C.VSL_Error(a.vsl)))
+		C.VSL_Delete(a.vsl)
+		C.VSM_Destroy(&a.vsm)
+		return nil, err
+	}
+
+	if b.file == "" {
+		if ret := C.VSM_Attach(a.vsm, 0); ret != 0 {
+			err := fmt.Errorf("VSM_Attach: %s", C.GoString(C.VSM_Error(a.vsm)))
+			C.VSLQ_Delete(&a.vslq)
+			C.VSL_Delete(a.vsl)
+			C.VSM_Destroy(&a.vsm)
+			return nil, err
+		}
+	}
+	a.handle = cgo.NewHandle(r)
+	return a, nil
+}
+
+// vsmArgs passes the instance name and timeout to libvarnishapi.
+func (a *vapi) vsmArgs(b *LogReaderBuilder) error {
+	arg := func(opt byte, val string) error {
+		cs := C.CString(val)
+		defer C.free(unsafe.Pointer(cs))
+		if C.VSM_Arg(a.vsm, C.char(opt), cs) < 0 {
+			return fmt.Errorf("VSM_Arg -%c: %s", opt, C.GoString(C.VSM_Error(a.vsm)))
+		}
+		return nil
+	}
+	if b.name != "" {
+		if err := arg('n', b.name); err != nil {
+			return err
+		}
+	}
+	if b.timeout != nil {
+		val := "off"
+		if *b.timeout >= 0 {
+			val = strconv.FormatFloat(b.timeout.Seconds(), 'f', -1, 64)
+		}
+		if err := arg('t', val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vslArgs passes the filters and transaction limits to libvarnishapi.
+func (a *vapi) vslArgs(b *LogReaderBuilder) error {
+	arg := func(opt byte, val string) error {
+		var cs *C.char
+		if val != "" {
+			cs = C.CString(val)
+			defer C.free(unsafe.Pointer(cs))
+		}
+		if C.VSL_Arg(a.vsl, C.int(opt), cs) < 0 {
+			return fmt.Errorf("VSL_Arg -%c: %s", opt, C.GoString(C.VSL_Error(a.vsl)))
+		}
+		return nil
+	}
+	for _, f := range b.filters {
+		if err := arg(f.opt, f.vslArg()); err != nil {
+			return err
+		}
+	}
+	if b.clientOnly {
+		if err := arg('c', ""); err != nil {
+			return err
+		}
+	}
+	if b.backOnly {
+		if err := arg('b', ""); err != nil {
+			return err
+		}
+	}
+	if b.txnLimit > 0 {
+		if err := arg('L', strconv.Itoa(b.txnLimit)); err != nil {
+			return err
+		}
+	}
+	if b.txnTimeout > 0 {
+		if err := arg('T', strconv.FormatFloat(b.txnTimeout.Seconds(), 'f', -1, 64)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run reads the log of r, with the callbacks of callback.go.
+func (a *vapi) run(ctx context.Context, r *LogReader) error {
+	priv := C.uintptr_t(a.handle)
+	if r.file != "" {
+		return a.runFile(ctx, r, priv)
+	}
+	return a.runLive(ctx, r, priv)
+}
+
+func (a *vapi) runFile(ctx context.Context, r *LogReader, priv C.uintptr_t) error {
+	cs := C.CString(r.file)
+	defer C.free(unsafe.Pointer(cs))
+	c := C.VSL_CursorFile(a.vsl, cs, 0)
+	if c == nil {
+		return fmt.Errorf("VSL_CursorFile: %s", C.GoString(C.VSL_Error(a.vsl)))
+	}
+	C.VSLQ_SetCursor(a.vslq, &c)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		i := int(C.callVSLQDispatch(a.vslq, priv))
+		if err := r.takeHandlerErr(); err != nil {
+			return err
+		}
+		switch i {
+		case vslMore:
+			// keep going
+		case vslEnd, vslEEOF:
+			C.callVSLQFlush(a.vslq, priv)
+			return r.takeHandlerErr()
+		default:
+			return fmt.Errorf("VSL read error on %s: status %d", r.file, i)
+		}
+	}
+}
+
+func (a *vapi) runLive(ctx context.Context, r *LogReader, priv C.uintptr_t) error {
+	hascursor, opened := false, false
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		status := uint(C.VSM_Status(a.vsm))
+
+		if !hascursor {
+			if status&uint(C.VSM_WRK_RUNNING) == 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+				}
+				continue
+			}
+			opts := C.uint(C.VSL_COPT_BATCH)
+			if !r.backlog {
+				opts |= C.uint(C.VSL_COPT_TAIL)
+			}
+			c := C.VSL_CursorVSM(a.vsl, a.vsm, opts)
+			if c == nil {
+				r.notifyErr(ErrCursorLost)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(100 * time.Millisecond):
+				}
+				continue
+			}
+			C.VSLQ_SetCursor(a.vslq, &c)
+			hascursor = true
+			if opened {
+				r.stats.reconnects.Add(1)
+			}
+			opened = true
+		} else if status&uint(C.VSM_WRK_RESTARTED|C.VSM_WRK_CHANGED) != 0 {
+			// Worker restarted or VSM changed (e.g. VCL reload on Varnish Plus):
+			// existing cursor is stale — flush pending records and reconnect.
+			r.notifyErr(ErrWorkerRestarted)
+			C.callVSLQFlush(a.vslq, priv)
+			if err := r.takeHandlerErr(); err != nil {
+				return err
+			}
+			C.VSLQ_SetCursor(a.vslq, nil)
+			hascursor = false
+			continue
+		}
+
+		i := int(C.callVSLQDispatch(a.vslq, priv))
+		if err := r.takeHandlerErr(); err != nil {
+			return err
+		}
+
+		switch i {
+		case vslMore:
+			// more data available — loop immediately
+		case vslEnd:
+			// caught up to the live tail
+			if r.live != nil && !*r.live {
+				C.callVSLQFlush(a.vslq, priv)
+				return r.takeHandlerErr()
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		case vslEEOF:
+			return nil
+		case vslEOverrun:
+			r.notifyErr(ErrOverrun)
+			C.callVSLQFlush(a.vslq, priv)
+			if err := r.takeHandlerErr(); err != nil {
+				return err
+			}
+			C.VSLQ_SetCursor(a.vslq, nil)
+			hascursor = false
+		case vslEIO:
+			r.notifyErr(ErrIO)
+			C.callVSLQFlush(a.vslq, priv)
+			if err := r.takeHandlerErr(); err != nil {
+				return err
+			}
+			C.VSLQ_SetCursor(a.vslq, nil)
+			hascursor = false
+		default: // vslEAbandon and any unexpected status
+			r.notifyErr(ErrAbandoned)
+			C.callVSLQFlush(a.vslq, priv)
+			if err := r.takeHandlerErr(); err != nil {
+				return err
+			}
+			C.VSLQ_SetCursor(a.vslq, nil)
+			hascursor = false
+		}
+	}
+}
+
+func (a *vapi) close() {
+	C.VSLQ_Delete(&a.vslq)
+	C.VSL_Delete(a.vsl)
+	C.VSM_Destroy(&a.vsm)
+	a.handle.Delete()
+}
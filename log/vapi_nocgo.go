@@ -0,0 +1,163 @@
+//go:build !cgo
+
+package log
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// tagNames are the tags of Varnish Cache 7 and later, by number, used without
+// CGo; numbers missing from the table are unused. The tags of Varnish
+// Enterprise and of older versions may be numbered differently: with CGo, the
+// tags come from the installed libvarnishapi instead.
+var tagNames = [...]string{
+	1:  "Debug",
+	2:  "Error",
+	3:  "CLI",
+	4:  "SessOpen",
+	5:  "SessClose",
+	6:  "BackendOpen",
+	7:  "BackendClose",
+	8:  "HttpGarbage",
+	9:  "Proxy",
+	10: "ProxyGarbage",
+	11: "Backend",
+	13: "Length",
+	14: "FetchError",
+	15: "ReqMethod",
+	16: "ReqURL",
+	17: "ReqProtocol",
+	18: "ReqStatus",
+	19: "ReqReason",
+	20: "ReqHeader",
+	21: "ReqUnset",
+	22: "ReqLost",
+	23: "RespMethod",
+	24: "RespURL",
+	25: "RespProtocol",
+	26: "RespStatus",
+	27: "RespReason",
+	28: "RespHeader",
+	29: "RespUnset",
+	30: "RespLost",
+	31: "BereqMethod",
+	32: "BereqURL",
+	33: "BereqProtocol",
+	34: "BereqStatus",
+	35: "BereqReason",
+	36: "BereqHeader",
+	37: "BereqUnset",
+	38: "BereqLost",
+	39: "BerespMethod",
+	40: "BerespURL",
+	41: "BerespProtocol",
+	42: "BerespStatus",
+	43: "BerespReason",
+	44: "BerespHeader",
+	45: "BerespUnset",
+	46: "BerespLost",
+	47: "ObjMethod",
+	48: "ObjURL",
+	49: "ObjProtocol",
+	50: "ObjStatus",
+	51: "ObjReason",
+	52: "ObjHeader",
+	53: "ObjUnset",
+	54: "ObjLost",
+	55: "BogoHeader",
+	56: "LostHeader",
+	57: "TTL",
+	58: "Fetch_Body",
+	59: "VCL_acl",
+	60: "VCL_call",
+	61: "VCL_trace",
+	62: "VCL_return",
+	63: "ReqStart",
+	64: "Hit",
+	65: "HitPass",
+	66: "ExpBan",
+	67: "ExpKill",
+	68: "WorkThread",
+	69: "ESI_xmlerror",
+	70: "Hash",
+	71: "Backend_health",
+	72: "VCL_Log",
+	73: "VCL_Error",
+	74: "Gzip",
+	75: "Link",
+	76: "Begin",
+	77: "End",
+	78: "VSL",
+	79: "Storage",
+	80: "Timestamp",
+	81: "ReqAcct",
+	82: "PipeAcct",
+	83: "BereqAcct",
+	84: "VfpAcct",
+	85: "Witness",
+	86: "H2RxHdr",
+	87: "H2RxBody",
+	88: "H2TxHdr",
+	89: "H2TxBody",
+	90: "HitMiss",
+	91: "Filters",
+	92: "SessError",
+	93: "VCL_use",
+	94: "Notice",
+	95: "VdpAcct",
+}
+
+// tagMax bounds the tag numbers, see Tags.
+const tagMax = len(tagNames)
+
+// tagName returns the name of t, "" if it's unknown.
+func tagName(t Tag) string {
+	if t <= 0 || int(t) >= tagMax {
+		return ""
+	}
+	return tagNames[t]
+}
+
+// tagBinary reports whether t is one of the HTTP/2 frame tags, whose payload
+// isn't text.
+func tagBinary(t Tag) bool {
+	switch tagName(t) {
+	case "H2RxHdr", "H2RxBody", "H2TxHdr", "H2TxBody":
+		return true
+	}
+	return false
+}
+
+// name2Tag is VSL_Name2Tag: it matches name case-insensitively, or as the
+// prefix of a single tag, and returns -1 for an unknown name, -2 for an
+// ambiguous one.
+func name2Tag(name string) int {
+	n := -1
+	for i, tag := range tagNames {
+		switch {
+		case tag == "" || len(tag) < len(name) || !strings.EqualFold(tag[:len(name)], name):
+		case len(tag) == len(name):
+			return i
+		case n == -1:
+			n = i
+		default:
+			n = -2
+		}
+	}
+	return n
+}
+
+// vapi is unavailable without CGo, see SetPureGo.
+type vapi struct{}
+
+func attachVapi(*LogReaderBuilder, *LogReader) (*vapi, error) {
+	return nil, fmt.Errorf("libvarnishapi is not available without cgo, use SetPureGo")
+}
+
+func (a *vapi) run(context.Context, *LogReader) error {
+	return fmt.Errorf("libvarnishapi is not available without cgo")
+}
+
+func (a *vapi) close() {}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"context"
+	"unsafe"
+)
+
+// RecordView is a record borrowed from the reader's buffers, as delivered by
+// [LogReader.RunView]. It is only valid until the handler returns.
+type RecordView struct {
+	Tag       Tag
+	VXID      uint64
+	IsClient  bool
+	IsBackend bool
+	data      []byte
+}
+
+// Bytes returns the payload of the record, without the NUL terminator of text
+// records. The slice points into memory owned by the reader: it must not be
+// modified, nor used after the handler returns.
+func (v RecordView) Bytes() []byte { return v.data }
+
+// Record returns a copy of the record that stays valid after the handler returns.
+func (v RecordView) Record() Record {
+	return Record{
+		Tag:       v.Tag,
+		VXID:      v.VXID,
+		IsClient:  v.IsClient,
+		IsBackend: v.IsBackend,
+		Data:      string(v.data),
+	}
+}
+
+// TransactionView is a transaction borrowed from the reader, as delivered by
+// [LogReader.RunView]. Its Records slice is reused by the next callback.
+type TransactionView struct {
+	Level      int
+	VXID       int64
+	ParentVXID int64
+	Type       TransactionType
+	Reason     Reason
+	Records    []RecordView
+}
+
+// Transaction returns a copy of the transaction that stays valid after the
+// handler returns.
+func (t *TransactionView) Transaction() Transaction {
+	txn := Transaction{
+		Level:      t.Level,
+		VXID:       t.VXID,
+		ParentVXID: t.ParentVXID,
+		Type:       t.Type,
+		Reason:     t.Reason,
+	}
+	if len(t.Records) > 0 {
+		txn.Records = make([]Record, len(t.Records))
+		for i, v := range t.Records {
+			txn.Records[i] = v.Record()
+		}
+	}
+	return txn
+}
+
+// RunView is like [LogReader.Run], but hands out views of the records instead
+// of copies: payloads aren't copied into Go strings and the slices passed to
+// handler are reused from one call to the next, so reading doesn't allocate
+// once warmed up. Nothing passed to handler may be retained after it returns;
+// use [RecordView.Record] or [TransactionView.Transaction] to keep a copy.
+//
+// Combined with [LogReaderBuilder.SetRecordTags], this is the cheapest way to
+// extract a few fields from a busy instance:
+//
+//	r, err := log.New().SetRecordTags(log.TagReqURL, log.TagRespStatus).Attach()
+//	...
+//	err = r.RunView(ctx, func(txns []log.TransactionView) error {
+//	    for _, txn := range txns {
+//	        for _, rec := range txn.Records {
+//	            counts[string(rec.Bytes())]++ // the map key is a copy
+//	        }
+//	    }
+//	    return nil
+//	})
+//
+// With [LogReaderBuilder.SetPureGo], records are still decoded into strings
+// first; only the slices are reused.
+func (r *LogReader) RunView(ctx context.Context, handler func([]TransactionView) error) error {
+	r.viewHandler = handler
+	r.handler = r.dispatchViewFile
+	defer func() { r.viewHandler, r.handler = nil, nil }()
+	return r.run(ctx)
+}
+
+// dispatchViewFile hands the transactions of the pure-Go file reader to the
+// RunView handler.
+func (r *LogReader) dispatchViewFile(txns []Transaction) error {
+	r.views, r.viewRecs = r.views[:0], r.viewRecs[:0]
+	for _, txn := range txns {
+		for _, rec := range txn.Records {
+			r.viewRecs = append(r.viewRecs, RecordView{
+				Tag:       rec.Tag,
+				VXID:      rec.VXID,
+				IsClient:  rec.IsClient,
+				IsBackend: rec.IsBackend,
+				data:      unsafe.Slice(unsafe.StringData(rec.Data), len(rec.Data)),
+			})
+		}
+		r.views = append(r.views, TransactionView{
+			Level:      txn.Level,
+			VXID:       txn.VXID,
+			ParentVXID: txn.ParentVXID,
+			Type:       txn.Type,
+			Reason:     txn.Reason,
+		})
+	}
+	start := 0
+	for i, txn := range txns {
+		if end := start + len(txn.Records); end > start {
+			r.views[i].Records = r.viewRecs[start:end:end]
+			start = end
+		}
+	}
+	return r.viewHandler(r.views)
+}
+
+// keepTag reports whether records with the given tag are delivered, see
+// [LogReaderBuilder.SetRecordTags].
+func (r *LogReader) keepTag(tag int) bool {
+	return r.recordTags == nil || (tag > 0 && tag < len(r.recordTags) && r.recordTags[tag])
+}
+
+// keepRecord is keepTag plus the filters of [LogReaderBuilder.IncludeTags] and
+// friends, for records that didn't go through VSL_Match.
+func (r *LogReader) keepRecord(rec Record) bool {
+	return r.keepTag(int(rec.Tag)) && (r.filter == nil || r.filter.match(rec))
+}
+
+// skipEmpty reports whether a transaction left without records by
+// SetRecordTags or the record filters is dropped rather than delivered.
+func (r *LogReader) skipEmpty() bool {
+	return (r.recordTags != nil || r.vslMatch) && r.grouping == GroupingRaw
+}
@@ -0,0 +1,182 @@
+package log_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	varnishlog "github.com/varnish/varnish-go/log"
+)
+
+func attachFile(tb testing.TB, path string, grouping varnishlog.Grouping, pureGo bool, tags ...varnishlog.Tag) *varnishlog.LogReader {
+	tb.Helper()
+	r, err := varnishlog.New().
+		SetGrouping(grouping).
+		SetFile(path).
+		SetPureGo(pureGo).
+		SetRecordTags(tags...).
+		Attach()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return r
+}
+
+// collectViews reads every transaction delivered by r.RunView, copied.
+func collectViews(t *testing.T, r *varnishlog.LogReader) []varnishlog.Transaction {
+	t.Helper()
+	var all []varnishlog.Transaction
+	err := r.RunView(context.Background(), func(txns []varnishlog.TransactionView) error {
+		for i := range txns {
+			all = append(all, txns[i].Transaction())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunView: %v", err)
+	}
+	return all
+}
+
+// TestRunView verifies that RunView delivers the same transactions as Run.
+func TestRunView(t *testing.T) {
+	t.Parallel()
+	skipIfEnterprise(t)
+	for _, pureGo := range []bool{false, true} {
+		for _, grouping := range []varnishlog.Grouping{varnishlog.GroupingRaw, varnishlog.GroupingVXID} {
+			r := attachFile(t, testBinPath(), grouping, pureGo)
+			want := collect(t, r)
+			r.Close()
+
+			r = attachFile(t, testBinPath(), grouping, pureGo)
+			got := collectViews(t, r)
+			r.Close()
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("pureGo %v, grouping %d: RunView differs from Run:\ngot:  %+v\nwant: %+v", pureGo, grouping, got, want)
+			}
+		}
+	}
+}
+
+func TestSetRecordTags(t *testing.T) {
+	t.Parallel()
+	skipIfEnterprise(t)
+	tags := []varnishlog.Tag{varnishlog.TagReqURL, varnishlog.TagRespStatus}
+	for _, pureGo := range []bool{false, true} {
+		r := attachFile(t, testBinPath(), varnishlog.GroupingVXID, pureGo, tags...)
+		txns := collect(t, r)
+		r.Close()
+
+		if len(txns) != 8 {
+			t.Fatalf("pureGo %v: expected all 8 transactions, got %d", pureGo, len(txns))
+		}
+		var n int
+		for _, txn := range txns {
+			for _, rec := range txn.Records {
+				if rec.Tag != varnishlog.TagReqURL && rec.Tag != varnishlog.TagRespStatus {
+					t.Errorf("pureGo %v: unexpected %s record in %d", pureGo, rec.Tag, txn.VXID)
+				}
+				n++
+			}
+			if txn.VXID == 2 {
+				want := []varnishlog.Record{
+					{Tag: varnishlog.TagReqURL, VXID: 2, IsClient: true, Data: "/"},
+					{Tag: varnishlog.TagRespStatus, VXID: 2, IsClient: true, Data: "200"},
+				}
+				if !reflect.DeepEqual(txn.Records, want) {
+					t.Errorf("pureGo %v: transaction 2: got %+v, want %+v", pureGo, txn.Records, want)
+				}
+			}
+		}
+		if n != 6 {
+			t.Errorf("pureGo %v: expected 6 records, got %d", pureGo, n)
+		}
+
+		// raw grouping: the other records aren't delivered at all
+		r = attachFile(t, testBinPath(), varnishlog.GroupingRaw, pureGo, tags...)
+		raw := collectViews(t, r)
+		r.Close()
+		if len(raw) != 6 {
+			t.Errorf("pureGo %v, raw grouping: expected 6 transactions, got %d", pureGo, len(raw))
+		}
+	}
+}
+
+// benchFile writes a VSL file holding n copies of the records of test1_log.bin.
+func benchFile(b *testing.B, n int) string {
+	b.Helper()
+	r := attachFile(b, testBinPath(), varnishlog.GroupingRaw, true)
+	var recs []varnishlog.Record
+	err := r.Run(context.Background(), func(txns []varnishlog.Transaction) error {
+		for _, txn := range txns {
+			recs = append(recs, txn.Records...)
+		}
+		return nil
+	})
+	r.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	path := filepath.Join(b.TempDir(), "bench.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	w := varnishlog.NewWriter(f)
+	for range n {
+		for _, rec := range recs {
+			if err := w.WriteRecord(rec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// BenchmarkRead compares Run, which copies every record, with RunView and
+// SetRecordTags, reading a file with VXID grouping.
+func BenchmarkRead(b *testing.B) {
+	if testing.Short() {
+		b.Skip("skipping in short mode")
+	}
+	path := benchFile(b, 1000)
+	urlOnly := []varnishlog.Tag{varnishlog.TagReqURL}
+	for _, bc := range []struct {
+		name   string
+		pureGo bool
+		view   bool
+		tags   []varnishlog.Tag
+	}{
+		{"Run", false, false, nil},
+		{"Run/tags", false, false, urlOnly},
+		{"RunView", false, true, nil},
+		{"RunView/tags", false, true, urlOnly},
+		{"PureGo/Run", true, false, nil},
+		{"PureGo/RunView", true, true, nil},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				r := attachFile(b, path, varnishlog.GroupingVXID, bc.pureGo, bc.tags...)
+				var err error
+				if bc.view {
+					err = r.RunView(context.Background(), func([]varnishlog.TransactionView) error { return nil })
+				} else {
+					err = r.Run(context.Background(), func([]varnishlog.Transaction) error { return nil })
+				}
+				r.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
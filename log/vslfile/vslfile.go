@@ -0,0 +1,225 @@
+// Read and write binary VSL files (as used by varnishlog -r/-w) in pure Go
+package vslfile
+
+// Unlike the rest of the log package, vslfile doesn't use libvarnishapi or
+// CGo: it only understands the on-disk framing of the records, so it can be
+// used to inspect log dumps on machines without Varnish installed.
+//
+// Tags are returned as raw numbers. Their names, and whether their payload is
+// text or binary, depend on the Varnish version that wrote the file; use
+// [github.com/varnish/varnish-go/log] to resolve them, or its
+// LogReaderBuilder.SetPureGo to get grouped transactions; both also work
+// without CGo.
+//
+// # Usage
+//
+//	f, err := os.Open("varnish.log")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer f.Close()
+//
+//	r, err := vslfile.NewReader(f)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for {
+//	    rec, err := r.Next()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        log.Fatal(err)
+//	    }
+//	    fmt.Printf("%d %d %q\n", rec.VXID, rec.Tag, rec.Data)
+//	}
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format identifies the record framing used by a VSL file.
+type Format int
+
+const (
+	// FormatVSL2 is the current format (Varnish 7.3 and later): a three word
+	// header per record, with a 64-bit VXID. The file starts with "VSL2".
+	FormatVSL2 Format = iota
+
+	// FormatVSL1 is the legacy format (older Varnish Cache releases and
+	// Varnish Enterprise 6): a two word header per record, with a 32-bit VXID.
+	// The file starts with "VSL\0".
+	FormatVSL1
+)
+
+// String returns the file magic of the format, without the trailing NUL.
+func (f Format) String() string {
+	switch f {
+	case FormatVSL2:
+		return "VSL2"
+	case FormatVSL1:
+		return "VSL"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+// Record framing, mirroring vapi/vsl_int.h.
+const (
+	idShift  = 24
+	lenMask  = 0xffff
+	verShift = 16
+	version3 = 1 // record version written in VSL2 files
+
+	clientMarker2  = uint64(1) << 62
+	backendMarker2 = uint64(1) << 63
+	identMask2     = ^(uint64(3) << 62)
+
+	clientMarker1  = uint32(1) << 30
+	backendMarker1 = uint32(1) << 31
+	identMask1     = ^(uint32(3) << 30)
+)
+
+// ErrBadMagic is returned by [NewReader] when the input doesn't start with a
+// known VSL file header.
+var ErrBadMagic = errors.New("not a VSL file")
+
+// Record is a single VSL record as stored in the file.
+type Record struct {
+	Tag     uint8  // numeric tag, as defined by the Varnish version that wrote the file
+	VXID    uint64 // transaction ID, with the client/backend markers masked out; 0 for non-transactional records
+	Client  bool   // the record belongs to a client-side transaction
+	Backend bool   // the record belongs to a backend-side transaction
+	Data    []byte // payload, exactly as long as the record length: text records include their terminating NUL
+}
+
+// ErrTooLong is returned by [Writer.WriteRecord] when a payload doesn't fit in a record.
+var ErrTooLong = errors.New("VSL record payload longer than 65535 bytes")
+
+// Reader reads records from a VSL file.
+type Reader struct {
+	r      *bufio.Reader
+	format Format
+	hdr    []byte
+}
+
+// NewReader reads the file header from r and returns a Reader positioned on the
+// first record. It returns [ErrBadMagic] if r is not a VSL file.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var magic [4]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrBadMagic
+		}
+		return nil, fmt.Errorf("read VSL header: %w", err)
+	}
+	vr := &Reader{r: br}
+	switch string(magic[:]) {
+	case "VSL2":
+		vr.format = FormatVSL2
+		vr.hdr = make([]byte, 12)
+	case "VSL\x00":
+		vr.format = FormatVSL1
+		vr.hdr = make([]byte, 8)
+	default:
+		return nil, ErrBadMagic
+	}
+	return vr, nil
+}
+
+// Format returns the framing of the file being read.
+func (r *Reader) Format() Format { return r.format }
+
+// Next returns the next record. It returns [io.EOF] once all records have been
+// read, and an error wrapping [io.ErrUnexpectedEOF] if the file ends in the
+// middle of a record.
+func (r *Reader) Next() (Record, error) {
+	if _, err := io.ReadFull(r.r, r.hdr); err != nil {
+		if err == io.EOF {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("read VSL record: %w", err)
+	}
+	word0 := binary.NativeEndian.Uint32(r.hdr)
+	rec := Record{Tag: uint8(word0 >> idShift)}
+	if r.format == FormatVSL2 {
+		// the 64-bit ID is stored as two native words, low word first
+		id := uint64(binary.NativeEndian.Uint32(r.hdr[8:]))<<32 | uint64(binary.NativeEndian.Uint32(r.hdr[4:]))
+		rec.VXID = id & identMask2
+		rec.Client = id&clientMarker2 != 0
+		rec.Backend = id&backendMarker2 != 0
+	} else {
+		id := binary.NativeEndian.Uint32(r.hdr[4:])
+		rec.VXID = uint64(id & identMask1)
+		rec.Client = id&clientMarker1 != 0
+		rec.Backend = id&backendMarker1 != 0
+	}
+
+	n := int(word0 & lenMask)
+	padded := (n + 3) &^ 3
+	buf := make([]byte, padded)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, fmt.Errorf("read VSL record: %w", err)
+	}
+	rec.Data = buf[:n:n]
+	return rec, nil
+}
+
+// Writer writes records to a VSL file, in the [FormatVSL2] framing used by
+// current Varnish versions. Payloads are padded to a word boundary with zeros;
+// varnishd leaves that padding uninitialized, so copying a file record by record
+// only reproduces it byte for byte once its padding is cleared.
+type Writer struct {
+	w   *bufio.Writer
+	hdr [12]byte
+}
+
+// NewWriter returns a Writer that writes a VSL file to w. The header and the
+// records are buffered: call [Writer.Flush] once done.
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("VSL2") // can't fail on a fresh bufio.Writer
+	return &Writer{w: bw}
+}
+
+// WriteRecord appends rec to the file. rec.Data is written as is: text
+// payloads must include their terminating NUL.
+func (w *Writer) WriteRecord(rec Record) error {
+	if len(rec.Data) > lenMask {
+		return ErrTooLong
+	}
+	id := rec.VXID & identMask2
+	if rec.Client {
+		id |= clientMarker2
+	}
+	if rec.Backend {
+		id |= backendMarker2
+	}
+	binary.NativeEndian.PutUint32(w.hdr[0:], uint32(rec.Tag)<<idShift|version3<<verShift|uint32(len(rec.Data)))
+	binary.NativeEndian.PutUint32(w.hdr[4:], uint32(id))
+	binary.NativeEndian.PutUint32(w.hdr[8:], uint32(id>>32))
+	if _, err := w.w.Write(w.hdr[:]); err != nil {
+		return fmt.Errorf("write VSL record: %w", err)
+	}
+	if _, err := w.w.Write(rec.Data); err != nil {
+		return fmt.Errorf("write VSL record: %w", err)
+	}
+	var pad [3]byte
+	if _, err := w.w.Write(pad[:(4-len(rec.Data)%4)%4]); err != nil {
+		return fmt.Errorf("write VSL record: %w", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered records to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,190 @@
+package vslfile_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/varnish/varnish-go/log/vslfile"
+)
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open(filepath.Join("..", "testdata", "test1_log.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := vslfile.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Format() != vslfile.FormatVSL2 {
+		t.Errorf("Format: got %v, want VSL2", r.Format())
+	}
+
+	var recs []vslfile.Record
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) == 0 {
+		t.Fatal("no records read")
+	}
+
+	// the file starts with the CLI records of the boot VCL load
+	first := recs[0]
+	if first.VXID != 0 || first.Client || first.Backend {
+		t.Errorf("first record: expected a non-transactional record, got %+v", first)
+	}
+	if !bytes.HasPrefix(first.Data, []byte("Rd vcl.load")) || first.Data[len(first.Data)-1] != 0 {
+		t.Errorf("first record: unexpected payload %q", first.Data)
+	}
+
+	vxids := map[uint64]bool{}
+	for _, rec := range recs {
+		if rec.Client && rec.Backend {
+			t.Errorf("vxid %d: record marked both client and backend", rec.VXID)
+		}
+		if rec.VXID != 0 {
+			vxids[rec.VXID] = true
+		}
+	}
+	// sess 1, req 2, bereq 3, sess 32769, req 32770, bereq 32771, req 32772, bereq 32773
+	if len(vxids) != 8 {
+		t.Errorf("expected 8 distinct VXIDs, got %d", len(vxids))
+	}
+}
+
+func TestReadLegacyFormat(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	buf.WriteString("VSL\x00")
+	for _, rec := range []struct {
+		tag  uint32
+		id   uint32
+		data string
+	}{
+		{76, 1<<30 | 1002, "req 1001 rxreq\x00"},
+		{77, 1<<31 | 1003, "\x00"},
+	} {
+		_ = binary.Write(&buf, binary.NativeEndian, rec.tag<<24|uint32(len(rec.data)))
+		_ = binary.Write(&buf, binary.NativeEndian, rec.id)
+		buf.WriteString(rec.data)
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+
+	r, err := vslfile.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Format() != vslfile.FormatVSL1 {
+		t.Errorf("Format: got %v, want VSL", r.Format())
+	}
+	rec, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Tag != 76 || rec.VXID != 1002 || !rec.Client || rec.Backend || string(rec.Data) != "req 1001 rxreq\x00" {
+		t.Errorf("first record: got %+v", rec)
+	}
+	rec, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Tag != 77 || rec.VXID != 1003 || rec.Client || !rec.Backend || len(rec.Data) != 1 {
+		t.Errorf("second record: got %+v", rec)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := vslfile.NewReader(bytes.NewReader([]byte("GIF89a"))); !errors.Is(err, vslfile.ErrBadMagic) {
+		t.Errorf("bad magic: got %v, want ErrBadMagic", err)
+	}
+	if _, err := vslfile.NewReader(bytes.NewReader(nil)); !errors.Is(err, vslfile.ErrBadMagic) {
+		t.Errorf("empty input: got %v, want ErrBadMagic", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join("..", "testdata", "test1_log.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cut the first record in the middle of its payload
+	r, err := vslfile.NewReader(bytes.NewReader(b[:4+12+8]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated record: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// zeroPadding returns a copy of a VSL2 file with the padding after each record
+// payload cleared. varnishd doesn't initialize it, so it holds garbage.
+func zeroPadding(b []byte) []byte {
+	out := bytes.Clone(b)
+	for off := 4; off+12 <= len(out); {
+		n := int(binary.NativeEndian.Uint32(out[off:]) & 0xffff)
+		data := off + 12
+		end := data + (n+3)&^3
+		clear(out[data+n : end])
+		off = end
+	}
+	return out
+}
+
+// TestWriteRoundTrip copies every record of test1_log.bin and verifies the
+// output is byte-for-byte identical, padding aside.
+func TestWriteRoundTrip(t *testing.T) {
+	t.Parallel()
+	orig, err := os.ReadFile(filepath.Join("..", "testdata", "test1_log.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := vslfile.NewReader(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := vslfile.NewWriter(&buf)
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), zeroPadding(orig)) {
+		t.Errorf("round-tripped file differs from test1_log.bin (%d bytes, want %d)", buf.Len(), len(orig))
+	}
+
+	if err := w.WriteRecord(vslfile.Record{Tag: 1, Data: make([]byte, 1<<16)}); !errors.Is(err, vslfile.ErrTooLong) {
+		t.Errorf("oversized payload: got %v, want ErrTooLong", err)
+	}
+}
@@ -0,0 +1,79 @@
+package log
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/varnish/varnish-go/log/vslfile"
+)
+
+// Writer serializes records to the binary VSL format, producing files that
+// varnishlog -r and [LogReaderBuilder.SetFile] can read back.
+//
+// Tag numbers are written as resolved against the installed libvarnishapi, so
+// files should be read back with the same Varnish version.
+//
+// A Writer can capture transactions straight from a [LogReader]:
+//
+//	w := log.NewWriter(f)
+//	err := r.Run(ctx, w.WriteTransactions)
+//	if err == nil {
+//	    err = w.Flush()
+//	}
+type Writer struct {
+	w *vslfile.Writer
+}
+
+// NewWriter returns a Writer that writes a VSL file to w. Output is buffered:
+// call [Writer.Flush] once done.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: vslfile.NewWriter(w)}
+}
+
+// WriteRecord writes a single record. The NUL terminator that [Record.Data]
+// doesn't carry is added back to text records.
+func (w *Writer) WriteRecord(rec Record) error {
+	if rec.Tag <= 0 || rec.Tag > 0xff {
+		return fmt.Errorf("write VSL record: invalid tag %d", int(rec.Tag))
+	}
+	data := []byte(rec.Data)
+	if !rec.Tag.isBinary() {
+		data = append(data, 0)
+	}
+	return w.w.WriteRecord(vslfile.Record{
+		Tag:     uint8(rec.Tag),
+		VXID:    rec.VXID,
+		Client:  rec.IsClient,
+		Backend: rec.IsBackend,
+		Data:    data,
+	})
+}
+
+// WriteTransaction writes all the records of txn, in order.
+func (w *Writer) WriteTransaction(txn Transaction) error {
+	for _, rec := range txn.Records {
+		if err := w.WriteRecord(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTransactions writes the records of every transaction in txns. Its
+// signature matches the handler of [LogReader.Run].
+//
+// Note that grouped transactions are written one after the other: reading the
+// file back with raw grouping won't reproduce the original interleaving.
+func (w *Writer) WriteTransactions(txns []Transaction) error {
+	for _, txn := range txns {
+		if err := w.WriteTransaction(txn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
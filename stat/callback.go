@@ -18,12 +18,20 @@ func clientFromPriv(priv unsafe.Pointer) *StatReader {
 func newPointCallback(priv unsafe.Pointer, pt *C.struct_VSC_point) unsafe.Pointer {
 	c := clientFromPriv(priv)
 	key := C.GoString(pt.name)
+	level := LevelUnknown
+	if pt.level != nil {
+		level = levelFromName(C.GoString(pt.level.name))
+	}
+	if !c.keep(key, level) {
+		return nil
+	}
 	c.Stats[key] = Counter{
 		SDesc:     C.GoString(pt.sdesc),
 		LDesc:     C.GoString(pt.ldesc),
 		Value:     (*uint64)(unsafe.Pointer(pt.ptr)),
 		Semantics: semanticsFromC(C.int(pt.semantics)),
 		Flags:     flagsFromC(C.int(pt.format)),
+		Level:     level,
 	}
 	c.added = append(c.added, key)
 
@@ -34,6 +42,9 @@ func newPointCallback(priv unsafe.Pointer, pt *C.struct_VSC_point) unsafe.Pointe
 func delPointCallback(priv unsafe.Pointer, pt *C.struct_VSC_point) {
 	c := clientFromPriv(priv)
 	key := C.GoString(pt.name)
+	if _, ok := c.Stats[key]; !ok {
+		return // filtered out
+	}
 	delete(c.Stats, key)
 	c.removed = append(c.removed, key)
 }
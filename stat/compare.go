@@ -0,0 +1,77 @@
+package stat
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exceeded is a threshold that held between two snapshots, see [Compare].
+type Exceeded struct {
+	Threshold Threshold `json:"threshold" yaml:"threshold"`
+	Before    uint64    `json:"before"    yaml:"before"` // value in the earlier snapshot
+	Delta     Delta     `json:"delta"     yaml:"delta"`
+}
+
+// Report is the comparison of two snapshots, as returned by [Compare].
+type Report struct {
+	Deltas   Deltas     `json:"deltas"   yaml:"deltas"`
+	Exceeded []Exceeded `json:"exceeded" yaml:"exceeded"` // by counter name
+}
+
+// Compare computes the [Diff] between two snapshots, e.g. taken before and
+// after a load test, and checks each threshold against it. Thresholds on
+// counters missing from either snapshot never hold.
+//
+//	report := stat.Compare(before, after,
+//	    stat.OnDelta("MAIN.backend_fail", stat.Above, 0),
+//	    stat.OnRate("MAIN.client_req", stat.Below, 1000),
+//	)
+//	if len(report.Exceeded) > 0 {
+//	    report.WriteTo(os.Stderr)
+//	}
+func Compare(before, after Snapshot, thresholds ...Threshold) Report {
+	r := Report{Deltas: Diff(before, after)}
+	for _, t := range thresholds {
+		if t.Check(r.Deltas) {
+			r.Exceeded = append(r.Exceeded, Exceeded{
+				Threshold: t,
+				Before:    before.Values[t.Name].Value,
+				Delta:     r.Deltas.Counters[t.Name],
+			})
+		}
+	}
+	slices.SortStableFunc(r.Exceeded, func(a, b Exceeded) int {
+		return cmp.Compare(a.Threshold.Name, b.Threshold.Name)
+	})
+	return r
+}
+
+// WriteTo writes the report as a table of the exceeded thresholds, one per
+// line. Implements [io.WriterTo].
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "interval: %s", r.Deltas.Interval)
+	if r.Deltas.Restarted {
+		b.WriteString(" (child restarted)")
+	}
+	b.WriteByte('\n')
+	if len(r.Exceeded) == 0 {
+		b.WriteString("no threshold exceeded\n")
+	} else {
+		tw := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "COUNTER\tBEFORE\tAFTER\tDELTA\tRATE\tTHRESHOLD")
+		for _, e := range r.Exceeded {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n",
+				e.Threshold.Name, e.Before, e.Delta.Value, e.Delta.Delta,
+				strconv.FormatFloat(e.Delta.Rate, 'f', 2, 64), e.Threshold)
+		}
+		tw.Flush()
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
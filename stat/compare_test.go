@@ -0,0 +1,64 @@
+package stat_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	before, err := stat.LoadSnapshot(filepath.Join("testdata", "varnishstat-6.0.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := stat.LoadSnapshot(filepath.Join("testdata", "varnishstat-7.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := stat.Compare(before, after,
+		stat.OnRate("MAIN.client_req", stat.Below, 200),
+		stat.OnDelta("MAIN.backend_fail", stat.Above, 0),
+		stat.OnValue("SMA.s0.g_bytes", stat.Above, 1<<30),
+		stat.OnDelta("MAIN.n_object", stat.Above, 500),
+		stat.OnDelta("MAIN.missing", stat.Above, 0),
+	)
+	if r.Deltas.Interval != 10*time.Minute || r.Deltas.Restarted {
+		t.Errorf("got interval %s, restarted %v", r.Deltas.Interval, r.Deltas.Restarted)
+	}
+	var got []string
+	for _, e := range r.Exceeded {
+		got = append(got, e.Threshold.String())
+	}
+	want := []string{"delta(MAIN.backend_fail) > 0", "rate(MAIN.client_req) < 200", "delta(MAIN.n_object) > 500"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got exceeded %q, want %q", got, want)
+	}
+	if e := r.Exceeded[1]; e.Before != 60000 || e.Delta.Value != 120000 || e.Delta.Rate != 100 {
+		t.Errorf("MAIN.client_req: got %+v", e)
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	wantText := `interval: 10m0s
+COUNTER            BEFORE  AFTER   DELTA  RATE    THRESHOLD
+MAIN.backend_fail  0       3       3      0.01    delta(MAIN.backend_fail) > 0
+MAIN.client_req    60000   120000  60000  100.00  rate(MAIN.client_req) < 200
+MAIN.n_object      4000    5000    1000   0.00    delta(MAIN.n_object) > 500
+`
+	if b.String() != wantText {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), wantText)
+	}
+
+	b.Reset()
+	stat.Compare(before, after).WriteTo(&b)
+	if got := b.String(); got != "interval: 10m0s\nno threshold exceeded\n" {
+		t.Errorf("got %q", got)
+	}
+}
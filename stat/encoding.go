@@ -0,0 +1,267 @@
+package stat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// varnishstatTime is the layout of the timestamp of varnishstat -j, in local
+// time.
+const varnishstatTime = "2006-01-02T15:04:05"
+
+// snapshotMagic starts the binary encoding of a [Snapshot], followed by its
+// version.
+const snapshotMagic = "VSCS\x01"
+
+// char returns the semantics character of varnishstat -j, '?' if unknown.
+func (s Semantics) char() byte {
+	switch s {
+	case SemanticsCounter:
+		return 'c'
+	case SemanticsGauge:
+		return 'g'
+	case SemanticsBitmap:
+		return 'b'
+	case SemanticsBoolean:
+		return 'q'
+	default:
+		return '?'
+	}
+}
+
+// char returns the format character of varnishstat -j, '?' if unknown.
+func (f Flags) char() byte {
+	switch f {
+	case FlagsInteger:
+		return 'i'
+	case FlagsBytes:
+		return 'B'
+	case FlagsBitmap:
+		return 'b'
+	case FlagsBoolean:
+		return 'q'
+	case FlagsDuration:
+		return 'd'
+	default:
+		return '?'
+	}
+}
+
+// jsonCounter is a counter in the output of varnishstat -j.
+type jsonCounter struct {
+	Description string `json:"description"`
+	// Type and Ident are only set by Varnish before 6.5.
+	Type   string `json:"type,omitempty"`
+	Ident  string `json:"ident,omitempty"`
+	Flag   string `json:"flag"`
+	Format string `json:"format"`
+	Value  uint64 `json:"value"`
+}
+
+// jsonSnapshot is the layout of varnishstat -j since Varnish 6.5.
+type jsonSnapshot struct {
+	Version   int                    `json:"version"`
+	Timestamp string                 `json:"timestamp"`
+	Counters  map[string]jsonCounter `json:"counters"`
+}
+
+// MarshalJSON encodes the snapshot in the layout of varnishstat -j (version
+// 1, as of Varnish 6.5). As there, the time is local and has a one-second
+// resolution. Implements [json.Marshaler].
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	js := jsonSnapshot{
+		Version:   1,
+		Timestamp: s.Time.Local().Format(varnishstatTime),
+		Counters:  make(map[string]jsonCounter, len(s.Values)),
+	}
+	for name, v := range s.Values {
+		js.Counters[name] = jsonCounter{
+			Description: v.Description,
+			Flag:        string(v.Semantics.char()),
+			Format:      string(v.Flags.char()),
+			Value:       v.Value,
+		}
+	}
+	return json.Marshal(js)
+}
+
+// UnmarshalJSON decodes a snapshot written by [Snapshot.MarshalJSON] or by
+// varnishstat -j, in the current layout or the one before Varnish 6.5, where
+// the counters are at the top level. Implements [json.Unmarshaler].
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return err
+	}
+	var ts string
+	if raw, ok := top["timestamp"]; ok {
+		if err := json.Unmarshal(raw, &ts); err != nil {
+			return fmt.Errorf("decode timestamp: %w", err)
+		}
+	}
+	counters := map[string]jsonCounter{}
+	if raw, ok := top["counters"]; ok {
+		if err := json.Unmarshal(raw, &counters); err != nil {
+			return fmt.Errorf("decode counters: %w", err)
+		}
+	} else {
+		for name, raw := range top {
+			if name == "timestamp" || name == "version" {
+				continue
+			}
+			var c jsonCounter
+			if err := json.Unmarshal(raw, &c); err != nil {
+				return fmt.Errorf("decode counter %s: %w", name, err)
+			}
+			counters[name] = c
+		}
+	}
+
+	*s = Snapshot{Values: make(map[string]Value, len(counters))}
+	if ts != "" {
+		t, err := time.ParseInLocation(varnishstatTime, ts, time.Local)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+				return fmt.Errorf("decode timestamp %q: %w", ts, err)
+			}
+		}
+		s.Time = t
+	}
+	for name, c := range counters {
+		v := Value{Value: c.Value, Description: c.Description}
+		if c.Flag != "" {
+			v.Semantics = semanticsFromChar(c.Flag[0])
+		}
+		if c.Format != "" {
+			v.Flags = flagsFromChar(c.Format[0])
+		}
+		s.Values[name] = v
+	}
+	return nil
+}
+
+// MarshalBinary encodes the snapshot in a compact binary form, that unlike
+// JSON keeps the time to the nanosecond. Implements
+// [encoding.BinaryMarshaler].
+func (s Snapshot) MarshalBinary() ([]byte, error) {
+	b := []byte(snapshotMagic)
+	b = binary.AppendVarint(b, s.Time.Unix())
+	b = binary.AppendUvarint(b, uint64(s.Time.Nanosecond()))
+	b = binary.AppendUvarint(b, uint64(len(s.Values)))
+	for _, name := range slices.Sorted(maps.Keys(s.Values)) {
+		v := s.Values[name]
+		b = binary.AppendUvarint(b, uint64(len(name)))
+		b = append(b, name...)
+		b = append(b, v.Semantics.char(), v.Flags.char())
+		b = binary.AppendUvarint(b, v.Value)
+		b = binary.AppendUvarint(b, uint64(len(v.Description)))
+		b = append(b, v.Description...)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary decodes a snapshot written by [Snapshot.MarshalBinary].
+// Implements [encoding.BinaryUnmarshaler].
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	r, ok := bytes.CutPrefix(data, []byte(snapshotMagic))
+	if !ok {
+		return fmt.Errorf("not a binary snapshot")
+	}
+	d := decoder{b: r}
+	sec, nsec := d.varint(), d.uvarint()
+	n := d.uvarint()
+	values := map[string]Value{}
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		name := d.string()
+		v := Value{Semantics: semanticsFromChar(d.byte()), Flags: flagsFromChar(d.byte())}
+		v.Value = d.uvarint()
+		v.Description = d.string()
+		values[name] = v
+	}
+	if d.err != nil {
+		return fmt.Errorf("decode snapshot: %w", d.err)
+	}
+	*s = Snapshot{Time: time.Unix(sec, int64(nsec)), Values: values}
+	return nil
+}
+
+// decoder reads the binary encoding of a snapshot, remembering the first
+// error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = fmt.Errorf("truncated data")
+	}
+	d.b = nil
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if len(d.b) == 0 {
+		d.fail()
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.fail()
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+// LoadSnapshot reads a snapshot from a file, either saved from
+// [Snapshot.MarshalBinary] or in JSON, as written by [Snapshot.MarshalJSON]
+// or varnishstat -j.
+func LoadSnapshot(path string) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var s Snapshot
+	if bytes.HasPrefix(data, []byte(snapshotMagic)) {
+		err = s.UnmarshalBinary(data)
+	} else {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("load %s: %w", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,116 @@
+package stat_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+func testSnapshot() stat.Snapshot {
+	return stat.Snapshot{
+		Time: time.Date(2026, 5, 8, 21, 26, 16, 123456789, time.Local),
+		Values: map[string]stat.Value{
+			"MAIN.uptime":            {Value: 3600, Semantics: stat.SemanticsCounter, Flags: stat.FlagsDuration, Description: "Child process uptime"},
+			"MAIN.n_object":          {Value: 5000, Semantics: stat.SemanticsGauge, Flags: stat.FlagsInteger, Description: "object structs made"},
+			"SMA.s0.g_bytes":         {Value: 1 << 20, Semantics: stat.SemanticsGauge, Flags: stat.FlagsBytes},
+			"VBE.boot.default.happy": {Value: 1<<64 - 1, Semantics: stat.SemanticsBitmap, Flags: stat.FlagsBitmap},
+			"LCK.sma.locks":          {Value: 1, Semantics: stat.SemanticsUnknown, Flags: stat.FlagsUnknown},
+		},
+	}
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	t.Parallel()
+	s := testSnapshot()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the layout of varnishstat -j
+	var raw struct {
+		Version   int
+		Timestamp string
+		Counters  map[string]map[string]any
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Version != 1 || raw.Timestamp != "2026-05-08T21:26:16" {
+		t.Errorf("got version %d, timestamp %q", raw.Version, raw.Timestamp)
+	}
+	want := map[string]any{"description": "Child process uptime", "flag": "c", "format": "d", "value": 3600.0}
+	if got := raw.Counters["MAIN.uptime"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("MAIN.uptime: got %v, want %v", got, want)
+	}
+
+	var got stat.Snapshot
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	s.Time = s.Time.Truncate(time.Second)
+	if !got.Time.Equal(s.Time) || !reflect.DeepEqual(got.Values, s.Values) {
+		t.Errorf("round trip: got %+v, want %+v", got, s)
+	}
+}
+
+func TestSnapshotBinary(t *testing.T) {
+	t.Parallel()
+	s := testSnapshot()
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got stat.Snapshot
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(s.Time) || !reflect.DeepEqual(got.Values, s.Values) {
+		t.Errorf("round trip: got %+v, want %+v", got, s)
+	}
+
+	for i := range len(data) {
+		if err := got.UnmarshalBinary(data[:i]); err == nil {
+			t.Fatalf("expected an error for data truncated to %d bytes", i)
+		}
+	}
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, file := range []string{"varnishstat-6.0.json", "varnishstat-7.json"} {
+		s, err := stat.LoadSnapshot(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Values) != 7 || s.Time.IsZero() {
+			t.Errorf("%s: got %+v", file, s)
+		}
+		want := stat.Value{Value: 1<<64 - 1, Semantics: stat.SemanticsBitmap, Flags: stat.FlagsBitmap, Description: "Happy health probes"}
+		if got := s.Values["VBE.boot.default.happy"]; got != want {
+			t.Errorf("%s: got %+v, want %+v", file, got, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.bin")
+	data, _ := testSnapshot().MarshalBinary()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := stat.LoadSnapshot(path); err != nil || len(s.Values) != 5 {
+		t.Errorf("binary: got %+v, %v", s, err)
+	}
+
+	if err := os.WriteFile(path, []byte("VSC"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stat.LoadSnapshot(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package stat
+
+import "fmt"
+
+// Level is the verbosity level of a counter, as in the curses view of
+// varnishstat: info counters are of general interest, diag and debug ones are
+// for troubleshooting and development.
+type Level int
+
+const (
+	LevelUnknown Level = iota // unrecognised level name
+	LevelInfo                 // "info"
+	LevelDiag                 // "diag"
+	LevelDebug                // "debug"
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelInfo:
+		return "info"
+	case LevelDiag:
+		return "diag"
+	case LevelDebug:
+		return "debug"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so that Level serializes
+// as its name.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// levelFromName decodes the level name of a counter, as found in
+// VSC_level_desc and in the VSC JSON metadata.
+func levelFromName(name string) Level {
+	switch name {
+	case "info":
+		return LevelInfo
+	case "diag":
+		return LevelDiag
+	case "debug":
+		return LevelDebug
+	default:
+		return LevelUnknown
+	}
+}
+
+// fieldFilter is an inclusion or exclusion glob, see SetFieldIncludes.
+type fieldFilter struct {
+	pattern string
+	exclude bool
+}
+
+// checkGlob reports an unterminated character class in a glob, which
+// varnishstat would silently match literally.
+func checkGlob(glob string) error {
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '\\':
+			i++
+		case '[':
+			n, _, ok := matchClass(glob[i:], 0)
+			if !ok {
+				return fmt.Errorf("unterminated character class")
+			}
+			i += n - 1
+		}
+	}
+	return nil
+}
+
+// fnmatch reports whether name matches glob, like fnmatch(3) without flags,
+// as varnishstat does: unlike [path.Match], "*" and "?" also match "/", which
+// appears in the names of some dynamic backends.
+func fnmatch(glob, name string) bool {
+	gi, ni := 0, 0
+	star, starName := -1, 0 // last "*" seen, and the name offset it resumes at
+	for ni < len(name) {
+		if gi < len(glob) && glob[gi] == '*' {
+			star, starName = gi, ni
+			gi++
+			continue
+		}
+		if gi < len(glob) {
+			if n, ok := matchOne(glob[gi:], name[ni]); ok {
+				gi += n
+				ni++
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// let the last "*" eat one more byte
+		starName++
+		gi, ni = star+1, starName
+	}
+	for gi < len(glob) && glob[gi] == '*' {
+		gi++
+	}
+	return gi == len(glob)
+}
+
+// matchOne matches c against the element at the start of glob, which isn't
+// "*", and returns the length of the element.
+func matchOne(glob string, c byte) (n int, ok bool) {
+	switch glob[0] {
+	case '?':
+		return 1, true
+	case '\\':
+		if len(glob) > 1 {
+			return 2, glob[1] == c
+		}
+	case '[':
+		if n, ok, valid := matchClass(glob, c); valid {
+			return n, ok
+		}
+	}
+	return 1, glob[0] == c
+}
+
+// matchClass matches c against the character class at the start of glob,
+// e.g. "[a-z]" or "[!0-9]", and returns the length of the class. valid is
+// false if the class isn't terminated.
+func matchClass(glob string, c byte) (n int, ok, valid bool) {
+	i := 1
+	negate := i < len(glob) && (glob[i] == '!' || glob[i] == '^')
+	if negate {
+		i++
+	}
+	// a leading "]" is part of the class
+	for first := true; i < len(glob) && (first || glob[i] != ']'); first = false {
+		lo := glob[i]
+		if lo == '\\' && i+1 < len(glob) {
+			i++
+			lo = glob[i]
+		}
+		i++
+		hi := lo
+		if i+1 < len(glob) && glob[i] == '-' && glob[i+1] != ']' {
+			i++
+			if glob[i] == '\\' && i+1 < len(glob) {
+				i++
+			}
+			hi = glob[i]
+			i++
+		}
+		ok = ok || lo <= c && c <= hi
+	}
+	if i >= len(glob) {
+		return 0, false, false
+	}
+	return i + 1, ok != negate, true
+}
+
+// keep reports whether a counter passes the field filters and the level of
+// the reader: the first matching glob decides, and a counter matching none is
+// kept unless there are inclusion globs. Counters of an unknown level are
+// never filtered out by level.
+func (r *StatReader) keep(name string, level Level) bool {
+	if r.level != LevelUnknown && level > r.level {
+		return false
+	}
+	include := false
+	for _, f := range r.filters {
+		if fnmatch(f.pattern, name) {
+			return !f.exclude
+		}
+		include = include || !f.exclude
+	}
+	return !include
+}
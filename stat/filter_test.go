@@ -0,0 +1,160 @@
+package stat_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+// fakeWorkdir lays out the shared memory files of an instance whose child
+// has a single Stat segment with the given ident with the given counters, in order, and returns
+// its workdir. Levels are "info", "diag" or "debug".
+func fakeWorkdir(t *testing.T, ident string, levels map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	names := slices.Sorted(maps.Keys(levels))
+
+	var elems []string
+	for i, name := range names {
+		elems = append(elems, fmt.Sprintf(`%q: {"name": %q, "type": "counter", "format": "integer", "level": %q, "oneliner": "", "docs": "", "index": %d}`,
+			name, name, levels[name], 8*i))
+	}
+	doc := []byte(`{"name": "` + strings.SplitN(ident, ".", 2)[0] + `", "elem": {` + strings.Join(elems, ",") + `}}`)
+	seg := func(body []byte) []byte {
+		b := binary.NativeEndian.AppendUint64(nil, 1) // ready
+		b = binary.NativeEndian.AppendUint64(b, 24)   // body offset
+		b = binary.NativeEndian.AppendUint64(b, 1)    // doc id
+		return append(b, body...)
+	}
+	docSeg, statSeg := seg(doc), seg(make([]byte, 8*len(names)))
+
+	files := map[string]string{
+		"_.vsm_mgt/_.index": "# 1 2\n",
+		"_.vsm_child/_.index": fmt.Sprintf("# 3 4\n+ _.C 0 %d StatDoc %s\n+ _.C %d %d Stat %s\n",
+			len(docSeg), ident, len(docSeg), len(statSeg), ident),
+		"_.vsm_child/_.C": string(docSeg) + string(statSeg),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFieldFilters(t *testing.T) {
+	dir := fakeWorkdir(t, "MAIN", map[string]string{
+		"cache_hit":   "info",
+		"cache_miss":  "info",
+		"threads":     "info",
+		"threads_max": "diag",
+		"n_vcl":       "info",
+		"esi_errors":  "debug",
+	})
+
+	cases := []struct {
+		name  string
+		build func(*stat.StatReaderBuilder) *stat.StatReaderBuilder
+		want  []string
+	}{
+		{"none", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder { return b },
+			[]string{"MAIN.cache_hit", "MAIN.cache_miss", "MAIN.esi_errors", "MAIN.n_vcl", "MAIN.threads", "MAIN.threads_max"}},
+		{"include", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetFieldIncludes("MAIN.cache_*")
+		}, []string{"MAIN.cache_hit", "MAIN.cache_miss"}},
+		{"exclude", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetFieldExcludes("MAIN.threads*", "*.n_vcl")
+		}, []string{"MAIN.cache_hit", "MAIN.cache_miss", "MAIN.esi_errors"}},
+		{"first match wins", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetFieldExcludes("MAIN.threads*", "MAIN.n_vcl").SetFieldIncludes("MAIN.*")
+		}, []string{"MAIN.cache_hit", "MAIN.cache_miss", "MAIN.esi_errors"}},
+		{"include then exclude", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetFieldIncludes("MAIN.threads*").SetFieldExcludes("MAIN.threads_max")
+		}, []string{"MAIN.threads", "MAIN.threads_max"}},
+		{"negated class", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetFieldIncludes("MAIN.[!ct]*")
+		}, []string{"MAIN.esi_errors", "MAIN.n_vcl"}},
+		{"info level", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetLevel(stat.LevelInfo)
+		}, []string{"MAIN.cache_hit", "MAIN.cache_miss", "MAIN.n_vcl", "MAIN.threads"}},
+		{"diag level", func(b *stat.StatReaderBuilder) *stat.StatReaderBuilder {
+			return b.SetLevel(stat.LevelDiag).SetFieldIncludes("MAIN.threads*")
+		}, []string{"MAIN.threads", "MAIN.threads_max"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := tc.build(stat.New().SetName(dir).SetPureGo(true)).Attach()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			added, _ := mustUpdate(t, r)
+			slices.Sort(added)
+			if !slices.Equal(added, tc.want) {
+				t.Errorf("added %v, want %v", added, tc.want)
+			}
+			if got := slices.Sorted(maps.Keys(r.Stats)); !slices.Equal(got, tc.want) {
+				t.Errorf("stats %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCounterLevel(t *testing.T) {
+	dir := fakeWorkdir(t, "MAIN", map[string]string{"cache_hit": "info", "threads_max": "diag", "esi_errors": "debug"})
+	r, err := stat.New().SetName(dir).SetTimeout(time.Second).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	mustUpdate(t, r)
+
+	for name, want := range map[string]stat.Level{
+		"MAIN.cache_hit":   stat.LevelInfo,
+		"MAIN.threads_max": stat.LevelDiag,
+		"MAIN.esi_errors":  stat.LevelDebug,
+	} {
+		if got := r.Stats[name].Level; got != want {
+			t.Errorf("%s: level %v, want %v", name, got, want)
+		}
+	}
+	if b, _ := stat.LevelDiag.MarshalText(); string(b) != "diag" {
+		t.Errorf("LevelDiag.MarshalText() = %q", b)
+	}
+}
+
+func TestBadFieldGlob(t *testing.T) {
+	if _, err := stat.New().SetFieldIncludes("MAIN.[").Attach(); err == nil {
+		t.Error("expected an error for a malformed glob")
+	}
+}
+
+func TestFieldFiltersSlash(t *testing.T) {
+	// an Enterprise goto backend
+	const ident = "VBE.boot.goto.0000.(10.0.0.1).(http://host:80).(ttl:10.0)"
+	dir := fakeWorkdir(t, ident, map[string]string{"req": "info", "happy": "info"})
+
+	for _, globs := range [][]string{{"VBE.*"}, {"VBE.*.req"}, {"VBE.boot.goto.*(http:??host:80)*.req"}} {
+		r, err := stat.New().SetName(dir).SetPureGo(true).SetFieldExcludes("*.happy").SetFieldIncludes(globs...).Attach()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustUpdate(t, r)
+		if _, ok := r.Stats[ident+".req"]; !ok || len(r.Stats) != 1 {
+			t.Errorf("%v: got %v, want only %s.req", globs, slices.Collect(maps.Keys(r.Stats)), ident)
+		}
+		r.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package stat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// happyField is the field of the probe history bitmap of backends.
+const happyField = "happy"
+
+// Format renders the current value of the counter according to its flags, as
+// the curses view of varnishstat does:
+//
+//	FlagsInteger   12345
+//	FlagsBytes     1.50M (powers of 1024)
+//	FlagsDuration  2+03:04:05 (days+hours:minutes:seconds)
+//	FlagsBitmap    0000000000VVVVVVVVV_VVVVVVVVVVVVVV (the 40 high bits in
+//	               hexadecimal, then the 24 low ones, highest first, V if set)
+//	FlagsBoolean   true
+func (c Counter) Format() string {
+	return formatValue(*c.Value, c.Flags)
+}
+
+// Format renders the value like [Counter.Format].
+func (v Value) Format() string {
+	return formatValue(v.Value, v.Flags)
+}
+
+func formatValue(v uint64, f Flags) string {
+	switch f {
+	case FlagsBytes:
+		return formatBytes(v)
+	case FlagsDuration:
+		return fmt.Sprintf("%d+%02d:%02d:%02d", v/86400, v%86400/3600, v%3600/60, v%60)
+	case FlagsBitmap:
+		var b strings.Builder
+		fmt.Fprintf(&b, "%010x", v>>24)
+		for bit := 23; bit >= 0; bit-- {
+			if v&(1<<bit) != 0 {
+				b.WriteByte('V')
+			} else {
+				b.WriteByte('_')
+			}
+		}
+		return b.String()
+	case FlagsBoolean:
+		return strconv.FormatBool(v != 0)
+	default:
+		return strconv.FormatUint(v, 10)
+	}
+}
+
+// formatBytes scales a byte count by powers of 1024, with two decimals and
+// the unit prefix, e.g. "1.50M". Counts below 1024 are rendered as is.
+func formatBytes(v uint64) string {
+	const units = "KMGTPE"
+	if v < 1024 {
+		return strconv.FormatUint(v, 10)
+	}
+	f, i := float64(v)/1024, 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return strconv.FormatFloat(f, 'f', 2, 64) + units[i:i+1]
+}
+
+// Duration returns the current value of a counter with [FlagsDuration], a
+// number of seconds, as a [time.Duration]. It returns false for other
+// counters.
+func (c Counter) Duration() (time.Duration, bool) {
+	if c.Flags != FlagsDuration {
+		return 0, false
+	}
+	return time.Duration(*c.Value) * time.Second, true
+}
+
+// Bool returns whether the current value of a boolean counter is set. It
+// returns false as second value for counters that aren't booleans.
+func (c Counter) Bool() (value, ok bool) {
+	if c.Semantics != SemanticsBoolean && c.Flags != FlagsBoolean {
+		return false, false
+	}
+	return *c.Value != 0, true
+}
+
+// Bits returns the n low bits of the current value of a bitmap counter,
+// least significant first; n is capped to 64. It returns nil for counters
+// that aren't bitmaps.
+func (c Counter) Bits(n int) []bool {
+	if c.Semantics != SemanticsBitmap && c.Flags != FlagsBitmap {
+		return nil
+	}
+	n = min(max(n, 0), 64)
+	v := *c.Value
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = v&(1<<i) != 0
+	}
+	return bits
+}
+
+// ProbeHistory returns the outcome of the last probes of the backend, from
+// its "happy" bitmap: the most recent probe first, true if it succeeded.
+// varnishd shifts the bitmap at each probe, so the window is 64 probes long.
+// It returns nil if the backend has no happy counter.
+func (b Backend) ProbeHistory() []bool {
+	c, ok := b.Counters[happyField]
+	if !ok {
+		return nil
+	}
+	return c.Bits(64)
+}
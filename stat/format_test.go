@@ -0,0 +1,87 @@
+package stat_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+func counter(v uint64, s stat.Semantics, f stat.Flags) stat.Counter {
+	return stat.Counter{Value: &v, Semantics: s, Flags: f}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		c    stat.Counter
+		want string
+	}{
+		{counter(12345, stat.SemanticsCounter, stat.FlagsInteger), "12345"},
+		{counter(1023, stat.SemanticsCounter, stat.FlagsBytes), "1023"},
+		{counter(1536, stat.SemanticsCounter, stat.FlagsBytes), "1.50K"},
+		{counter(256<<20, stat.SemanticsGauge, stat.FlagsBytes), "256.00M"},
+		{counter(3<<40, stat.SemanticsGauge, stat.FlagsBytes), "3.00T"},
+		{counter(59, stat.SemanticsGauge, stat.FlagsDuration), "0+00:00:59"},
+		{counter(2*86400+3*3600+4*60+5, stat.SemanticsCounter, stat.FlagsDuration), "2+03:04:05"},
+		{counter(0x1_0000_0005, stat.SemanticsBitmap, stat.FlagsBitmap), "0000000100_____________________V_V"},
+		{counter(1, stat.SemanticsBoolean, stat.FlagsBoolean), "true"},
+		{counter(7, stat.SemanticsUnknown, stat.FlagsUnknown), "7"},
+	}
+	for _, tc := range cases {
+		if got := tc.c.Format(); got != tc.want {
+			t.Errorf("Format(%d, %v) = %q, want %q", *tc.c.Value, tc.c.Flags, got, tc.want)
+		}
+	}
+
+	v := stat.Value{Value: 1536, Flags: stat.FlagsBytes}
+	if got := v.Format(); got != "1.50K" {
+		t.Errorf("Value.Format() = %q, want 1.50K", got)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	d, ok := counter(90, stat.SemanticsCounter, stat.FlagsDuration).Duration()
+	if !ok || d != 90*time.Second {
+		t.Errorf("Duration() = %s, %v", d, ok)
+	}
+	if _, ok := counter(90, stat.SemanticsCounter, stat.FlagsInteger).Duration(); ok {
+		t.Error("Duration() succeeded for an integer counter")
+	}
+}
+
+func TestBool(t *testing.T) {
+	if v, ok := counter(1, stat.SemanticsBoolean, stat.FlagsBoolean).Bool(); !v || !ok {
+		t.Errorf("Bool() = %v, %v", v, ok)
+	}
+	if _, ok := counter(1, stat.SemanticsGauge, stat.FlagsInteger).Bool(); ok {
+		t.Error("Bool() succeeded for a gauge")
+	}
+}
+
+func TestBits(t *testing.T) {
+	c := counter(0b1101, stat.SemanticsBitmap, stat.FlagsBitmap)
+	if got, want := c.Bits(5), []bool{true, false, true, true, false}; !slices.Equal(got, want) {
+		t.Errorf("Bits(5) = %v, want %v", got, want)
+	}
+	if got := c.Bits(100); len(got) != 64 {
+		t.Errorf("Bits(100) has %d bits, want 64", len(got))
+	}
+	if got := counter(3, stat.SemanticsCounter, stat.FlagsInteger).Bits(8); got != nil {
+		t.Errorf("Bits() = %v for an integer counter", got)
+	}
+}
+
+func TestProbeHistory(t *testing.T) {
+	// last probe failed, the three before succeeded
+	b := stat.Backend{VCL: "boot", Name: "default", Counters: map[string]stat.Counter{
+		"happy": counter(0b1110, stat.SemanticsBitmap, stat.FlagsBitmap),
+	}}
+	h := b.ProbeHistory()
+	if len(h) != 64 || !slices.Equal(h[:5], []bool{false, true, true, true, false}) {
+		t.Errorf("ProbeHistory() = %v", h)
+	}
+	if h := (stat.Backend{Counters: map[string]stat.Counter{}}).ProbeHistory(); h != nil {
+		t.Errorf("ProbeHistory() = %v without a happy counter", h)
+	}
+}
@@ -0,0 +1,108 @@
+package stat
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// CounterName is the structured form of a counter name, as returned by
+// [ParseName]. Counter names are made of a type (the section), an optional
+// identifier, and a field, separated by dots:
+//
+//	MAIN.cache_hit          type MAIN, field cache_hit
+//	SMA.s0.g_bytes          type SMA, ident s0 (the storage), field g_bytes
+//	LCK.sma.creat           type LCK, ident sma (the lock class), field creat
+//	MEMPOOL.req0.live       type MEMPOOL, ident req0 (the pool), field live
+//	MSE.store1.g_space      type MSE, ident store1, field g_space
+//	VBE.boot.default.happy  type VBE, ident boot.default, field happy
+//
+// Backend (VBE) identifiers are prefixed with the name of the VCL defining the
+// backend; VCL names can't contain dots, but backend names, e.g. those of
+// dynamic backends, can.
+type CounterName struct {
+	Type  string `json:"type"            yaml:"type"`
+	Ident string `json:"ident,omitempty" yaml:"ident,omitempty"`
+	Field string `json:"field"           yaml:"field"`
+	// VCL and Backend split the Ident of a VBE counter. VCL is empty for
+	// backends not prefixed with their VCL, as in Varnish 4.0.
+	VCL     string `json:"vcl,omitempty"     yaml:"vcl,omitempty"`
+	Backend string `json:"backend,omitempty" yaml:"backend,omitempty"`
+}
+
+// ParseName splits a counter name into its parts. A name without a dot is
+// taken as a bare field.
+func ParseName(name string) CounterName {
+	typ, rest, ok := strings.Cut(name, ".")
+	if !ok {
+		return CounterName{Field: name}
+	}
+	n := CounterName{Type: typ, Field: rest}
+	if i := strings.LastIndexByte(rest, '.'); i >= 0 {
+		n.Ident, n.Field = rest[:i], rest[i+1:]
+	}
+	if n.Type == "VBE" && n.Ident != "" {
+		n.Backend = n.Ident
+		// Varnish 4.0 names backends "name(addr,,port)", with no VCL
+		if vcl, backend, ok := strings.Cut(n.Ident, "."); ok && !strings.Contains(vcl, "(") {
+			n.VCL, n.Backend = vcl, backend
+		}
+	}
+	return n
+}
+
+// String joins the parts back into a counter name. Implements [fmt.Stringer].
+func (n CounterName) String() string {
+	parts := make([]string, 0, 3)
+	for _, p := range []string{n.Type, n.Ident, n.Field} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// ByType returns the counters of the given type, e.g. "VBE" or "SMA", by
+// name.
+func (r *StatReader) ByType(typ string) map[string]Counter {
+	m := map[string]Counter{}
+	for name, c := range r.Stats {
+		if t, _, ok := strings.Cut(name, "."); ok && t == typ {
+			m[name] = c
+		}
+	}
+	return m
+}
+
+// Backend groups the counters of a backend.
+type Backend struct {
+	VCL  string `json:"vcl"  yaml:"vcl"`
+	Name string `json:"name" yaml:"name"`
+	// Counters are keyed by field, e.g. "req" or "happy".
+	Counters map[string]Counter `json:"counters" yaml:"counters"`
+}
+
+// Backends returns the backends with counters, sorted by VCL and name. The
+// same backend appears once per VCL defining it.
+func (r *StatReader) Backends() []Backend {
+	var backends []Backend
+	index := map[CounterName]int{}
+	for name, c := range r.ByType("VBE") {
+		n := ParseName(name)
+		if n.Backend == "" {
+			continue
+		}
+		key := CounterName{VCL: n.VCL, Backend: n.Backend}
+		i, ok := index[key]
+		if !ok {
+			i = len(backends)
+			index[key] = i
+			backends = append(backends, Backend{VCL: n.VCL, Name: n.Backend, Counters: map[string]Counter{}})
+		}
+		backends[i].Counters[n.Field] = c
+	}
+	slices.SortFunc(backends, func(a, b Backend) int {
+		return cmp.Or(strings.Compare(a.VCL, b.VCL), strings.Compare(a.Name, b.Name))
+	})
+	return backends
+}
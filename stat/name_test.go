@@ -0,0 +1,97 @@
+package stat_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+	"github.com/varnish/varnish-go/vtest"
+)
+
+func TestParseName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		want stat.CounterName
+	}{
+		{"MAIN.cache_hit", stat.CounterName{Type: "MAIN", Field: "cache_hit"}},
+		{"MGT.child_start", stat.CounterName{Type: "MGT", Field: "child_start"}},
+		{"SMA.s0.g_bytes", stat.CounterName{Type: "SMA", Ident: "s0", Field: "g_bytes"}},
+		{"SMF.disk.g_space", stat.CounterName{Type: "SMF", Ident: "disk", Field: "g_space"}},
+		{"LCK.sma.creat", stat.CounterName{Type: "LCK", Ident: "sma", Field: "creat"}},
+		{"MEMPOOL.req0.live", stat.CounterName{Type: "MEMPOOL", Ident: "req0", Field: "live"}},
+		{"MSE.store1.g_space", stat.CounterName{Type: "MSE", Ident: "store1", Field: "g_space"}},
+		{"MSE_BOOK.book1.n_vary", stat.CounterName{Type: "MSE_BOOK", Ident: "book1", Field: "n_vary"}},
+		{"VBE.boot.default.happy", stat.CounterName{Type: "VBE", Ident: "boot.default", Field: "happy", VCL: "boot", Backend: "default"}},
+		{"VBE.vcl-2.goto.00000001.(10.0.0.1:80).req", stat.CounterName{
+			Type: "VBE", Ident: "vcl-2.goto.00000001.(10.0.0.1:80)", Field: "req", VCL: "vcl-2", Backend: "goto.00000001.(10.0.0.1:80)",
+		}},
+		{"VBE.default(127.0.0.1,,8080).req", stat.CounterName{
+			Type: "VBE", Ident: "default(127.0.0.1,,8080)", Field: "req", Backend: "default(127.0.0.1,,8080)",
+		}},
+		{"uptime", stat.CounterName{Field: "uptime"}},
+	}
+	for _, tt := range tests {
+		got := stat.ParseName(tt.name)
+		if got != tt.want {
+			t.Errorf("ParseName(%q): got %+v, want %+v", tt.name, got, tt.want)
+		}
+		if s := got.String(); s != tt.name {
+			t.Errorf("ParseName(%q).String(): got %q", tt.name, s)
+		}
+	}
+}
+
+func TestBackends(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer origin.Close()
+	v, err := vtest.New().Backend("origin", origin.URL).VclString(`
+		sub vcl_recv {
+			return(pass);
+		}
+	`).Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Stop()
+
+	r, err := stat.New().SetName(v.Name()).SetTimeout(5 * time.Second).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := http.Get(v.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	mustUpdate(t, r)
+
+	vbe := r.ByType("VBE")
+	if len(vbe) == 0 {
+		t.Fatal("expected VBE counters")
+	}
+	for name := range vbe {
+		if stat.ParseName(name).Type != "VBE" {
+			t.Errorf("ByType(VBE): got %q", name)
+		}
+	}
+
+	var found bool
+	for _, b := range r.Backends() {
+		if b.Name != "origin" {
+			continue
+		}
+		found = true
+		if b.VCL == "" {
+			t.Error("expected the backend's VCL to be set")
+		}
+		if c, ok := b.Counters["req"]; !ok || *c.Value != 1 {
+			t.Errorf("expected one request to origin, got %+v", b.Counters["req"])
+		}
+	}
+	if !found {
+		t.Errorf("expected backend origin, got %+v", r.Backends())
+	}
+}
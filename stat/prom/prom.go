@@ -0,0 +1,269 @@
+// Expose Varnish statistics counters in the Prometheus/OpenMetrics text format
+package prom
+
+// [New] returns an [ExporterBuilder] for a [stat.StatReader]; the [Exporter]
+// it builds renders every counter on each scrape, and is an [http.Handler].
+// [WriteCounters] renders a set of counters directly, e.g. to push them
+// elsewhere.
+//
+// Counter names are mapped to metric families as follows:
+//
+//   - the section and field become the family name, prefixed with the
+//     namespace ("varnish" by default): MAIN.cache_hit becomes
+//     varnish_main_cache_hit;
+//   - for backends, the VCL and backend names become labels:
+//     VBE.boot.default.req becomes varnish_vbe_req{vcl="boot",backend="default"};
+//   - for other sections with more than two parts (SMA, MSE, LCK,
+//     MEMPOOL...), the middle becomes the id label: SMA.s0.c_bytes becomes
+//     varnish_sma_c_bytes{id="s0"}.
+//
+// Counters ([stat.SemanticsCounter]) are exposed as OpenMetrics counters,
+// with a _total suffix; gauges, bitmaps and booleans as gauges. Byte and
+// duration counters ([stat.FlagsBytes], [stat.FlagsDuration]) get the bytes
+// and seconds units, appended to the family name. The short description of
+// each counter is its help text.
+//
+// # Usage
+//
+//	r, err := stat.New().SetName("/tmp/my-varnish").Attach()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer r.Close()
+//
+//	e, err := prom.New(r).Build()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	http.Handle("/metrics", e)
+//	log.Fatal(http.ListenAndServe(":9131", nil))
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+// ContentType is the media type of the OpenMetrics text format.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// DefaultNamespace prefixes every metric name, unless changed with
+// [ExporterBuilder.SetNamespace].
+const DefaultNamespace = "varnish"
+
+var validNamespace = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ExporterBuilder configures an [Exporter].
+// Obtain one with [New], configure with the Set* methods, then call [ExporterBuilder.Build].
+type ExporterBuilder struct {
+	r         *stat.StatReader
+	namespace string
+}
+
+// New returns an ExporterBuilder for the counters of r, with the
+// [DefaultNamespace].
+func New(r *stat.StatReader) *ExporterBuilder {
+	return &ExporterBuilder{r: r, namespace: DefaultNamespace}
+}
+
+// SetNamespace sets the prefix of every metric name. An empty namespace
+// disables the prefix.
+func (b *ExporterBuilder) SetNamespace(namespace string) *ExporterBuilder {
+	b.namespace = namespace
+	return b
+}
+
+// Build validates the configuration and returns an [Exporter].
+func (b *ExporterBuilder) Build() (*Exporter, error) {
+	if b.r == nil {
+		return nil, fmt.Errorf("no stat reader given")
+	}
+	if b.namespace != "" && !validNamespace.MatchString(b.namespace) {
+		return nil, fmt.Errorf("invalid namespace %q", b.namespace)
+	}
+	return &Exporter{r: b.r, namespace: b.namespace}, nil
+}
+
+// Exporter renders the counters of a [stat.StatReader] as OpenMetrics text.
+// It calls [stat.StatReader.Update] before every rendering, and serializes
+// them: the reader must not be used elsewhere meanwhile.
+type Exporter struct {
+	mu        sync.Mutex
+	r         *stat.StatReader
+	namespace string
+}
+
+// Write updates the counters and writes them to w.
+func (e *Exporter) Write(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, _, err := e.r.Update(); err != nil {
+		return err
+	}
+	return WriteCounters(w, e.namespace, e.r.Stats)
+}
+
+// ServeHTTP serves the counters to a scraper. Implements [http.Handler].
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	var buf bytes.Buffer
+	if err := e.Write(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(buf.Bytes())
+}
+
+type label struct {
+	name, value string
+}
+
+type sample struct {
+	labels []label
+	value  uint64
+}
+
+// family is a metric family: the counters sharing a name, told apart by
+// their labels.
+type family struct {
+	name, typ, unit, help string
+	samples               []sample
+}
+
+// WriteCounters writes counters, keyed by their names (as in
+// [stat.StatReader.Stats]), as OpenMetrics text, prefixing the metric names
+// with namespace (and an underscore) unless it's empty. Counters that map to
+// an existing family with a different type are skipped.
+func WriteCounters(w io.Writer, namespace string, counters map[string]stat.Counter) error {
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	families := map[string]*family{}
+	for _, name := range names {
+		c := counters[name]
+		if c.Value == nil {
+			continue
+		}
+		f, labels := newFamily(namespace, name, c)
+		if prev, ok := families[f.name]; ok {
+			if prev.typ != f.typ || prev.unit != f.unit {
+				continue
+			}
+			f = prev
+		} else {
+			families[f.name] = f
+		}
+		f.samples = append(f.samples, sample{labels: labels, value: *c.Value})
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range slices.Sorted(maps.Keys(families)) {
+		families[name].write(bw)
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+// newFamily maps a counter to its family, and returns the labels telling it
+// apart from the other counters of the family.
+func newFamily(namespace, name string, c stat.Counter) (*family, []label) {
+	n := stat.ParseName(name)
+	var labels []label
+	switch {
+	case n.Type == "VBE" && n.Backend != "":
+		if n.VCL != "" {
+			labels = append(labels, label{"vcl", n.VCL})
+		}
+		labels = append(labels, label{"backend", n.Backend})
+	case n.Ident != "":
+		labels = []label{{"id", n.Ident}}
+	}
+
+	f := &family{typ: "unknown", help: c.SDesc}
+	if f.help == "" {
+		f.help, _, _ = strings.Cut(c.LDesc, "\n")
+	}
+	switch c.Semantics {
+	case stat.SemanticsCounter:
+		f.typ = "counter"
+	case stat.SemanticsGauge, stat.SemanticsBitmap, stat.SemanticsBoolean:
+		f.typ = "gauge"
+	}
+	switch c.Flags {
+	case stat.FlagsBytes:
+		f.unit = "bytes"
+	case stat.FlagsDuration:
+		f.unit = "seconds"
+	}
+
+	var elems []string
+	for _, e := range []string{namespace, strings.ToLower(n.Type), n.Field} {
+		if e != "" {
+			elems = append(elems, sanitize(e))
+		}
+	}
+	f.name = strings.Join(elems, "_")
+	if f.typ == "counter" {
+		f.name = strings.TrimSuffix(f.name, "_total")
+	}
+	if f.unit != "" && !strings.HasSuffix(f.name, "_"+f.unit) {
+		f.name += "_" + f.unit
+	}
+	return f, labels
+}
+
+// sanitize replaces the characters not allowed in metric names.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// escaper escapes help texts and label values.
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func (f *family) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	if f.unit != "" {
+		fmt.Fprintf(w, "# UNIT %s %s\n", f.name, f.unit)
+	}
+	if f.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escaper.Replace(f.help))
+	}
+	suffix := ""
+	if f.typ == "counter" {
+		suffix = "_total"
+	}
+	for _, s := range f.samples {
+		w.WriteString(f.name + suffix)
+		if len(s.labels) > 0 {
+			w.WriteByte('{')
+			for i, l := range s.labels {
+				if i > 0 {
+					w.WriteByte(',')
+				}
+				fmt.Fprintf(w, `%s="%s"`, l.name, escaper.Replace(l.value))
+			}
+			w.WriteByte('}')
+		}
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatUint(s.value, 10))
+		w.WriteByte('\n')
+	}
+}
@@ -0,0 +1,139 @@
+package prom_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+	"github.com/varnish/varnish-go/stat/prom"
+	"github.com/varnish/varnish-go/vtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func counter(v uint64, sem stat.Semantics, flags stat.Flags, desc string) stat.Counter {
+	return stat.Counter{SDesc: desc, Value: &v, Semantics: sem, Flags: flags}
+}
+
+func testCounters() map[string]stat.Counter {
+	return map[string]stat.Counter{
+		"MAIN.uptime":                     counter(3600, stat.SemanticsCounter, stat.FlagsDuration, "Child process uptime"),
+		"MAIN.cache_hit":                  counter(42, stat.SemanticsCounter, stat.FlagsInteger, "Cache hits"),
+		"MAIN.n_object":                   counter(7, stat.SemanticsGauge, stat.FlagsInteger, "object structs made"),
+		"MAIN.s_resp_bodybytes":           counter(123456, stat.SemanticsCounter, stat.FlagsBytes, "Response body bytes"),
+		"MGT.child_start":                 counter(1, stat.SemanticsCounter, stat.FlagsInteger, "Child process started"),
+		"VBE.boot.default.req":            counter(10, stat.SemanticsCounter, stat.FlagsInteger, "Backend requests sent"),
+		"VBE.boot.api.v2.req":             counter(3, stat.SemanticsCounter, stat.FlagsInteger, "Backend requests sent"),
+		"VBE.boot.default.happy":          counter(0xff, stat.SemanticsBitmap, stat.FlagsBitmap, "Happy health probes"),
+		"VBE.boot.default.bereq_hdrbytes": counter(2048, stat.SemanticsCounter, stat.FlagsBytes, "Request header bytes"),
+		"SMA.s0.g_bytes":                  counter(1024, stat.SemanticsGauge, stat.FlagsBytes, "Bytes outstanding"),
+		"SMA.Transient.g_bytes":           counter(0, stat.SemanticsGauge, stat.FlagsBytes, "Bytes outstanding"),
+		"LCK.sma.creat":                   counter(2, stat.SemanticsCounter, stat.FlagsInteger, `Created "locks"`),
+		"MEMPOOL.req0.live":               {LDesc: "In use\nmore details", Value: new(uint64), Semantics: stat.SemanticsGauge, Flags: stat.FlagsInteger},
+		"MSE.store.g_space":               counter(5, stat.SemanticsUnknown, stat.FlagsUnknown, ""),
+		"MAIN.missing":                    {Semantics: stat.SemanticsCounter},
+	}
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: output mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestWriteCounters(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	if err := prom.WriteCounters(&buf, prom.DefaultNamespace, testCounters()); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "metrics", buf.String())
+}
+
+func TestWriteCountersNoNamespace(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	counters := map[string]stat.Counter{"MAIN.cache_hit": counter(42, stat.SemanticsCounter, stat.FlagsInteger, "")}
+	if err := prom.WriteCounters(&buf, "", counters); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "# TYPE main_cache_hit counter\nmain_cache_hit_total 42\n# EOF\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	t.Parallel()
+	if _, err := prom.New(nil).Build(); err == nil {
+		t.Error("expected Build to fail without a reader")
+	}
+	if _, err := prom.New(&stat.StatReader{}).SetNamespace("my-varnish").Build(); err == nil {
+		t.Error("expected Build to fail with an invalid namespace")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	v, err := vtest.New().VclString(`
+		backend default none;
+		sub vcl_recv {
+			return(synth(200, "OK"));
+		}
+	`).Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Stop()
+
+	r, err := stat.New().SetName(v.Name()).SetTimeout(5 * time.Second).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	e, err := prom.New(r).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	if _, err := http.Get(v.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != prom.ContentType {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	for _, want := range []string{"# TYPE varnish_main_client_req counter\n", "varnish_main_client_req_total 1\n", "# EOF\n"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q in the response, got:\n%s", want, body)
+		}
+	}
+}
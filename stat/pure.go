@@ -0,0 +1,62 @@
+package stat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/varnish/varnish-go/stat/vsm"
+)
+
+// defaultTimeout is the libvarnishapi default for -t.
+const defaultTimeout = 5 * time.Second
+
+// attachPure opens the shared memory of the instance configured by b with the
+// vsm package, retrying every half second until the timeout, as
+// libvarnishapi does.
+func attachPure(b *StatReaderBuilder) (*vsm.VSM, error) {
+	if b.name == "" {
+		return nil, fmt.Errorf("SetPureGo requires SetName")
+	}
+	timeout := defaultTimeout
+	if b.timeout != nil && *b.timeout > 0 {
+		timeout = *b.timeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		v, err := vsm.Open(vsm.Workdir(b.name))
+		if err == nil || time.Now().After(deadline) {
+			return v, err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// updatePure refreshes r.Stats from the points of the vsm package, keeping
+// those passing the filters. As with [vsm.VSM.Update], the counters added and
+// removed are returned even with an error, as r.Stats reflects them.
+func (r *StatReader) updatePure() (added, removed []string, err error) {
+	points, gone, err := r.pure.Update()
+	for _, name := range gone {
+		if _, ok := r.Stats[name]; ok {
+			delete(r.Stats, name)
+			removed = append(removed, name)
+		}
+	}
+	for _, name := range points {
+		pt := r.pure.Points[name]
+		level := levelFromName(pt.Level)
+		if !r.keep(name, level) {
+			continue
+		}
+		r.Stats[name] = Counter{
+			SDesc:     pt.SDesc,
+			LDesc:     pt.LDesc,
+			Value:     pt.Value,
+			Semantics: semanticsFromChar(pt.Semantics),
+			Flags:     flagsFromChar(pt.Format),
+			Level:     level,
+		}
+		added = append(added, name)
+	}
+	return added, removed, err
+}
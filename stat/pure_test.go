@@ -0,0 +1,118 @@
+package stat_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+	"github.com/varnish/varnish-go/vtest"
+)
+
+// stableUpdate updates r until the set of counters stops changing.
+func stableUpdate(t *testing.T, r *stat.StatReader) {
+	t.Helper()
+	for range 20 {
+		if added, _ := mustUpdate(t, r); len(added) == 0 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func attach(t *testing.T, v *vtest.Varnish, pureGo bool) *stat.StatReader {
+	t.Helper()
+	r, err := stat.New().SetName(v.Name()).SetTimeout(5 * time.Second).SetPureGo(pureGo).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	stableUpdate(t, r)
+	return r
+}
+
+func TestPureGoParity(t *testing.T) {
+	v := startVarnish(t)
+	defer v.Stop()
+
+	if _, err := http.Get(v.URL + "/test"); err != nil {
+		t.Fatal(err)
+	}
+	capi := attach(t, &v, false)
+	pure := attach(t, &v, true)
+
+	names := slices.Sorted(maps.Keys(capi.Stats))
+	if got := slices.Sorted(maps.Keys(pure.Stats)); !slices.Equal(got, names) {
+		t.Fatalf("counters differ:\ncgo:  %v\npure: %v", names, got)
+	}
+	for _, name := range names {
+		c, p := capi.Stats[name], pure.Stats[name]
+		if c.Semantics != p.Semantics || c.Flags != p.Flags || c.Level != p.Level || c.SDesc != p.SDesc || c.LDesc != p.LDesc {
+			t.Errorf("%s: cgo %+v, pure %+v", name, c, p)
+		}
+	}
+	for _, name := range []string{"MAIN.client_req", "MAIN.n_backends", "MGT.child_start"} {
+		c, _ := capi.Counter(name)
+		p, err := pure.Counter(name)
+		if err != nil || c != p {
+			t.Errorf("%s: cgo %d, pure %d (%v)", name, c, p, err)
+		}
+	}
+}
+
+func TestPureGoRequiresName(t *testing.T) {
+	if _, err := stat.New().SetPureGo(true).Attach(); err == nil {
+		t.Error("expected an error without SetName")
+	}
+}
+
+func TestPureGoTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := stat.New().SetName(t.TempDir()).SetTimeout(time.Second).SetPureGo(true).Attach()
+	if err == nil {
+		t.Fatal("expected an error without a running instance")
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("gave up after %s, want at least the timeout", d)
+	}
+}
+
+func TestPureGoPartialUpdate(t *testing.T) {
+	dir := fakeWorkdir(t, "MAIN", map[string]string{"cache_hit": "info"})
+	// a Stat segment described by the MAIN documentation, but without room
+	// for its counter
+	broken := binary.NativeEndian.AppendUint64(nil, 1)
+	broken = binary.NativeEndian.AppendUint64(broken, 24)
+	broken = binary.NativeEndian.AppendUint64(broken, 1)
+	if err := os.WriteFile(filepath.Join(dir, "_.vsm_child", "_.D"), broken, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.OpenFile(filepath.Join(dir, "_.vsm_child", "_.index"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(index, "+ _.D 0 %d Stat BROKEN\n", len(broken))
+	index.Close()
+
+	r, err := stat.New().SetName(dir).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	added, _, err := r.Update()
+	if err == nil {
+		t.Error("expected an error for the broken segment")
+	}
+	if !slices.Equal(added, []string{"MAIN.cache_hit"}) {
+		t.Errorf("added %v along with the error, want [MAIN.cache_hit]", added)
+	}
+	if _, ok := r.Stats["MAIN.cache_hit"]; !ok {
+		t.Error("MAIN.cache_hit missing from Stats")
+	}
+}
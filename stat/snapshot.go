@@ -0,0 +1,117 @@
+package stat
+
+import (
+	"strings"
+	"time"
+)
+
+// uptimeCounter is the counter used to compute averages and to detect child
+// restarts, as varnishstat does.
+const uptimeCounter = "MAIN.uptime"
+
+// Value is the value of a counter at the time of a [Snapshot].
+type Value struct {
+	Value       uint64    `json:"value"                 yaml:"value"`
+	Semantics   Semantics `json:"semantics"             yaml:"semantics"`
+	Flags       Flags     `json:"flags"                 yaml:"flags"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"` // short description
+}
+
+// Snapshot is a copy of the counters of a [StatReader] at a given time. Unlike
+// [StatReader.Stats], it stays valid and unchanged across Updates, and can be
+// saved: it encodes to JSON in the layout of varnishstat -j, and to a compact
+// binary form (see [Snapshot.MarshalJSON] and [Snapshot.MarshalBinary]).
+type Snapshot struct {
+	Time   time.Time        `yaml:"time"`
+	Values map[string]Value `yaml:"values"`
+}
+
+// Snapshot copies the current value of every counter. The set of counters is
+// the one of the last [StatReader.Update], which should be called first.
+func (r *StatReader) Snapshot() Snapshot {
+	s := Snapshot{Time: time.Now(), Values: make(map[string]Value, len(r.Stats))}
+	for name, c := range r.Stats {
+		s.Values[name] = Value{Value: *c.Value, Semantics: c.Semantics, Flags: c.Flags, Description: c.SDesc}
+	}
+	return s
+}
+
+// Average returns the value of the named counter divided by the uptime of the
+// child, like the average column of varnishstat -1. It returns false if the
+// counter or MAIN.uptime are missing, or if the uptime is zero.
+func (s Snapshot) Average(name string) (float64, bool) {
+	v, ok := s.Values[name]
+	up := s.Values[uptimeCounter]
+	if !ok || up.Value == 0 {
+		return 0, false
+	}
+	return float64(v.Value) / float64(up.Value), true
+}
+
+// Delta is the change of a counter between two snapshots, see [Diff].
+type Delta struct {
+	Semantics Semantics `json:"semantics" yaml:"semantics"`
+	Flags     Flags     `json:"flags"     yaml:"flags"`
+	Value     uint64    `json:"value"     yaml:"value"` // value in the later snapshot
+	// Delta is the increase of a counter (since it was reset, if Reset is
+	// set), or the signed change of a gauge. It's zero for bitmaps and
+	// booleans, which only report whether they Changed.
+	Delta int64 `json:"delta" yaml:"delta"`
+	// Rate is Delta per second, for counters only.
+	Rate    float64 `json:"rate"    yaml:"rate"`
+	Changed bool    `json:"changed" yaml:"changed"`
+	// Reset is set when a counter went back to zero in between, because the
+	// child restarted.
+	Reset bool `json:"reset" yaml:"reset"`
+}
+
+// Deltas are the changes between two snapshots, as returned by [Diff].
+type Deltas struct {
+	Interval time.Duration `json:"interval" yaml:"interval"`
+	// Restarted is set when the child restarted between the snapshots, which
+	// resets the counters of every section but MGT.
+	Restarted bool             `json:"restarted" yaml:"restarted"`
+	Counters  map[string]Delta `json:"counters"  yaml:"counters"`
+}
+
+// Diff computes the change of every counter present in both prev and cur,
+// and the rate of the counters over the interval between them, like the
+// curses view of varnishstat.
+//
+// A child restart is detected from MAIN.uptime going back, or per counter
+// from its value going back. The counters it reset are then assumed to have
+// restarted from zero: their delta is their current value.
+func Diff(prev, cur Snapshot) Deltas {
+	d := Deltas{
+		Interval: cur.Time.Sub(prev.Time),
+		Counters: make(map[string]Delta, len(cur.Values)),
+	}
+	if p, ok := prev.Values[uptimeCounter]; ok {
+		if c, ok := cur.Values[uptimeCounter]; ok && c.Value < p.Value {
+			d.Restarted = true
+		}
+	}
+	for name, c := range cur.Values {
+		p, ok := prev.Values[name]
+		if !ok {
+			continue
+		}
+		delta := Delta{Semantics: c.Semantics, Flags: c.Flags, Value: c.Value, Changed: c.Value != p.Value}
+		switch c.Semantics {
+		case SemanticsCounter:
+			delta.Reset = c.Value < p.Value || d.Restarted && !strings.HasPrefix(name, "MGT.")
+			if delta.Reset {
+				delta.Delta = int64(c.Value)
+			} else {
+				delta.Delta = int64(c.Value - p.Value)
+			}
+			if d.Interval > 0 {
+				delta.Rate = float64(delta.Delta) / d.Interval.Seconds()
+			}
+		case SemanticsGauge:
+			delta.Delta = int64(c.Value) - int64(p.Value)
+		}
+		d.Counters[name] = delta
+	}
+	return d
+}
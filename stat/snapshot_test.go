@@ -0,0 +1,149 @@
+package stat_test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+func snapshot(at time.Time, values map[string]uint64) stat.Snapshot {
+	s := stat.Snapshot{Time: at, Values: map[string]stat.Value{}}
+	for name, v := range values {
+		sem := stat.SemanticsCounter
+		switch name {
+		case "MAIN.n_object", "MAIN.sess_queue_length":
+			sem = stat.SemanticsGauge
+		case "VBE.boot.default.happy":
+			sem = stat.SemanticsBitmap
+		}
+		s.Values[name] = stat.Value{Value: v, Semantics: sem, Flags: stat.FlagsInteger}
+	}
+	return s
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	t0 := time.Unix(1700000000, 0)
+	prev := snapshot(t0, map[string]uint64{
+		"MAIN.uptime":            100,
+		"MAIN.client_req":        1000,
+		"MAIN.n_object":          50,
+		"VBE.boot.default.happy": 0b1011,
+		"MAIN.gone":              3,
+	})
+	cur := snapshot(t0.Add(2*time.Second), map[string]uint64{
+		"MAIN.uptime":            102,
+		"MAIN.client_req":        1100,
+		"MAIN.n_object":          40,
+		"VBE.boot.default.happy": 0b0111,
+		"MAIN.new":               7,
+	})
+
+	d := stat.Diff(prev, cur)
+	if d.Interval != 2*time.Second || d.Restarted {
+		t.Errorf("got interval %s, restarted %v", d.Interval, d.Restarted)
+	}
+	want := map[string]stat.Delta{
+		"MAIN.uptime":            {Semantics: stat.SemanticsCounter, Flags: stat.FlagsInteger, Value: 102, Delta: 2, Rate: 1, Changed: true},
+		"MAIN.client_req":        {Semantics: stat.SemanticsCounter, Flags: stat.FlagsInteger, Value: 1100, Delta: 100, Rate: 50, Changed: true},
+		"MAIN.n_object":          {Semantics: stat.SemanticsGauge, Flags: stat.FlagsInteger, Value: 40, Delta: -10, Changed: true},
+		"VBE.boot.default.happy": {Semantics: stat.SemanticsBitmap, Flags: stat.FlagsInteger, Value: 0b0111, Changed: true},
+	}
+	if !reflect.DeepEqual(d.Counters, want) {
+		t.Errorf("got %+v, want %+v", d.Counters, want)
+	}
+
+	if avg, ok := cur.Average("MAIN.client_req"); !ok || avg != 1100.0/102 {
+		t.Errorf("Average: got %v, %v", avg, ok)
+	}
+	if _, ok := cur.Average("MAIN.gone"); ok {
+		t.Error("expected no average for a missing counter")
+	}
+}
+
+func TestDiffRestart(t *testing.T) {
+	t.Parallel()
+	t0 := time.Unix(1700000000, 0)
+	prev := snapshot(t0, map[string]uint64{
+		"MAIN.uptime":            1000,
+		"MAIN.client_req":        5,
+		"MAIN.cache_hit":         90,
+		"MGT.child_start":        1,
+		"MGT.uptime":             1000,
+		"MAIN.n_object":          50,
+		"MAIN.sess_queue_length": 0,
+	})
+	cur := snapshot(t0.Add(10*time.Second), map[string]uint64{
+		"MAIN.uptime":            5,
+		"MAIN.client_req":        20,
+		"MAIN.cache_hit":         10,
+		"MGT.child_start":        2,
+		"MGT.uptime":             1010,
+		"MAIN.n_object":          0,
+		"MAIN.sess_queue_length": 0,
+	})
+
+	d := stat.Diff(prev, cur)
+	if !d.Restarted {
+		t.Error("expected the restart to be detected")
+	}
+	for name, want := range map[string]struct {
+		delta int64
+		reset bool
+	}{
+		"MAIN.uptime":            {5, true},
+		"MAIN.client_req":        {20, true},
+		"MAIN.cache_hit":         {10, true},
+		"MGT.child_start":        {1, false},
+		"MGT.uptime":             {10, false},
+		"MAIN.n_object":          {-50, false},
+		"MAIN.sess_queue_length": {0, false},
+	} {
+		got := d.Counters[name]
+		if got.Delta != want.delta || got.Reset != want.reset {
+			t.Errorf("%s: got delta %d, reset %v, want %d, %v", name, got.Delta, got.Reset, want.delta, want.reset)
+		}
+	}
+
+	// without MAIN.uptime, only the counters that went back are known to be reset
+	delete(prev.Values, "MAIN.uptime")
+	d = stat.Diff(prev, cur)
+	if d.Restarted {
+		t.Error("expected no restart to be detected without MAIN.uptime")
+	}
+	if got := d.Counters["MAIN.cache_hit"]; got.Delta != 10 || !got.Reset || got.Rate != 1 {
+		t.Errorf("MAIN.cache_hit: got %+v", got)
+	}
+	if got := d.Counters["MAIN.client_req"]; got.Delta != 15 || got.Reset {
+		t.Errorf("MAIN.client_req: got %+v", got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	v := startVarnish(t)
+	defer v.Stop()
+
+	c := newStatReader(t, &v)
+	mustUpdate(t, c)
+	prev := c.Snapshot()
+
+	for range 3 {
+		if _, err := http.Get(v.URL + "/test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	cur := c.Snapshot()
+	if got := prev.Values["MAIN.client_req"].Value; got != 0 {
+		t.Errorf("expected the snapshot not to change, got MAIN.client_req == %d", got)
+	}
+	d := stat.Diff(prev, cur)
+	got, ok := d.Counters["MAIN.client_req"]
+	if !ok || got.Delta != 3 || got.Rate <= 0 || got.Semantics != stat.SemanticsCounter {
+		t.Errorf("MAIN.client_req: got %+v", got)
+	}
+}
@@ -5,6 +5,9 @@ package stat
 // Each counter has a fully-qualified name (e.g. "MAIN.cache_hit"), a current
 // value, and metadata describing its semantics and display format.
 //
+// With [StatReaderBuilder.SetPureGo], the shared memory is read in Go instead,
+// without libvarnishapi; the package then also builds with CGO_ENABLED=0.
+//
 // # Usage
 //
 // Dump all counters as JSON:
@@ -27,34 +30,11 @@ package stat
 //	enc := json.NewEncoder(os.Stdout)
 //	enc.Encode(r.Stats)
 
-// #cgo pkg-config: varnishapi
-// #include <stdint.h>
-// #include <stdio.h>
-// #include <stdlib.h>
-// #include <vdef.h>
-// #include <vapi/vsm.h>
-// #include <vapi/vsc.h>
-//
-// extern void *newPointCallback(void *priv, const struct VSC_point *const pt);
-// extern void  delPointCallback(void *priv, const struct VSC_point *const pt);
-// extern int   iterCallback(void *priv, const struct VSC_point *pt);
-//
-// static void callVSCState(struct vsc *vsc, void *priv) {
-//     VSC_State(vsc, newPointCallback, delPointCallback, priv);
-// }
-//
-// static int callVSCIter(struct vsc *vsc, struct vsm *vsm, void *priv) {
-//     return VSC_Iter(vsc, vsm, iterCallback, priv);
-// }
-import "C"
 import (
 	"fmt"
-	"runtime/cgo"
-	"strconv"
 	"time"
-	"unsafe"
 
-	"github.com/varnish/varnish-go/version"
+	"github.com/varnish/varnish-go/stat/vsm"
 )
 
 // Semantics describes how a counter's value should be interpreted.
@@ -124,7 +104,9 @@ func (f Flags) MarshalText() ([]byte, error) {
 	return []byte(f.String()), nil
 }
 
-func semanticsFromC(c C.int) Semantics {
+// semanticsFromChar decodes the semantics character of a counter, as found in
+// VSC_point and in the "flag" field of varnishstat -j.
+func semanticsFromChar(c byte) Semantics {
 	switch c {
 	case 'c':
 		return SemanticsCounter
@@ -139,7 +121,9 @@ func semanticsFromC(c C.int) Semantics {
 	}
 }
 
-func flagsFromC(c C.int) Flags {
+// flagsFromChar decodes the format character of a counter, as found in
+// VSC_point and in the "format" field of varnishstat -j.
+func flagsFromChar(c byte) Flags {
 	switch c {
 	case 'i':
 		return FlagsInteger
@@ -166,6 +150,7 @@ type Counter struct {
 	Value     *uint64   `json:"value"       yaml:"value"`                     // current value at the time of the last Update
 	Semantics Semantics `json:"semantics"   yaml:"semantics"`
 	Flags     Flags     `json:"flags"       yaml:"flags"`
+	Level     Level     `json:"level"       yaml:"level"`
 }
 
 // StatReaderBuilder configures the connection to a Varnish instance.
@@ -173,38 +158,25 @@ type Counter struct {
 // and [StatReaderBuilder.SetTimeout], then call [StatReaderBuilder.Attach] to
 // get a [StatReader].
 type StatReaderBuilder struct {
-	vsm *C.struct_vsm
-	vsc *C.struct_vsc
-	err error
+	name    string
+	timeout *time.Duration
+	filters []fieldFilter
+	level   Level
+	pureGo  bool
+	err     error
 }
 
 // New returns a new StatReaderBuilder with default settings.
 // You can customize it with [StatReaderBuilder.SetName],
 // [StatReaderBuilder.SetTimeout], etc. before calling [StatReaderBuilder.Attach] to get a [StatReader].
 func New() *StatReaderBuilder {
-	vsm := C.VSM_New()
-	if vsm == nil {
-		return &StatReaderBuilder{err: fmt.Errorf("VSM_New failed")}
-	}
-	vsc := C.VSC_New()
-	if vsc == nil {
-		C.VSM_Destroy(&vsm)
-		return &StatReaderBuilder{err: fmt.Errorf("VSC_New failed")}
-	}
-	return &StatReaderBuilder{vsm: vsm, vsc: vsc}
+	return &StatReaderBuilder{}
 }
 
 // SetName sets the Varnish instance name (workdir path) to connect to.
 // Corresponds to the -n flag of varnishd.
 func (b *StatReaderBuilder) SetName(name string) *StatReaderBuilder {
-	if b.err != nil {
-		return b
-	}
-	cname := C.CString(name)
-	defer C.free(unsafe.Pointer(cname))
-	if ret := C.VSM_Arg(b.vsm, 'n', cname); ret < 0 {
-		b.err = fmt.Errorf("VSM_Arg -n: %s", C.GoString(C.VSM_Error(b.vsm)))
-	}
+	b.name = name
 	return b
 }
 
@@ -212,79 +184,82 @@ func (b *StatReaderBuilder) SetName(name string) *StatReaderBuilder {
 // Varnish manager to become available. A zero duration uses the libvarnishapi
 // default (five seconds).
 func (b *StatReaderBuilder) SetTimeout(timeout time.Duration) *StatReaderBuilder {
-	if b.err != nil {
-		return b
-	}
-	ct := C.CString(strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64))
-	defer C.free(unsafe.Pointer(ct))
-	if ret := C.VSM_Arg(b.vsm, 't', ct); ret < 0 {
-		b.err = fmt.Errorf("VSM_Arg -t: %s", C.GoString(C.VSM_Error(b.vsm)))
-	}
+	b.timeout = &timeout
 	return b
 }
 
-// SetFieldIncludes sets the field inclusion globs. Not supported on Varnish
-// Enterprise, whose libvarnishapi doesn't implement the -I filter.
+// SetFieldIncludes adds field inclusion globs, like varnishstat -I.
+//
+// Inclusion and exclusion globs (see [StatReaderBuilder.SetFieldExcludes])
+// are matched against counter names in the order they were added, and the
+// first match decides. A counter matching no glob is kept, unless inclusion
+// globs were given. Globs use the fnmatch(3) syntax, e.g. "MAIN.*",
+// "VBE.*.happy" or "SM[!A].*".
+//
+// The filtering is done in Go, so it works the same with both editions, and
+// with [StatReaderBuilder.SetPureGo].
 func (b *StatReaderBuilder) SetFieldIncludes(inc ...string) *StatReaderBuilder {
-	if b.err != nil {
-		return b
-	}
-	if version.IsEnterprise() {
-		b.err = fmt.Errorf("SetFieldIncludes: not supported on Varnish Enterprise %s", version.Version())
-		return b
-	}
-	for _, i := range inc {
-		cinc := C.CString(i)
-		defer C.free(unsafe.Pointer(cinc))
-		if ret := C.VSC_Arg(b.vsc, 'I', cinc); ret < 0 {
-			b.err = fmt.Errorf("VSC_Arg -I %s: %s", i, C.GoString(C.VSM_Error(b.vsm)))
-		}
-	}
-	return b
+	return b.addFilters(false, inc)
 }
 
-// SetFieldExcludes sets the field exclusion globs. Not supported on Varnish
-// Enterprise, whose libvarnishapi doesn't implement the -X filter.
+// SetFieldExcludes adds field exclusion globs, like varnishstat -X. See
+// [StatReaderBuilder.SetFieldIncludes] for how they combine.
 func (b *StatReaderBuilder) SetFieldExcludes(xc ...string) *StatReaderBuilder {
+	return b.addFilters(true, xc)
+}
+
+func (b *StatReaderBuilder) addFilters(exclude bool, globs []string) *StatReaderBuilder {
 	if b.err != nil {
 		return b
 	}
-	if version.IsEnterprise() {
-		b.err = fmt.Errorf("SetFieldExcludes: not supported on Varnish Enterprise %s", version.Version())
-		return b
-	}
-	for _, x := range xc {
-		cxc := C.CString(x)
-		defer C.free(unsafe.Pointer(cxc))
-		if ret := C.VSC_Arg(b.vsc, 'X', cxc); ret < 0 {
-			b.err = fmt.Errorf("VSC_Arg -X %s: %s", x, C.GoString(C.VSM_Error(b.vsm)))
+	for _, g := range globs {
+		if err := checkGlob(g); err != nil {
+			b.err = fmt.Errorf("bad field glob %q: %w", g, err)
+			return b
 		}
+		b.filters = append(b.filters, fieldFilter{pattern: g, exclude: exclude})
 	}
 	return b
 }
 
+// SetLevel only keeps the counters up to the given verbosity level, e.g.
+// [LevelInfo] for the counters varnishstat shows by default. All levels are
+// kept by default.
+func (b *StatReaderBuilder) SetLevel(level Level) *StatReaderBuilder {
+	b.level = level
+	return b
+}
+
+// SetPureGo makes the [StatReader] read the shared memory files in Go, with
+// the [github.com/varnish/varnish-go/stat/vsm] package, instead of going
+// through libvarnishapi. [SetName] is then required;
+// [StatReaderBuilder.Attach] returns an error otherwise.
+//
+// When the program is built with CGO_ENABLED=0, libvarnishapi isn't available
+// and SetPureGo(true) is the only way to attach.
+func (b *StatReaderBuilder) SetPureGo(enable bool) *StatReaderBuilder {
+	b.pureGo = enable
+	return b
+}
+
 // Attach connects to the Varnish shared memory segment and returns a
-// [StatReader]. If progress is a non-negative file descriptor, a period is
-// written to it for each second spent waiting; pass -1 to suppress progress
-// output. On failure the underlying VSM and VSC handles are freed; the
-// StatReaderBuilder must not be used again.
+// [StatReader], waiting for the manager up to the timeout given to
+// [StatReaderBuilder.SetTimeout]. The StatReaderBuilder must not be used
+// again.
 func (b *StatReaderBuilder) Attach() (*StatReader, error) {
 	if b.err != nil {
 		return nil, b.err
 	}
-	if ret := C.VSM_Attach(b.vsm, 0); ret != 0 {
-		err := fmt.Errorf("VSM_Attach: %s", C.GoString(C.VSM_Error(b.vsm)))
-		C.VSC_Destroy(&b.vsc, b.vsm)
-		C.VSM_Destroy(&b.vsm)
-		return nil, err
+	r := &StatReader{Stats: make(map[string]Counter), filters: b.filters, level: b.level}
+	var err error
+	if b.pureGo {
+		r.pure, err = attachPure(b)
+	} else {
+		r.vapi, err = attachVapi(b, r)
 	}
-	r := &StatReader{
-		vsm:   b.vsm,
-		vsc:   b.vsc,
-		Stats: make(map[string]Counter),
+	if err != nil {
+		return nil, err
 	}
-	r.handle = cgo.NewHandle(r)
-	C.callVSCState(b.vsc, unsafe.Pointer(uintptr(r.handle)))
 	return r, nil
 }
 
@@ -295,22 +270,26 @@ func (b *StatReaderBuilder) Attach() (*StatReader, error) {
 //
 // Important:StatReader.Stats is read-only and must not be modified by the caller.
 type StatReader struct {
-	vsm     *C.struct_vsm
-	vsc     *C.struct_vsc
 	Stats   map[string]Counter
-	handle  cgo.Handle
+	vapi    *vapi    // libvarnishapi backend
+	pure    *vsm.VSM // pure Go backend, see SetPureGo
+	filters []fieldFilter
+	level   Level
 	added   []string
 	removed []string
 }
 
 // Update will refresh the [StatReader.Stats] map to remove deleted counters and add new ones.
+// With [StatReaderBuilder.SetPureGo], the counters added and removed are
+// returned even along with an error, as the Stats map already reflects them.
 func (r *StatReader) Update() (added, removed []string, err error) {
+	if r.pure != nil {
+		return r.updatePure()
+	}
 	r.added = r.added[:0]
 	r.removed = r.removed[:0]
-	C.VSM_Status(r.vsm)
-	ret := C.callVSCIter(r.vsc, r.vsm, unsafe.Pointer(uintptr(r.handle)))
-	if ret != 0 {
-		return nil, nil, fmt.Errorf("VSC_Iter returned %d", ret)
+	if err := r.vapi.update(r); err != nil {
+		return nil, nil, err
 	}
 	return r.added, r.removed, nil
 }
@@ -327,7 +306,9 @@ func (r *StatReader) Counter(name string) (uint64, error) {
 // Close releases all resources held by the StatReader. It must be called
 // exactly once when the StatReader is no longer needed.
 func (r *StatReader) Close() {
-	C.VSC_Destroy(&r.vsc, r.vsm)
-	C.VSM_Destroy(&r.vsm)
-	r.handle.Delete()
+	if r.pure != nil {
+		r.pure.Close()
+		return
+	}
+	r.vapi.close()
 }
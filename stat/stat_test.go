@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/varnish/varnish-go/stat"
-	"github.com/varnish/varnish-go/version"
 	"github.com/varnish/varnish-go/vtest"
 )
 
@@ -48,13 +47,12 @@ func startVarnish(t *testing.T) vtest.Varnish {
 
 func newStatReader(t *testing.T, v *vtest.Varnish) *stat.StatReader {
 	t.Helper()
-	b := stat.New().
+	r, err := stat.New().
 		SetName(v.Name()).
-		SetTimeout(5 * time.Second)
-	if !version.IsEnterprise() {
-		b = b.SetFieldExcludes("MAIN.threads*", "MAIN.n_vcl").SetFieldIncludes("MAIN.*")
-	}
-	r, err := b.Attach()
+		SetTimeout(5*time.Second).
+		SetFieldExcludes("MAIN.threads*", "MAIN.n_vcl").
+		SetFieldIncludes("MAIN.*").
+		Attach()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -138,19 +136,17 @@ func TestCounters(t *testing.T) {
 		t.Error("expected no counter for unknown name")
 	}
 
-	if !version.IsEnterprise() {
-		for name := range c.Stats {
-			if !strings.HasPrefix(name, "MAIN.") {
-				t.Errorf("expected only MAIN.* counters, got %q", name)
-			}
-			if strings.HasPrefix(name, "MAIN.threads") {
-				t.Errorf("expected MAIN.threads* to be excluded, got %q", name)
-			}
+	for name := range c.Stats {
+		if !strings.HasPrefix(name, "MAIN.") {
+			t.Errorf("expected only MAIN.* counters, got %q", name)
 		}
-		if _, ok := c.Stats["MAIN.n_vcl"]; ok {
-			t.Fatal("expected MAIN.n_vcl to be excluded from Stats")
+		if strings.HasPrefix(name, "MAIN.threads") {
+			t.Errorf("expected MAIN.threads* to be excluded, got %q", name)
 		}
 	}
+	if _, ok := c.Stats["MAIN.n_vcl"]; ok {
+		t.Fatal("expected MAIN.n_vcl to be excluded from Stats")
+	}
 }
 
 func TestCounterValue(t *testing.T) {
@@ -0,0 +1,105 @@
+package stat
+
+// #cgo pkg-config: varnishapi
+// #include <stdint.h>
+// #include <stdio.h>
+// #include <stdlib.h>
+// #include <vdef.h>
+// #include <vapi/vsm.h>
+// #include <vapi/vsc.h>
+//
+// extern void *newPointCallback(void *priv, const struct VSC_point *const pt);
+// extern void  delPointCallback(void *priv, const struct VSC_point *const pt);
+// extern int   iterCallback(void *priv, const struct VSC_point *pt);
+//
+// static void callVSCState(struct vsc *vsc, void *priv) {
+//     VSC_State(vsc, newPointCallback, delPointCallback, priv);
+// }
+//
+// static int callVSCIter(struct vsc *vsc, struct vsm *vsm, void *priv) {
+//     return VSC_Iter(vsc, vsm, iterCallback, priv);
+// }
+import "C"
+import (
+	"fmt"
+	"runtime/cgo"
+	"strconv"
+	"unsafe"
+)
+
+// vapi reads the counters through libvarnishapi's VSM and VSC handles.
+type vapi struct {
+	vsm    *C.struct_vsm
+	vsc    *C.struct_vsc
+	handle cgo.Handle
+}
+
+func semanticsFromC(c C.int) Semantics {
+	return semanticsFromChar(byte(c))
+}
+
+func flagsFromC(c C.int) Flags {
+	return flagsFromChar(byte(c))
+}
+
+// attachVapi creates the handles configured by b, and attaches them. The
+// counters are added to r by the VSC callbacks. On failure the handles are
+// freed.
+func attachVapi(b *StatReaderBuilder, r *StatReader) (*vapi, error) {
+	a := &vapi{vsm: C.VSM_New()}
+	if a.vsm == nil {
+		return nil, fmt.Errorf("VSM_New failed")
+	}
+	if a.vsc = C.VSC_New(); a.vsc == nil {
+		C.VSM_Destroy(&a.vsm)
+		return nil, fmt.Errorf("VSC_New failed")
+	}
+	err := a.configure(b)
+	if err == nil && C.VSM_Attach(a.vsm, 0) != 0 {
+		err = fmt.Errorf("VSM_Attach: %s", C.GoString(C.VSM_Error(a.vsm)))
+	}
+	if err != nil {
+		C.VSC_Destroy(&a.vsc, a.vsm)
+		C.VSM_Destroy(&a.vsm)
+		return nil, err
+	}
+	a.handle = cgo.NewHandle(r)
+	C.callVSCState(a.vsc, unsafe.Pointer(uintptr(a.handle)))
+	return a, nil
+}
+
+// configure passes the settings of b to the handles, as the -n and -t
+// arguments. Field filters are applied by the callbacks instead, as
+// libvarnishapi doesn't support them on Varnish Enterprise.
+func (a *vapi) configure(b *StatReaderBuilder) error {
+	if b.name != "" {
+		cname := C.CString(b.name)
+		defer C.free(unsafe.Pointer(cname))
+		if ret := C.VSM_Arg(a.vsm, 'n', cname); ret < 0 {
+			return fmt.Errorf("VSM_Arg -n: %s", C.GoString(C.VSM_Error(a.vsm)))
+		}
+	}
+	if b.timeout != nil {
+		ct := C.CString(strconv.FormatFloat(b.timeout.Seconds(), 'f', -1, 64))
+		defer C.free(unsafe.Pointer(ct))
+		if ret := C.VSM_Arg(a.vsm, 't', ct); ret < 0 {
+			return fmt.Errorf("VSM_Arg -t: %s", C.GoString(C.VSM_Error(a.vsm)))
+		}
+	}
+	return nil
+}
+
+// update refreshes r.Stats through the VSC callbacks.
+func (a *vapi) update(r *StatReader) error {
+	C.VSM_Status(a.vsm)
+	if ret := C.callVSCIter(a.vsc, a.vsm, unsafe.Pointer(uintptr(a.handle))); ret != 0 {
+		return fmt.Errorf("VSC_Iter returned %d", ret)
+	}
+	return nil
+}
+
+func (a *vapi) close() {
+	C.VSC_Destroy(&a.vsc, a.vsm)
+	C.VSM_Destroy(&a.vsm)
+	a.handle.Delete()
+}
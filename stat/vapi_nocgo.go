@@ -0,0 +1,18 @@
+//go:build !cgo
+
+package stat
+
+import "fmt"
+
+// vapi is unavailable without CGo, see SetPureGo.
+type vapi struct{}
+
+func attachVapi(*StatReaderBuilder, *StatReader) (*vapi, error) {
+	return nil, fmt.Errorf("libvarnishapi is not available without cgo, use SetPureGo")
+}
+
+func (a *vapi) update(*StatReader) error {
+	return fmt.Errorf("libvarnishapi is not available without cgo")
+}
+
+func (a *vapi) close() {}
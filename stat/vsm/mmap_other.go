@@ -0,0 +1,17 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package vsm
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+func mmapSegment(Segment) (mem, data []byte, err error) {
+	return nil, nil, fmt.Errorf("shared memory on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+}
+
+func munmap([]byte) error {
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package vsm
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapSegment maps the file of a segment read-only, and returns the mapping
+// and the segment within it. Mappings start on a page boundary, so the
+// segment may not start the mapping.
+func mmapSegment(s Segment) (mem, data []byte, err error) {
+	f, err := os.Open(s.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	if s.Offset < 0 || s.Length <= 0 {
+		return nil, nil, fmt.Errorf("bad segment range %d+%d", s.Offset, s.Length)
+	}
+	skip := s.Offset % int64(os.Getpagesize())
+	mem, err = syscall.Mmap(int(f.Fd()), s.Offset-skip, int(skip+s.Length), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mem, mem[skip:], nil
+}
+
+func munmap(mem []byte) error {
+	return syscall.Munmap(mem)
+}
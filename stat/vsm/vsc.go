@@ -0,0 +1,132 @@
+package vsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unsafe"
+)
+
+// headSize is the size of struct vsc_head, at the start of Stat and StatDoc
+// segments.
+const headSize = 24
+
+// head is struct vsc_head. ready is set once the segment is initialised;
+// docID links a Stat segment to the StatDoc segment describing it.
+type head struct {
+	ready      uint64
+	bodyOffset uint64
+	docID      uint64
+}
+
+// readHead decodes the head of a segment. It returns false if the segment
+// isn't ready or is malformed.
+func readHead(data []byte) (head, bool) {
+	if len(data) < headSize {
+		return head{}, false
+	}
+	h := head{
+		ready:      binary.NativeEndian.Uint64(data[0:]),
+		bodyOffset: binary.NativeEndian.Uint64(data[8:]),
+		docID:      binary.NativeEndian.Uint64(data[16:]),
+	}
+	return h, h.ready != 0 && h.bodyOffset >= headSize && h.bodyOffset <= uint64(len(data))
+}
+
+// jsonIndex is the "index" of an element, a number or a string holding one
+// depending on the Varnish version.
+type jsonIndex uint64
+
+func (i *jsonIndex) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseUint(string(bytes.Trim(b, `"`)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad index %s", b)
+	}
+	*i = jsonIndex(n)
+	return nil
+}
+
+// jsonDoc is the description of a group of counters, as generated by
+// vsctool.py and stored in StatDoc segments.
+type jsonDoc struct {
+	Name string `json:"name"`
+	Elem map[string]struct {
+		Name     string    `json:"name"`
+		Type     string    `json:"type"`
+		Format   string    `json:"format"`
+		Level    string    `json:"level"`
+		Oneliner string    `json:"oneliner"`
+		Docs     string    `json:"docs"`
+		Index    jsonIndex `json:"index"`
+	} `json:"elem"`
+}
+
+// parsePoints returns the counters of the Stat segment with the given ident
+// and body, described by the StatDoc segment doc.
+func parsePoints(ident string, body, doc []byte) ([]Point, error) {
+	h, ok := readHead(doc)
+	if !ok {
+		return nil, fmt.Errorf("documentation segment not ready")
+	}
+	text := doc[h.bodyOffset:]
+	if i := bytes.IndexByte(text, '{'); i >= 0 {
+		text = text[i:]
+	}
+	var jd jsonDoc
+	if err := json.NewDecoder(bytes.NewReader(text)).Decode(&jd); err != nil {
+		return nil, fmt.Errorf("decode documentation: %w", err)
+	}
+	pts := make([]Point, 0, len(jd.Elem))
+	for key, e := range jd.Elem {
+		if e.Name == "" {
+			e.Name = key
+		}
+		if len(body) < 8 || uint64(e.Index) > uint64(len(body)-8) || e.Index%8 != 0 {
+			return nil, fmt.Errorf("counter %s: bad index %d", e.Name, e.Index)
+		}
+		pts = append(pts, Point{
+			Name:      ident + "." + e.Name,
+			Semantics: semantics(e.Type),
+			Format:    format(e.Format),
+			Level:     e.Level,
+			SDesc:     e.Oneliner,
+			LDesc:     e.Docs,
+			Value:     (*uint64)(unsafe.Pointer(&body[e.Index])),
+		})
+	}
+	return pts, nil
+}
+
+// semantics maps the type of an element to the semantics character of
+// VSC_point, as libvarnishapi does.
+func semantics(typ string) byte {
+	switch typ {
+	case "counter":
+		return 'c'
+	case "gauge":
+		return 'g'
+	case "bitmap":
+		return 'b'
+	default:
+		return '?'
+	}
+}
+
+// format maps the format of an element to the format character of
+// VSC_point, as libvarnishapi does.
+func format(f string) byte {
+	switch f {
+	case "integer":
+		return 'i'
+	case "bytes":
+		return 'B'
+	case "bitmap":
+		return 'b'
+	case "duration":
+		return 'd'
+	default:
+		return '?'
+	}
+}
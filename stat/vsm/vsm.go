@@ -0,0 +1,283 @@
+// Read Varnish statistics counters from the shared memory files in pure Go
+package vsm
+
+// Unlike the stat package, vsm doesn't use libvarnishapi or CGo: it parses the
+// VSM index files of a running varnishd (_.vsm_mgt/_.index and
+// _.vsm_child/_.index in its workdir), maps the VSC segments they list, and
+// reads the JSON metadata varnishd embeds next to them. It can therefore be
+// used from static binaries built with CGO_ENABLED=0.
+//
+// The layout it understands is the one of Varnish Cache 6.2 and later, where
+// counter metadata lives in separate StatDoc segments. Reading the files needs
+// the same permissions as varnishstat, usually membership of the varnish
+// group.
+//
+// [github.com/varnish/varnish-go/stat] uses this package when
+// [github.com/varnish/varnish-go/stat.StatReaderBuilder.SetPureGo] is set.
+//
+// # Usage
+//
+//	r, err := vsm.Open("/var/lib/varnish/varnishd")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer r.Close()
+//
+//	if _, _, err := r.Update(); err != nil {
+//	    log.Fatal(err)
+//	}
+//	for name, pt := range r.Points {
+//	    fmt.Println(name, *pt.Value)
+//	}
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultStateDir is where varnishd puts the workdir of an instance whose -n
+// argument isn't an absolute path, in the default build configuration.
+const DefaultStateDir = "/var/lib/varnish"
+
+// Classes of the segments this package reads, as listed in the index.
+const (
+	ClassStat    = "Stat"    // counter values
+	ClassStatDoc = "StatDoc" // JSON description of the counters of Stat segments
+)
+
+// The directories of the VSM files of the manager and the child process, and
+// the name of their index, relative to the workdir.
+const (
+	mgtDir    = "_.vsm_mgt"
+	childDir  = "_.vsm_child"
+	indexFile = "_.index"
+)
+
+// Workdir returns the workdir of the instance with the given -n argument:
+// name itself if it's an absolute path, or its path under [DefaultStateDir].
+func Workdir(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(DefaultStateDir, name)
+}
+
+// Segment is an entry of a VSM index: a range of a file, holding a chunk of
+// shared memory of a given class.
+type Segment struct {
+	File   string // absolute path of the file
+	Offset int64
+	Length int64
+	Class  string // e.g. "Stat", "StatDoc" or "Arg"
+	Ident  string // e.g. "MAIN" or "VBE.boot.default" for Stat segments
+}
+
+// ParseIndex reads a VSM index file, and returns the segments it lists, in
+// order. File names are resolved relative to dir.
+//
+// The index starts with a "# <pid> <birth>" comment line. Since Varnish 6.2,
+// each line then adds ("+") or removes ("-") a segment; lines without a sign,
+// as written by older releases, add one.
+func ParseIndex(r io.Reader, dir string) ([]Segment, error) {
+	var segs []Segment
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		remove := false
+		switch line[0] {
+		case '-':
+			remove = true
+			fallthrough
+		case '+':
+			line = strings.TrimLeft(line[1:], " ")
+		}
+		f := strings.SplitN(line, " ", 5)
+		if len(f) < 4 {
+			return nil, fmt.Errorf("index line %d: expected at least 4 fields, got %d", n, len(f))
+		}
+		off, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("index line %d: bad offset: %w", n, err)
+		}
+		length, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("index line %d: bad length: %w", n, err)
+		}
+		seg := Segment{File: filepath.Join(dir, f[0]), Offset: off, Length: length, Class: f[3]}
+		if len(f) == 5 {
+			seg.Ident = f[4]
+		}
+		if !remove {
+			segs = append(segs, seg)
+			continue
+		}
+		for i, s := range segs {
+			if s == seg {
+				segs = append(segs[:i], segs[i+1:]...)
+				break
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return segs, nil
+}
+
+// Point is a counter, mirroring libvarnishapi's VSC_point.
+type Point struct {
+	Name string // e.g. "MAIN.cache_hit"
+	// Semantics and Format are the characters of VSC_point: 'c' (counter),
+	// 'g' (gauge) or 'b' (bitmap), and 'i' (integer), 'B' (bytes),
+	// 'b' (bitmap) or 'd' (duration); '?' when unknown.
+	Semantics byte
+	Format    byte
+	Level     string // "info", "diag" or "debug"
+	SDesc     string // short description
+	LDesc     string // long description
+	// Value points into the shared memory, and is valid until the next
+	// Update removes the point, or until Close.
+	Value *uint64
+}
+
+// mapped is a Stat or StatDoc segment mapped in memory.
+type mapped struct {
+	seg  Segment
+	mem  []byte // the whole mapping, to unmap
+	data []byte // the segment within mem
+	// points are the names of the counters of a Stat segment, nil until
+	// they are read.
+	points []string
+}
+
+// VSM reads the counters of a Varnish instance. Obtain one with [Open], then
+// call [VSM.Update] to refresh [VSM.Points]. A VSM is not safe for
+// concurrent use.
+type VSM struct {
+	// Points are the counters, by name. It's read-only.
+	Points map[string]Point
+
+	workdir string
+	segs    map[Segment]*mapped
+}
+
+// Open returns a VSM reading the instance with the given workdir, see
+// [Workdir]. It fails if the manager process hasn't created its index yet.
+func Open(workdir string) (*VSM, error) {
+	if _, err := os.Stat(filepath.Join(workdir, mgtDir, indexFile)); err != nil {
+		return nil, fmt.Errorf("no VSM in %s: %w", workdir, err)
+	}
+	return &VSM{Points: map[string]Point{}, workdir: workdir, segs: map[Segment]*mapped{}}, nil
+}
+
+// Update rereads the indexes, maps the new segments and unmaps the removed
+// ones, and refreshes [VSM.Points] accordingly. It returns the names of the
+// counters it added and removed.
+//
+// A Stat segment whose description isn't available yet, e.g. because the
+// child is still creating it, is picked up by a later Update. A segment that
+// can't be mapped or read is retried by the next Update too; the others are
+// processed anyway, so added and removed are valid even if err isn't nil.
+func (v *VSM) Update() (added, removed []string, err error) {
+	var live []Segment
+	for i, dir := range []string{mgtDir, childDir} {
+		dir = filepath.Join(v.workdir, dir)
+		f, err := os.Open(filepath.Join(dir, indexFile))
+		if i > 0 && errors.Is(err, fs.ErrNotExist) {
+			continue // no child running
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		segs, err := ParseIndex(f, dir)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		live = append(live, segs...)
+	}
+
+	keep := map[Segment]bool{}
+	for _, s := range live {
+		if s.Class == ClassStat || s.Class == ClassStatDoc {
+			keep[s] = true
+		}
+	}
+	for s, m := range v.segs {
+		if keep[s] {
+			continue
+		}
+		for _, name := range m.points {
+			delete(v.Points, name)
+			removed = append(removed, name)
+		}
+		munmap(m.mem)
+		delete(v.segs, s)
+	}
+	var errs []error
+	for s := range keep {
+		if _, ok := v.segs[s]; ok {
+			continue
+		}
+		mem, data, err := mmapSegment(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("map %s %s: %w", s.Class, s.Ident, err))
+			continue
+		}
+		v.segs[s] = &mapped{seg: s, mem: mem, data: data}
+	}
+
+	docs := map[uint64]*mapped{}
+	for _, m := range v.segs {
+		if h, ok := readHead(m.data); ok && m.seg.Class == ClassStatDoc {
+			docs[h.docID] = m
+		}
+	}
+	for _, m := range v.segs {
+		if m.seg.Class != ClassStat || m.points != nil {
+			continue
+		}
+		h, ok := readHead(m.data)
+		if !ok {
+			continue
+		}
+		doc, ok := docs[h.docID]
+		if !ok {
+			continue
+		}
+		pts, err := parsePoints(m.seg.Ident, m.data[h.bodyOffset:], doc.data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", m.seg.Class, m.seg.Ident, err))
+			continue
+		}
+		m.points = []string{}
+		for _, pt := range pts {
+			v.Points[pt.Name] = pt
+			m.points = append(m.points, pt.Name)
+			added = append(added, pt.Name)
+		}
+	}
+	return added, removed, errors.Join(errs...)
+}
+
+// Close unmaps every segment. The VSM and its points must not be used
+// afterwards.
+func (v *VSM) Close() error {
+	var errs []error
+	for s, m := range v.segs {
+		errs = append(errs, munmap(m.mem))
+		delete(v.segs, s)
+	}
+	clear(v.Points)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,244 @@
+package vsm_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/varnish/varnish-go/stat/vsm"
+)
+
+const mainDoc = `{
+  "version": "1",
+  "name": "MAIN",
+  "oneliner": "Main counters",
+  "elements": 3,
+  "elem": {
+    "uptime": {"name": "uptime", "type": "counter", "format": "duration", "level": "info",
+      "oneliner": "Child process uptime", "docs": "How long the child process has been running.", "index": 0},
+    "cache_hit": {"name": "cache_hit", "type": "counter", "format": "integer", "level": "info",
+      "oneliner": "Cache hits", "docs": "Count of cache hits.", "index": "8"},
+    "n_object": {"name": "n_object", "type": "gauge", "format": "integer", "level": "info",
+      "oneliner": "object structs made", "docs": "", "index": 16}
+  }
+}`
+
+// segment returns a Stat or StatDoc segment: a vsc_head followed by body at
+// offset 32.
+func segment(docID uint64, body []byte) []byte {
+	b := make([]byte, 32, 32+len(body))
+	binary.NativeEndian.PutUint64(b[0:], 1)
+	binary.NativeEndian.PutUint64(b[8:], 32)
+	binary.NativeEndian.PutUint64(b[16:], docID)
+	return append(b, body...)
+}
+
+func counters(values ...uint64) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.NativeEndian.AppendUint64(b, v)
+	}
+	return b
+}
+
+// workdir lays out a fake instance: the given segments are written to a
+// single cluster file, and listed in the index of the child.
+type workdir struct {
+	dir   string
+	index []string
+	data  []byte
+}
+
+func newWorkdir(t *testing.T) *workdir {
+	t.Helper()
+	w := &workdir{dir: t.TempDir()}
+	for _, d := range []string{"_.vsm_mgt", "_.vsm_child"} {
+		if err := os.Mkdir(filepath.Join(w.dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(w.dir, "_.vsm_mgt", "_.index"), []byte("# 1 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// add appends a segment at an unaligned offset of the cluster, and returns
+// its index line.
+func (w *workdir) add(t *testing.T, class, ident string, seg []byte) string {
+	t.Helper()
+	w.data = append(w.data, make([]byte, 40)...)
+	line := fmt.Sprintf("_.Cluster.1 %d %d %s %s", len(w.data), len(seg), class, ident)
+	w.data = append(w.data, seg...)
+	w.index = append(w.index, "+ "+line)
+	w.write(t)
+	return line
+}
+
+func (w *workdir) remove(t *testing.T, line string) {
+	t.Helper()
+	w.index = append(w.index, "- "+line)
+	w.write(t)
+}
+
+func (w *workdir) write(t *testing.T) {
+	t.Helper()
+	child := filepath.Join(w.dir, "_.vsm_child")
+	if err := os.WriteFile(filepath.Join(child, "_.Cluster.1"), w.data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	index := "# 3 4\n" + strings.Join(w.index, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(child, "_.index"), []byte(index), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func open(t *testing.T, dir string) *vsm.VSM {
+	t.Helper()
+	v, err := vsm.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { v.Close() })
+	return v
+}
+
+func update(t *testing.T, v *vsm.VSM) (added, removed []string) {
+	t.Helper()
+	added, removed, err := v.Update()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	return added, removed
+}
+
+func TestParseIndex(t *testing.T) {
+	index := `# 1234 1700000000
++ _.Stat.1 0 4096 Stat MAIN
++ _.Stat.1 4096 4096 Stat VBE.boot.default
+_.Arg.1 0 64 Arg -T
+- _.Stat.1 4096 4096 Stat VBE.boot.default
++ _.Log.1 0 8192 Log
+`
+	segs, err := vsm.ParseIndex(strings.NewReader(index), "/w/_.vsm_child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vsm.Segment{
+		{File: "/w/_.vsm_child/_.Stat.1", Offset: 0, Length: 4096, Class: "Stat", Ident: "MAIN"},
+		{File: "/w/_.vsm_child/_.Arg.1", Offset: 0, Length: 64, Class: "Arg", Ident: "-T"},
+		{File: "/w/_.vsm_child/_.Log.1", Offset: 0, Length: 8192, Class: "Log"},
+	}
+	if !slices.Equal(segs, want) {
+		t.Errorf("got %+v, want %+v", segs, want)
+	}
+
+	if _, err := vsm.ParseIndex(strings.NewReader("+ _.Stat.1 x 4096 Stat MAIN\n"), "/w"); err == nil {
+		t.Error("expected an error for a bad offset")
+	}
+}
+
+func TestWorkdir(t *testing.T) {
+	if got := vsm.Workdir("/tmp/v1"); got != "/tmp/v1" {
+		t.Errorf("Workdir(/tmp/v1) = %s", got)
+	}
+	if got := vsm.Workdir("v1"); got != filepath.Join(vsm.DefaultStateDir, "v1") {
+		t.Errorf("Workdir(v1) = %s", got)
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	if _, err := vsm.Open(t.TempDir()); err == nil {
+		t.Error("expected an error without an index")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	w := newWorkdir(t)
+	w.add(t, vsm.ClassStatDoc, "MAIN", segment(42, []byte(mainDoc+"\x00")))
+	stat := w.add(t, vsm.ClassStat, "MAIN", segment(42, counters(3600, 12, 7)))
+
+	v := open(t, w.dir)
+	added, removed := update(t, v)
+	if want := []string{"MAIN.cache_hit", "MAIN.n_object", "MAIN.uptime"}; !slices.Equal(added, want) || len(removed) != 0 {
+		t.Fatalf("added %v, removed %v; want added %v", added, removed, want)
+	}
+
+	hit := v.Points["MAIN.cache_hit"]
+	if *hit.Value != 12 || hit.Semantics != 'c' || hit.Format != 'i' || hit.SDesc != "Cache hits" ||
+		hit.LDesc != "Count of cache hits." || hit.Level != "info" {
+		t.Errorf("unexpected MAIN.cache_hit: %+v (value %d)", hit, *hit.Value)
+	}
+	if pt := v.Points["MAIN.uptime"]; *pt.Value != 3600 || pt.Format != 'd' {
+		t.Errorf("unexpected MAIN.uptime: %+v (value %d)", pt, *pt.Value)
+	}
+	if pt := v.Points["MAIN.n_object"]; *pt.Value != 7 || pt.Semantics != 'g' {
+		t.Errorf("unexpected MAIN.n_object: %+v (value %d)", pt, *pt.Value)
+	}
+
+	// the values follow the file, without an Update
+	binary.NativeEndian.PutUint64(w.data[len(w.data)-16:], 13)
+	w.write(t)
+	if got := *hit.Value; got != 13 {
+		t.Errorf("MAIN.cache_hit = %d after write, want 13", got)
+	}
+
+	if added, removed := update(t, v); len(added)+len(removed) != 0 {
+		t.Errorf("second update: added %v, removed %v", added, removed)
+	}
+
+	w.remove(t, stat)
+	added, removed = update(t, v)
+	if want := []string{"MAIN.cache_hit", "MAIN.n_object", "MAIN.uptime"}; !slices.Equal(removed, want) || len(added) != 0 {
+		t.Errorf("added %v, removed %v; want removed %v", added, removed, want)
+	}
+	if len(v.Points) != 0 {
+		t.Errorf("points left: %v", v.Points)
+	}
+}
+
+func TestUpdateWaitsForDoc(t *testing.T) {
+	w := newWorkdir(t)
+	w.add(t, vsm.ClassStat, "MAIN", segment(42, counters(1, 2, 3)))
+
+	v := open(t, w.dir)
+	if added, _ := update(t, v); len(added) != 0 {
+		t.Fatalf("added %v without documentation", added)
+	}
+	w.add(t, vsm.ClassStatDoc, "MAIN", segment(42, []byte(mainDoc)))
+	if added, _ := update(t, v); len(added) != 3 {
+		t.Errorf("added %v, want 3 counters", added)
+	}
+}
+
+func TestUpdateWithoutChild(t *testing.T) {
+	w := newWorkdir(t)
+	v := open(t, w.dir)
+	if added, removed := update(t, v); len(added)+len(removed) != 0 {
+		t.Errorf("added %v, removed %v", added, removed)
+	}
+}
+
+func TestUpdateBadIndex(t *testing.T) {
+	w := newWorkdir(t)
+	w.add(t, vsm.ClassStatDoc, "MAIN", segment(42, []byte(strings.Replace(mainDoc, `"index": 16`, `"index": 64`, 1))))
+	w.add(t, vsm.ClassStat, "MAIN", segment(42, counters(1, 2, 3)))
+	w.add(t, vsm.ClassStatDoc, "MAIN", segment(43, []byte(mainDoc)))
+	w.add(t, vsm.ClassStat, "MGT", segment(43, counters(1, 2, 3)))
+
+	v := open(t, w.dir)
+	added, _, err := v.Update()
+	if err == nil {
+		t.Error("expected an error for a counter out of its segment")
+	}
+	slices.Sort(added)
+	if want := []string{"MGT.cache_hit", "MGT.n_object", "MGT.uptime"}; !slices.Equal(added, want) {
+		t.Errorf("added %v along with the error, want %v", added, want)
+	}
+}
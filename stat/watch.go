@@ -0,0 +1,294 @@
+package stat
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Comparison is how a [Threshold] compares a counter to its limit.
+type Comparison int
+
+const (
+	Above Comparison = iota // strictly greater than the limit
+	Below                   // strictly less than the limit
+)
+
+// String returns ">" or "<". Implements [fmt.Stringer].
+func (c Comparison) String() string {
+	switch c {
+	case Above:
+		return ">"
+	case Below:
+		return "<"
+	default:
+		return "?"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so that Comparison serializes
+// as ">" or "<".
+func (c Comparison) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Measure is what a [Threshold] compares to its limit.
+type Measure int
+
+const (
+	MeasureValue Measure = iota // the value of the counter
+	MeasureRate                 // its per-second rate, for counters
+	MeasureDelta                // its change, see [Delta.Delta]
+)
+
+// String returns the name of the measure. Implements [fmt.Stringer].
+func (m Measure) String() string {
+	switch m {
+	case MeasureValue:
+		return "value"
+	case MeasureRate:
+		return "rate"
+	case MeasureDelta:
+		return "delta"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so that Measure serializes
+// as its name.
+func (m Measure) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Threshold is a condition on a counter, checked against the [Deltas] between
+// two snapshots. Build one with [OnRate], [OnValue] or [OnDelta].
+type Threshold struct {
+	Name  string     `json:"name"  yaml:"name"` // counter name, e.g. "MAIN.backend_fail"
+	Of    Measure    `json:"of"    yaml:"of"`
+	Op    Comparison `json:"op"    yaml:"op"`
+	Limit float64    `json:"limit" yaml:"limit"`
+}
+
+// OnRate returns a threshold on the per-second rate of a counter, e.g.
+// OnRate("MAIN.backend_fail", stat.Above, 5) for more than 5 backend failures
+// per second. Only counters ([SemanticsCounter]) have a rate.
+func OnRate(name string, op Comparison, perSecond float64) Threshold {
+	return Threshold{Name: name, Of: MeasureRate, Op: op, Limit: perSecond}
+}
+
+// OnValue returns a threshold on the value of a counter, typically a gauge,
+// e.g. OnValue("MAIN.sess_queue_length", stat.Above, 100).
+func OnValue(name string, op Comparison, limit float64) Threshold {
+	return Threshold{Name: name, Of: MeasureValue, Op: op, Limit: limit}
+}
+
+// OnDelta returns a threshold on the change of a counter between two
+// snapshots, e.g. OnDelta("MAIN.backend_fail", stat.Above, 0) for any backend
+// failure during a load test.
+func OnDelta(name string, op Comparison, limit float64) Threshold {
+	return Threshold{Name: name, Of: MeasureDelta, Op: op, Limit: limit}
+}
+
+// String describes the threshold, e.g. "rate(MAIN.backend_fail) > 5".
+// Implements [fmt.Stringer].
+func (t Threshold) String() string {
+	if t.Of == MeasureValue {
+		return fmt.Sprintf("%s %s %g", t.Name, t.Op, t.Limit)
+	}
+	return fmt.Sprintf("%s(%s) %s %g", t.Of, t.Name, t.Op, t.Limit)
+}
+
+// Check reports whether the condition holds in d. It doesn't if the counter
+// isn't in d.
+func (t Threshold) Check(d Deltas) bool {
+	delta, ok := d.Counters[t.Name]
+	if !ok {
+		return false
+	}
+	var v float64
+	switch t.Of {
+	case MeasureValue:
+		v = float64(delta.Value)
+	case MeasureRate:
+		v = delta.Rate
+	case MeasureDelta:
+		v = float64(delta.Delta)
+	default:
+		return false
+	}
+	switch t.Op {
+	case Above:
+		return v > t.Limit
+	case Below:
+		return v < t.Limit
+	}
+	return false
+}
+
+// EventKind is the kind of an [Event].
+type EventKind int
+
+const (
+	EventAdded    EventKind = iota // a counter appeared
+	EventRemoved                   // a counter disappeared
+	EventChanged                   // the value of a counter changed
+	EventAlert                     // a threshold started to hold
+	EventResolved                  // a threshold stopped holding
+)
+
+// String returns the name of the kind. Implements [fmt.Stringer].
+func (k EventKind) String() string {
+	switch k {
+	case EventAdded:
+		return "added"
+	case EventRemoved:
+		return "removed"
+	case EventChanged:
+		return "changed"
+	case EventAlert:
+		return "alert"
+	case EventResolved:
+		return "resolved"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler so that EventKind serializes
+// as its name.
+func (k EventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Event is a change seen by a [Watcher].
+type Event struct {
+	Kind EventKind `json:"kind" yaml:"kind"`
+	Time time.Time `json:"time" yaml:"time"`
+	Name string    `json:"name" yaml:"name"` // counter name
+	// Delta is the change of the counter since the previous poll. For an
+	// added counter only its value, semantics and flags are set; for a
+	// removed one they are the last ones seen.
+	Delta Delta `json:"delta" yaml:"delta"`
+	// Threshold is the threshold of an alert or resolution.
+	Threshold *Threshold `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+}
+
+// Watcher delivers the changes of the counters of a [StatReader] on a
+// channel. Obtain one with [StatReader.Watch].
+type Watcher struct {
+	// C receives the events. It is closed once watching stops.
+	C <-chan Event
+
+	done chan struct{}
+	err  error
+}
+
+// Watch polls r every interval in a new goroutine, and sends an [Event] on
+// [Watcher.C] for every counter added, removed or changed since the previous
+// poll. The first poll reports every counter as added.
+//
+// Each threshold is checked at every poll but the first, against the
+// [Deltas] since the previous one: an [EventAlert] is sent when it starts to
+// hold, an [EventResolved] when it stops.
+//
+// Events are sent in that order, by counter name, and Watch waits for the
+// consumer. Watching stops when ctx is cancelled or if [StatReader.Update]
+// fails; see [Watcher.Err]. The StatReader must not be used, nor closed,
+// until [Watcher.C] is closed.
+//
+//	w := r.Watch(ctx, time.Second, stat.OnRate("MAIN.backend_fail", stat.Above, 5))
+//	for ev := range w.C {
+//	    if ev.Kind == stat.EventAlert {
+//	        fmt.Println("alert:", ev.Threshold)
+//	    }
+//	}
+func (r *StatReader) Watch(ctx context.Context, interval time.Duration, thresholds ...Threshold) *Watcher {
+	ch := make(chan Event)
+	w := &Watcher{C: ch, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		defer close(ch)
+		if interval <= 0 {
+			w.err = fmt.Errorf("watch interval must be positive, got %s", interval)
+			return
+		}
+		w.err = r.watch(ctx, ch, interval, thresholds)
+	}()
+	return w
+}
+
+func (r *StatReader) watch(ctx context.Context, ch chan<- Event, interval time.Duration, thresholds []Threshold) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	firing := make([]bool, len(thresholds))
+	var prev Snapshot
+	for first := true; ; first = false {
+		added, removed, err := r.Update()
+		if err != nil {
+			return err
+		}
+		cur := r.Snapshot()
+		if first {
+			// the reader may have been updated before, so report what it
+			// has rather than what this update added
+			added = slices.Collect(maps.Keys(cur.Values))
+		}
+
+		var events []Event
+		for _, name := range slices.Sorted(slices.Values(added)) {
+			v := cur.Values[name]
+			events = append(events, Event{Kind: EventAdded, Time: cur.Time, Name: name,
+				Delta: Delta{Semantics: v.Semantics, Flags: v.Flags, Value: v.Value}})
+		}
+		for _, name := range slices.Sorted(slices.Values(removed)) {
+			v := prev.Values[name]
+			events = append(events, Event{Kind: EventRemoved, Time: cur.Time, Name: name,
+				Delta: Delta{Semantics: v.Semantics, Flags: v.Flags, Value: v.Value}})
+		}
+		if !first {
+			d := Diff(prev, cur)
+			for _, name := range slices.Sorted(maps.Keys(d.Counters)) {
+				if delta := d.Counters[name]; delta.Changed {
+					events = append(events, Event{Kind: EventChanged, Time: cur.Time, Name: name, Delta: delta})
+				}
+			}
+			for i, t := range thresholds {
+				holds := t.Check(d)
+				if holds == firing[i] {
+					continue
+				}
+				firing[i] = holds
+				ev := Event{Kind: EventResolved, Time: cur.Time, Name: t.Name, Delta: d.Counters[t.Name], Threshold: &t}
+				if holds {
+					ev.Kind = EventAlert
+				}
+				events = append(events, ev)
+			}
+		}
+		prev = cur
+
+		for _, ev := range events {
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Err waits for watching to stop and returns why: ctx.Err() on cancellation,
+// or the error returned by [StatReader.Update].
+func (w *Watcher) Err() error {
+	<-w.done
+	return w.err
+}
@@ -0,0 +1,126 @@
+package stat_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/varnish/varnish-go/stat"
+)
+
+func TestThresholdCheck(t *testing.T) {
+	t.Parallel()
+	t0 := time.Unix(1700000000, 0)
+	d := stat.Diff(
+		snapshot(t0, map[string]uint64{"MAIN.backend_fail": 10, "MAIN.n_object": 50}),
+		snapshot(t0.Add(2*time.Second), map[string]uint64{"MAIN.backend_fail": 22, "MAIN.n_object": 150}),
+	)
+	tests := []struct {
+		th   stat.Threshold
+		want bool
+	}{
+		{stat.OnRate("MAIN.backend_fail", stat.Above, 5), true},
+		{stat.OnRate("MAIN.backend_fail", stat.Above, 6), false},
+		{stat.OnRate("MAIN.backend_fail", stat.Below, 10), true},
+		{stat.OnValue("MAIN.backend_fail", stat.Above, 20), true},
+		{stat.OnValue("MAIN.n_object", stat.Above, 100), true},
+		{stat.OnValue("MAIN.n_object", stat.Below, 100), false},
+		{stat.OnValue("MAIN.missing", stat.Below, 100), false},
+		{stat.OnDelta("MAIN.backend_fail", stat.Above, 11), true},
+		{stat.OnDelta("MAIN.n_object", stat.Above, 100), false},
+	}
+	for _, tt := range tests {
+		if got := tt.th.Check(d); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.th, got, tt.want)
+		}
+	}
+	if got, want := stat.OnRate("MAIN.backend_fail", stat.Above, 5).String(), "rate(MAIN.backend_fail) > 5"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	t.Parallel()
+	w := (&stat.StatReader{}).Watch(context.Background(), 0)
+	for range w.C {
+		t.Error("expected no event")
+	}
+	if w.Err() == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
+
+func TestWatchUpdatedReader(t *testing.T) {
+	dir := fakeWorkdir(t, "MAIN", map[string]string{"cache_hit": "info", "cache_miss": "info"})
+	r, err := stat.New().SetName(dir).SetPureGo(true).Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	mustUpdate(t, r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := r.Watch(ctx, time.Hour)
+	var added []string
+	for ev := range w.C {
+		if ev.Kind != stat.EventAdded {
+			t.Fatalf("expected only added counters, got %+v", ev)
+		}
+		if added = append(added, ev.Name); len(added) == 2 {
+			cancel()
+		}
+	}
+	if want := []string{"MAIN.cache_hit", "MAIN.cache_miss"}; !slices.Equal(added, want) {
+		t.Errorf("added %v, want %v", added, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	v := startVarnish(t)
+	defer v.Stop()
+
+	c := newStatReader(t, &v)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := c.Watch(ctx, 50*time.Millisecond, stat.OnValue("MAIN.client_req", stat.Above, 2))
+
+	for ev := range w.C {
+		if ev.Kind != stat.EventAdded {
+			t.Fatalf("expected counters to be added first, got %+v", ev)
+		}
+		if ev.Name == "MAIN.client_req" {
+			break
+		}
+	}
+	for range 3 {
+		if _, err := http.Get(v.URL + "/test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var changed, alerted bool
+	timeout := time.After(5 * time.Second)
+	for !changed || !alerted {
+		select {
+		case ev := <-w.C:
+			switch {
+			case ev.Kind == stat.EventChanged && ev.Name == "MAIN.client_req":
+				changed = ev.Delta.Delta > 0
+			case ev.Kind == stat.EventAlert:
+				alerted = ev.Name == "MAIN.client_req" && ev.Delta.Value == 3
+			}
+		case <-timeout:
+			t.Fatalf("timed out, changed: %v, alerted: %v", changed, alerted)
+		}
+	}
+
+	cancel()
+	for range w.C {
+	}
+	if err := w.Err(); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+package version
+
+// #cgo pkg-config: varnishapi
+// #include <vmod_abi.h>
+//
+// static const char *abi_version_string(void) { return VMOD_ABI_Version; }
+import "C"
+
+func init() {
+	isEnterprise, version, commit = parse(C.GoString(C.abi_version_string()))
+}
@@ -1,24 +1,19 @@
 // Reports the installed Varnish edition
 package version
 
-// #cgo pkg-config: varnishapi
-// #include <vmod_abi.h>
-//
-// static const char *abi_version_string(void) { return VMOD_ABI_Version; }
-import "C"
+// The version is read from varnishapi's headers at build time, with CGo. When
+// the program is built with CGO_ENABLED=0, it is unknown: [IsEnterprise]
+// reports false, and [Version] and [Commit] return empty strings.
 
 import "strings"
 
+// set by the CGo init function of abi.go
 var (
 	isEnterprise bool
 	version      string
 	commit       string
 )
 
-func init() {
-	isEnterprise, version, commit = parse(C.GoString(C.abi_version_string()))
-}
-
 // parse splits a VMOD_ABI_Version string into its components.
 //
 // "Varnish Plus 6.0.17r3 <commit>" → true,  "6.0.17r3", "<commit>"
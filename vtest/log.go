@@ -99,18 +99,18 @@ func (v *Varnish) RecordChannel() (<-chan vsl.Record, error) {
 		defer ls.wg.Done()
 		defer r.Close()
 		defer close(ch)
-		r.Run(ls.ctx, func(txns []vsl.Transaction) error { //nolint:errcheck
-			for _, txn := range txns {
-				for _, rec := range txn.Records {
-					select {
-					case ch <- rec:
-					case <-ls.ctx.Done():
-						return ls.ctx.Err()
-					}
+		for txn, err := range r.Transactions(ls.ctx) {
+			if err != nil {
+				return
+			}
+			for _, rec := range txn.Records {
+				select {
+				case ch <- rec:
+				case <-ls.ctx.Done():
+					return
 				}
 			}
-			return nil
-		})
+		}
 	}()
 
 	return ch, nil
@@ -133,24 +133,14 @@ func (v *Varnish) TransactionChannel() (<-chan vsl.Transaction, error) {
 		return nil, fmt.Errorf("vtest: TransactionChannel attach: %w", err)
 	}
 
-	ch := make(chan vsl.Transaction, 16)
+	s := r.Stream(v.logs.ctx, 16, vsl.BackpressureBlock)
 	ls := v.logs
 	ls.wg.Add(1)
 	go func() {
 		defer ls.wg.Done()
-		defer r.Close()
-		defer close(ch)
-		r.Run(ls.ctx, func(txns []vsl.Transaction) error { //nolint:errcheck
-			for _, txn := range txns {
-				select {
-				case ch <- txn:
-				case <-ls.ctx.Done():
-					return ls.ctx.Err()
-				}
-			}
-			return nil
-		})
+		s.Err() //nolint:errcheck
+		r.Close()
 	}()
 
-	return ch, nil
+	return s.C, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
@@ -399,3 +400,97 @@ func TestGroupingRequestIncludesBackend(t *testing.T) {
 		t.Error("expected TypeBackend in the group (bereq)")
 	}
 }
+
+// readURLs reads the log of v until caught up, resuming from cp, and returns
+// the URLs of the requests it saw and the checkpoint reached.
+func readURLs(t *testing.T, v *vtest.Varnish, cp varnishlog.Checkpoint) ([]string, varnishlog.Checkpoint) {
+	t.Helper()
+	r, err := varnishlog.New().
+		SetName(v.Name()).
+		SetTimeout(5 * time.Second).
+		SetLive(false).
+		ResumeFrom(cp).
+		Attach()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var urls []string
+	err = r.Run(ctx, func(txns []varnishlog.Transaction) error {
+		for _, txn := range txns {
+			for _, rec := range txn.Records {
+				if rec.Tag == varnishlog.TagReqURL {
+					urls = append(urls, rec.Data)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return urls, r.Checkpoint()
+}
+
+// get requests path from v, retrying while the worker starts, and gives
+// Varnish time to write the End record.
+func get(t *testing.T, v *vtest.Varnish, path string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := http.Get(v.URL + path)
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+}
+
+// TestResumeFrom verifies that a reader resuming from a checkpoint only sees
+// the requests made since, including across a restart of the worker.
+func TestResumeFrom(t *testing.T) {
+	t.Parallel()
+
+	v, err := vtest.New().VclString(`
+		backend default none;
+		sub vcl_recv { return(synth(200, "OK")); }
+	`).Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Stop()
+
+	get(t, &v, "/resume-1")
+	get(t, &v, "/resume-2")
+	urls, cp := readURLs(t, &v, varnishlog.Checkpoint{})
+	if !slices.Contains(urls, "/resume-1") || !slices.Contains(urls, "/resume-2") {
+		t.Fatalf("first reader: got %v, want /resume-1 and /resume-2", urls)
+	}
+
+	get(t, &v, "/resume-3")
+	urls, cp = readURLs(t, &v, cp)
+	if !slices.Equal(urls, []string{"/resume-3"}) {
+		t.Errorf("resumed reader: got %v, want [/resume-3]", urls)
+	}
+
+	// the worker starts over with a new log segment and VXIDs
+	for _, cmd := range []string{"stop", "start"} {
+		if _, err := v.Adm(cmd); err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+	}
+	get(t, &v, "/resume-4")
+	urls, _ = readURLs(t, &v, cp)
+	if !slices.Equal(urls, []string{"/resume-4"}) {
+		t.Errorf("after a worker restart: got %v, want [/resume-4]", urls)
+	}
+}